@@ -0,0 +1,146 @@
+package istiogormtracing
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// 保存关联的 span，级联的插入和更新作为它的子 span
+const (
+	_opSaveAssociations = "save_associations"
+	// 保存的关联名称，多个时按名称排序并用逗号分隔
+	_tagAssociations = "db.associations"
+)
+
+// 注册在 gorm:save_before_associations(保存 belongs to 关联)和 gorm:save_after_associations(保存其他关联)前后的事件
+// 插入和更新各自注册一份
+const (
+	_eventBeforeSaveBeforeAssociations = "istio-gorm-tracing-event:before_save_before_associations"
+	_eventAfterSaveBeforeAssociations  = "istio-gorm-tracing-event:after_save_before_associations"
+	_eventBeforeSaveAfterAssociations  = "istio-gorm-tracing-event:before_save_after_associations"
+	_eventAfterSaveAfterAssociations   = "istio-gorm-tracing-event:after_save_after_associations"
+)
+
+// 在 gorm.Statement 中保存关联 span 和保存关联前的 context 的 key
+func (i *IstioGormTracing) associationsSpanKey() string {
+	return i.getSpanKey() + ":associations"
+}
+
+func (i *IstioGormTracing) associationsCtxKey() string {
+	return i.getSpanKey() + ":associations_ctx"
+}
+
+// 保存关联前创建 span 并放入 context，没有需要保存的关联时不创建
+// create 为 false 时为更新，belongsTo 为 true 时为 gorm:save_before_associations
+func (i *IstioGormTracing) beforeSaveAssociations(create, belongsTo bool) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if !belongsTo {
+			releaseConnPool(db)
+		}
+		if db.Error != nil || db.Statement == nil || db.Statement.Context == nil || db.Statement.Schema == nil {
+			return
+		}
+		names := savingAssociations(db, create, belongsTo)
+		if len(names) == 0 {
+			return
+		}
+		span, ctx := i.startParentSpan(db, _opSaveAssociations)
+		if span == nil {
+			return
+		}
+		span.SetTag(_tagAssociations, strings.Join(names, ","))
+		setModelTags(span, db)
+		setTransactionTag(span, db)
+		db.InstanceSet(i.associationsSpanKey(), span)
+		db.InstanceSet(i.associationsCtxKey(), db.Statement.Context)
+		db.Statement.Context = ctx
+	}
+}
+
+// 保存关联后结束 span 并恢复原来的 context
+func (i *IstioGormTracing) afterSaveAssociations(db *gorm.DB) {
+	if db.Statement == nil {
+		return
+	}
+	v, ok := db.InstanceGet(i.associationsSpanKey())
+	if !ok {
+		return
+	}
+	span, ok := v.(opentracing.Span)
+	if !ok || span == nil {
+		return
+	}
+	// 同一个 Statement 的两次保存关联分别创建 span
+	db.InstanceSet(i.associationsSpanKey(), nil)
+	if v, ok := db.InstanceGet(i.associationsCtxKey()); ok {
+		if ctx, ok := v.(context.Context); ok {
+			db.Statement.Context = ctx
+		}
+	}
+	if db.Error != nil && i.isError(db.Error) {
+		setSpanError(span, db.Error)
+	}
+	span.Finish()
+}
+
+// 与 gorm 的判断相同，返回本次需要保存的关联名称：未被 Select/Omit 排除，且关联的值不为空
+func savingAssociations(db *gorm.DB, create, belongsTo bool) []string {
+	rels := db.Statement.Schema.Relationships
+	var candidates []*schema.Relationship
+	if belongsTo {
+		candidates = rels.BelongsTo
+	} else {
+		candidates = append(candidates, rels.HasOne...)
+		candidates = append(candidates, rels.HasMany...)
+		candidates = append(candidates, rels.Many2Many...)
+	}
+	selectColumns, restricted := db.Statement.SelectAndOmitColumns(create, !create)
+	var names []string
+	for _, rel := range candidates {
+		if v, ok := selectColumns[rel.Name]; (ok && !v) || (!ok && restricted) {
+			continue
+		}
+		if hasAssociationValue(db, rel) {
+			names = append(names, rel.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 任意一条数据的关联不为空时返回 true，关联为切片时需要有元素
+func hasAssociationValue(db *gorm.DB, rel *schema.Relationship) bool {
+	has := func(obj reflect.Value) bool {
+		obj = reflect.Indirect(obj)
+		if obj.Kind() != reflect.Struct {
+			return false
+		}
+		v, zero := rel.Field.ValueOf(db.Statement.Context, obj)
+		if zero {
+			return false
+		}
+		rv := reflect.Indirect(reflect.ValueOf(v))
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			return rv.Len() > 0
+		}
+		return true
+	}
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for n := 0; n < rv.Len(); n++ {
+			if has(rv.Index(n)) {
+				return true
+			}
+		}
+		return false
+	}
+	return has(rv)
+}
@@ -0,0 +1,61 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+type associationCompany struct {
+	ID int
+}
+
+type associationUser struct {
+	ID        int
+	CompanyID int
+	Company   associationCompany
+	Orders    []preloadOrder `gorm:"foreignKey:UserID"`
+}
+
+func TestSaveAssociationSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	user := associationUser{ID: 1, Company: associationCompany{ID: 2}, Orders: []preloadOrder{{ID: 3}}}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.FinishedSpans()
+	byID := map[int]*mocktracer.MockSpan{}
+	var saves []*mocktracer.MockSpan
+	for _, span := range spans {
+		byID[span.SpanContext.SpanID] = span
+		if span.OperationName == _opSaveAssociations {
+			saves = append(saves, span)
+		}
+	}
+	if len(saves) != 2 || saves[0].Tag(_tagAssociations) != "Company" || saves[1].Tag(_tagAssociations) != "Orders" {
+		t.Fatalf("save_associations spans = %v", saves)
+	}
+	children := map[string]string{}
+	for _, span := range spans {
+		if parent := byID[span.ParentID]; parent != nil && parent.OperationName == _opSaveAssociations {
+			children[span.Tag(_tagModelTable).(string)] = parent.Tag(_tagAssociations).(string)
+		}
+	}
+	if children["association_companies"] != "Company" || children["preload_orders"] != "Orders" {
+		t.Errorf("cascaded writes = %v", children)
+	}
+
+	// 没有关联数据或被 Omit 排除时不创建
+	tracer.Reset()
+	db.Omit("Company").Create(&associationUser{ID: 4})
+	for _, span := range tracer.FinishedSpans() {
+		if span.OperationName == _opSaveAssociations {
+			t.Errorf("unexpected save_associations span: %v", span.Tags())
+		}
+	}
+}
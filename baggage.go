@@ -0,0 +1,58 @@
+package istiogormtracing
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	// W3C baggage 使用的 header，格式为: baggage: k1=v1,k2=v2;property
+	_headerBaggage = "baggage"
+	// opentracing 约定的 baggage header 前缀，格式为: ot-baggage-{key}: {value}
+	_headerOTBaggagePrefix = "ot-baggage-"
+)
+
+// 从 header 中解析出 baggage，同时支持 W3C baggage 和 ot-baggage-* 两种格式
+func extractBaggage(h http.Header) map[string]string {
+	baggage := map[string]string{}
+	for _, value := range h.Values(_headerBaggage) {
+		for _, member := range strings.Split(value, ",") {
+			// 分号后面是属性，不需要
+			if idx := strings.IndexByte(member, ';'); idx >= 0 {
+				member = member[:idx]
+			}
+			kv := strings.SplitN(member, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			k := strings.TrimSpace(kv[0])
+			v, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+			if k == "" || err != nil {
+				continue
+			}
+			baggage[k] = v
+		}
+	}
+	for k, vs := range h {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, _headerOTBaggagePrefix) && len(vs) > 0 && len(k) > len(_headerOTBaggagePrefix) {
+			baggage[k[len(_headerOTBaggagePrefix):]] = vs[0]
+		}
+	}
+	return baggage
+}
+
+// 将 header 中的 baggage 设置到 span 中继续传递，并按配置将指定的 baggage 记录为 tag
+func (i *IstioGormTracing) applyBaggage(span opentracing.Span, h http.Header) {
+	for k, v := range extractBaggage(h) {
+		span.SetBaggageItem(k, v)
+	}
+	for key, tag := range i.baggageTags {
+		if v := span.BaggageItem(key); v != "" {
+			span.SetTag(tag, v)
+		}
+	}
+}
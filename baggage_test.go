@@ -0,0 +1,52 @@
+package istiogormtracing
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestExtractBaggage(t *testing.T) {
+	h := http.Header{}
+	h.Add("baggage", "tenant=acme;ttl=60, user=a%20b")
+	h.Add("baggage", "invalid,=empty")
+	h.Set("ot-baggage-region", "cn-north")
+
+	want := map[string]string{
+		"tenant": "acme",
+		"user":   "a b",
+		"region": "cn-north",
+	}
+	if got := extractBaggage(h); !reflect.DeepEqual(got, want) {
+		t.Errorf("baggage = %v, want %v", got, want)
+	}
+}
+
+func TestWithBaggageTags(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithBaggageTags(map[string]string{"tenant": "tenant.id", "region": "region"}))); err != nil {
+		t.Fatal(err)
+	}
+	h := http.Header{}
+	h.Set("baggage", "tenant=acme,user=xiaoming")
+	var list []map[string]interface{}
+	db.WithContext(WithHeaders(context.Background(), h)).Table("users").Find(&list)
+
+	span := tracer.FinishedSpans()[0]
+	if span.Tag("tenant.id") != "acme" {
+		t.Errorf("tenant.id = %v", span.Tag("tenant.id"))
+	}
+	// 没有配置的 baggage 和 header 中没有的 baggage 不记录为 tag
+	for _, key := range []string{"user", "region"} {
+		if _, ok := span.Tags()[key]; ok {
+			t.Errorf("%s should not be recorded", key)
+		}
+	}
+	if span.BaggageItem("user") != "xiaoming" {
+		t.Errorf("baggage user = %q", span.BaggageItem("user"))
+	}
+}
@@ -0,0 +1,93 @@
+package istiogormtracing
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"gorm.io/gorm"
+)
+
+// FindInBatches 整体的 span 和每一批的 span，每一批的大小记录在 db.batch.size 中
+const (
+	_opFindInBatches = "find_in_batches"
+	_opBatch         = "batch"
+	// 批次的序号，从 1 开始
+	_tagBatchNumber = "db.batch.number"
+	// FindInBatches 设置的每批数量和实际的批次数
+	_tagBatchLimit = "db.batch.limit"
+	_tagBatchCount = "db.batch.count"
+)
+
+// 在 context 中保存 batchTracker 的 key
+type batchTrackerCtxKey struct{}
+
+// 记录 FindInBatches 当前的批次，每批的查询开始时创建批次 span，处理方法返回后结束
+type batchTracker struct {
+	plugin  *IstioGormTracing
+	parent  opentracing.Span
+	number  int
+	current opentracing.Span
+}
+
+// 与 db.FindInBatches 相同，同时创建 find_in_batches span，每一批的查询和 fc 中的 SQL 放在对应的 batch span 下
+// 使用方式: plugin.FindInBatches(gormDb.WithContext(ctx), &results, 100, func(tx *gorm.DB, batch int) error { ... })
+func (i *IstioGormTracing) FindInBatches(db *gorm.DB, dest interface{}, batchSize int, fc func(tx *gorm.DB, batch int) error) *gorm.DB {
+	span, ctx := i.startParentSpan(db, _opFindInBatches)
+	if span == nil {
+		return db.FindInBatches(dest, batchSize, fc)
+	}
+	span.SetTag(_tagBatchLimit, batchSize)
+	t := &batchTracker{plugin: i, parent: span}
+	result := db.WithContext(context.WithValue(ctx, batchTrackerCtxKey{}, t)).FindInBatches(dest, batchSize, func(tx *gorm.DB, batch int) error {
+		current := t.current
+		t.current = nil
+		if current == nil {
+			return fc(tx, batch)
+		}
+		current.SetTag(_tagBatchSize, tx.RowsAffected)
+		// fc 中的 SQL 作为批次 span 的子 span，且不再创建新的批次
+		origin := tx.Statement.Context
+		tx.Statement.Context = opentracing.ContextWithSpan(context.WithValue(origin, batchTrackerCtxKey{}, (*batchTracker)(nil)), current)
+		err := fc(tx, batch)
+		tx.Statement.Context = origin
+		i.finishBatchSpan(current, err)
+		return err
+	})
+	// 最后一批没有数据或查询出错时不会调用 fc
+	if t.current != nil {
+		t.current.SetTag(_tagBatchSize, 0)
+		i.finishBatchSpan(t.current, result.Error)
+		t.current = nil
+	}
+	span.SetTag(_tagBatchCount, t.number)
+	span.SetTag(_tagRowsReturned, result.RowsAffected)
+	i.finishBatchSpan(span, result.Error)
+	return result
+}
+
+func (i *IstioGormTracing) finishBatchSpan(span opentracing.Span, err error) {
+	if err != nil && i.isError(err) {
+		setSpanError(span, err)
+	}
+	span.Finish()
+}
+
+// FindInBatches 中每一批的查询开始时创建批次 span，返回包含批次 span 的 context；不在 FindInBatches 中时返回原来的 context
+func startBatchSpan(ctx context.Context) context.Context {
+	t, _ := ctx.Value(batchTrackerCtxKey{}).(*batchTracker)
+	if t == nil || t.current != nil {
+		return ctx
+	}
+	t.number++
+	opts := []opentracing.StartSpanOption{
+		opentracing.ChildOf(t.parent.Context()),
+		opentracing.Tag{Key: string(ext.Component), Value: _component},
+		opentracing.Tag{Key: _tagBatchNumber, Value: t.number},
+	}
+	for _, tag := range t.plugin.spanTags {
+		opts = append(opts, tag)
+	}
+	t.current = t.plugin.getTracer().StartSpan(_opBatch, opts...)
+	return opentracing.ContextWithSpan(ctx, t.current)
+}
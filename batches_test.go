@@ -0,0 +1,74 @@
+package istiogormtracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+)
+
+func TestFindInBatchesSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	plugin := NewWithTracer(tracer)
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+	var users []tracingUser
+	called := false
+	result := plugin.FindInBatches(db, &users, 100, func(tx *gorm.DB, batch int) error {
+		called = true
+		return nil
+	})
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	if called {
+		t.Error("fc should not be called without rows")
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 3 {
+		t.Fatalf("spans = %v", spans)
+	}
+	query, batch, parent := spans[0], spans[1], spans[2]
+	if parent.OperationName != _opFindInBatches || parent.Tag(_tagBatchCount) != 1 || parent.Tag(_tagBatchLimit) != 100 {
+		t.Errorf("find_in_batches span = %v %v", parent, parent.Tags())
+	}
+	if batch.OperationName != _opBatch || batch.ParentID != parent.SpanContext.SpanID || batch.Tag(_tagBatchNumber) != 1 || batch.Tag(_tagBatchSize) != 0 {
+		t.Errorf("batch span = %v %v", batch, batch.Tags())
+	}
+	if query.OperationName != _opQuery || query.ParentID != batch.SpanContext.SpanID {
+		t.Errorf("query span = %v", query)
+	}
+
+	// 不在 FindInBatches 中的查询不创建批次 span
+	tracer.Reset()
+	db.Find(&users)
+	if spans := tracer.FinishedSpans(); len(spans) != 1 || spans[0].ParentID != 0 {
+		t.Errorf("spans = %v", spans)
+	}
+}
+
+func TestStartBatchSpan(t *testing.T) {
+	tracer := mocktracer.New()
+	parent := tracer.StartSpan(_opFindInBatches)
+	tracker := &batchTracker{plugin: NewWithTracer(tracer), parent: parent}
+	ctx := context.WithValue(context.Background(), batchTrackerCtxKey{}, tracker)
+
+	first := startBatchSpan(ctx)
+	if first == ctx || tracker.number != 1 || tracker.current == nil {
+		t.Fatalf("first batch not started: %+v", tracker)
+	}
+	// 当前批次还没有结束时不创建新的批次
+	if startBatchSpan(ctx) != ctx || tracker.number != 1 {
+		t.Error("started a second batch while the first is running")
+	}
+	// fc 中的 context 不再创建批次
+	masked := context.WithValue(ctx, batchTrackerCtxKey{}, (*batchTracker)(nil))
+	tracker.current = nil
+	if startBatchSpan(masked) != masked || tracker.number != 1 {
+		t.Error("started a batch inside fc")
+	}
+}
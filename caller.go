@@ -0,0 +1,107 @@
+package istiogormtracing
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// 发起查询的代码位置，与 OpenTelemetry 的 code 属性相同
+const (
+	_tagCodeFilepath = "code.filepath"
+	_tagCodeLineno   = "code.lineno"
+	_tagCodeFunction = "code.function"
+)
+
+// 出错时记录调用栈的日志字段
+const _fieldStack = "stack"
+
+// 插件的包路径，子包(如 oteltracing)的调用也会跳过
+var _pluginPkgPath = reflect.TypeOf(IstioGormTracing{}).PkgPath()
+
+// 最多向上查找的调用层数
+const _maxCallerDepth = 32
+
+// 在 span 中记录发起查询的代码位置(code.filepath、code.lineno、code.function)，需要遍历调用栈，默认不记录
+// 只在采样的 span 上记录
+func WithCallerTags() Option {
+	return func(i *IstioGormTracing) {
+		i.callerTags = true
+	}
+}
+
+// span 确定不采样时返回 false，采样还没有确定或 tracer 无法判断时返回 true
+func spanSampled(span opentracing.Span) bool {
+	sc, ok := span.Context().(interface {
+		IsSampled() bool
+		IsSamplingFinalized() bool
+	})
+	return !ok || sc.IsSampled() || !sc.IsSamplingFinalized()
+}
+
+// 记录发起查询的代码位置，跳过 gorm 和插件自身的调用
+func setCallerTags(span opentracing.Span) {
+	frame, ok := callerFrame()
+	if !ok {
+		return
+	}
+	span.SetTag(_tagCodeFilepath, frame.File)
+	span.SetTag(_tagCodeLineno, frame.Line)
+	span.SetTag(_tagCodeFunction, frame.Function)
+}
+
+// SQL 出错时在 span 日志的 stack 字段中记录调用栈，只包含业务代码，便于排查线上偶发的错误
+func WithErrorStackTrace() Option {
+	return func(i *IstioGormTracing) {
+		i.errorStack = true
+	}
+}
+
+// 业务代码的调用栈，跳过 gorm、runtime 和插件自身的调用，格式与 panic 时输出的调用栈相同
+func stackTrace() string {
+	pcs := make([]uintptr, _maxCallerDepth)
+	// 跳过 runtime.Callers 和 stackTrace
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		if !isLibraryFrame(frame) {
+			fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			return b.String()
+		}
+	}
+}
+
+func callerFrame() (runtime.Frame, bool) {
+	pcs := make([]uintptr, _maxCallerDepth)
+	// 跳过 runtime.Callers、callerFrame 和 setCallerTags
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !isLibraryFrame(frame) {
+			return frame, true
+		}
+		if !more {
+			return runtime.Frame{}, false
+		}
+	}
+}
+
+// gorm、runtime 和插件自身的调用，插件的测试代码除外
+func isLibraryFrame(frame runtime.Frame) bool {
+	if strings.HasPrefix(frame.Function, "gorm.io/") || strings.HasPrefix(frame.Function, "runtime.") {
+		return true
+	}
+	fn := strings.TrimPrefix(frame.Function, _pluginPkgPath)
+	if fn == frame.Function || fn == "" || (fn[0] != '.' && fn[0] != '/') {
+		return false
+	}
+	return !strings.HasSuffix(frame.File, "_test.go")
+}
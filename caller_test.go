@@ -0,0 +1,119 @@
+package istiogormtracing
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/uber/jaeger-client-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestCallerTags(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		tracer := mocktracer.New()
+		db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var opts []Option
+		if enabled {
+			opts = append(opts, WithCallerTags())
+		}
+		if err := db.Use(NewWithTracer(tracer, opts...)); err != nil {
+			t.Fatal(err)
+		}
+		var list []map[string]interface{}
+		_, _, line, _ := runtime.Caller(0)
+		db.Table("users").Find(&list)
+
+		span := tracer.FinishedSpans()[0]
+		if !enabled {
+			if _, ok := span.Tags()[_tagCodeFilepath]; ok {
+				t.Error("caller tags should not be recorded by default")
+			}
+			continue
+		}
+		if file, _ := span.Tag(_tagCodeFilepath).(string); !strings.HasSuffix(file, "caller_test.go") {
+			t.Errorf("code.filepath = %v", span.Tag(_tagCodeFilepath))
+		}
+		if span.Tag(_tagCodeLineno) != line+1 {
+			t.Errorf("code.lineno = %v, want %d", span.Tag(_tagCodeLineno), line+1)
+		}
+		if fn, _ := span.Tag(_tagCodeFunction).(string); !strings.HasSuffix(fn, ".TestCallerTags") {
+			t.Errorf("code.function = %v", span.Tag(_tagCodeFunction))
+		}
+	}
+}
+
+func TestSpanSampled(t *testing.T) {
+	for _, sampled := range []bool{false, true} {
+		tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(sampled), jaeger.NewNullReporter())
+		span := tracer.StartSpan("query")
+		if got := spanSampled(span); got != sampled {
+			t.Errorf("const sampler %v: spanSampled = %v", sampled, got)
+		}
+		span.Finish()
+		closer.Close()
+	}
+	// 无法判断是否采样的 tracer 按采样处理
+	if !spanSampled(mocktracer.New().StartSpan("query")) {
+		t.Error("mocktracer span should be treated as sampled")
+	}
+}
+
+func TestIsLibraryFrame(t *testing.T) {
+	cases := []struct {
+		frame runtime.Frame
+		want  bool
+	}{
+		{runtime.Frame{Function: "gorm.io/gorm.(*DB).Find", File: "/go/pkg/mod/gorm.io/gorm@v1.23.6/finisher_api.go"}, true},
+		{runtime.Frame{Function: _pluginPkgPath + ".(*IstioGormTracing)._injectBefore", File: "/src/istio-gorm-tracing.go"}, true},
+		{runtime.Frame{Function: _pluginPkgPath + "/oteltracing.(*Plugin).before", File: "/src/oteltracing/plugin.go"}, true},
+		{runtime.Frame{Function: _pluginPkgPath + "-example.main", File: "/src/main.go"}, false},
+		{runtime.Frame{Function: "main.loadUser", File: "/src/main.go"}, false},
+	}
+	for _, c := range cases {
+		if got := isLibraryFrame(c.frame); got != c.want {
+			t.Errorf("isLibraryFrame(%s) = %v, want %v", c.frame.Function, got, c.want)
+		}
+	}
+}
+
+func TestWithErrorStackTrace(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		tracer := mocktracer.New()
+		db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var opts []Option
+		if enabled {
+			opts = append(opts, WithErrorStackTrace())
+		}
+		if err := db.Use(NewWithTracer(tracer, opts...)); err != nil {
+			t.Fatal(err)
+		}
+		tx := db.Table("users")
+		tx.AddError(&fakePgError{code: "40P01"})
+		var list []map[string]interface{}
+		tx.Find(&list)
+
+		stack := ""
+		for _, record := range tracer.FinishedSpans()[0].Logs() {
+			for _, field := range record.Fields {
+				if field.Key == _fieldStack {
+					stack = field.ValueString
+				}
+			}
+		}
+		if enabled != strings.Contains(stack, ".TestWithErrorStackTrace\n") {
+			t.Errorf("enabled=%v: stack = %q", enabled, stack)
+		}
+		if strings.Contains(stack, "gorm.io/") {
+			t.Errorf("stack should not contain gorm frames: %q", stack)
+		}
+	}
+}
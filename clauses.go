@@ -0,0 +1,60 @@
+package istiogormtracing
+
+import (
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// gorm 子句的信息，可以在 jaeger 中搜索没有 WHERE 的更新和删除、没有 LIMIT 的查询等危险的 SQL
+const (
+	_tagClauseWhere   = "db.clause.where"
+	_tagClauseLimit   = "db.clause.limit"
+	_tagClauseOffset  = "db.clause.offset"
+	_tagClauseJoins   = "db.clause.joins"
+	_tagClauseOrderBy = "db.clause.order_by"
+)
+
+// 记录子句的信息，Raw 和 Exec 执行的 SQL 没有子句，不记录
+func setClauseTags(span opentracing.Span, db *gorm.DB, op string) {
+	clauses := db.Statement.Clauses
+	if len(clauses) == 0 {
+		return
+	}
+	if op != _opCreate {
+		where, _ := clauses["WHERE"].Expression.(clause.Where)
+		span.SetTag(_tagClauseWhere, len(where.Exprs) > 0)
+	}
+	if limit, ok := clauses["LIMIT"].Expression.(clause.Limit); ok {
+		if limit.Limit > 0 {
+			span.SetTag(_tagClauseLimit, limit.Limit)
+		}
+		if limit.Offset > 0 {
+			span.SetTag(_tagClauseOffset, limit.Offset)
+		}
+	}
+	// gorm 在执行查询时将 Joins 转换为 FROM 子句中的 JOIN
+	joins := len(db.Statement.Joins)
+	if from, ok := clauses["FROM"].Expression.(clause.From); ok && len(from.Joins) > joins {
+		joins = len(from.Joins)
+	}
+	if joins > 0 {
+		span.SetTag(_tagClauseJoins, joins)
+	}
+	if orderBy, ok := clauses["ORDER BY"].Expression.(clause.OrderBy); ok && len(orderBy.Columns) > 0 {
+		columns := make([]string, 0, len(orderBy.Columns))
+		for _, c := range orderBy.Columns {
+			column := c.Column.Name
+			if c.Column.Table != "" && !c.Column.Raw {
+				column = c.Column.Table + "." + column
+			}
+			if c.Desc {
+				column += " DESC"
+			}
+			columns = append(columns, column)
+		}
+		span.SetTag(_tagClauseOrderBy, strings.Join(columns, ", "))
+	}
+}
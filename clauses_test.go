@@ -0,0 +1,47 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestClauseTags(t *testing.T) {
+	tracer := mocktracer.New()
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Joins("JOIN orders ON orders.user_id = users.id").Where("users.id > ?", 1).Order("users.id desc").Order("name").Limit(10).Offset(20).Find(&list)
+	db.Session(&gorm.Session{AllowGlobalUpdate: true}).Table("users").Delete(map[string]interface{}{})
+	db.Exec("DELETE FROM users")
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	want := map[string]interface{}{
+		_tagClauseWhere:   true,
+		_tagClauseLimit:   10,
+		_tagClauseOffset:  20,
+		_tagClauseJoins:   1,
+		_tagClauseOrderBy: "users.id desc, name",
+	}
+	for k, v := range want {
+		if got := spans[0].Tag(k); got != v {
+			t.Errorf("query: %s = %v, want %v", k, got, v)
+		}
+	}
+	if got := spans[1].Tag(_tagClauseWhere); got != false {
+		t.Errorf("global delete: %s = %v", _tagClauseWhere, got)
+	}
+	if _, ok := spans[2].Tags()[_tagClauseWhere]; ok {
+		t.Error("raw SQL should not record clause tags")
+	}
+}
@@ -0,0 +1,197 @@
+package istiogormtracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	_defaultCloudTraceEndpoint = "https://cloudtrace.googleapis.com"
+	// GKE、GCE 的 metadata server，可以通过 GCE_METADATA_HOST 修改，与 google 官方的库一致
+	_defaultMetadataHost = "metadata.google.internal"
+	// token 过期前提前刷新的时间
+	_tokenRefreshBefore = time.Minute
+)
+
+// 上报到 google cloud trace 的配置
+type CloudTraceConfig struct {
+	// 项目 id，为空时依次读取 GOOGLE_CLOUD_PROJECT 环境变量和 metadata server
+	ProjectID string
+	// 默认为 https://cloudtrace.googleapis.com
+	Endpoint string
+	// 获取 access token，为空时从 metadata server 获取 pod 绑定的服务账号(Workload Identity)或节点服务账号的 token
+	TokenSource func() (string, error)
+}
+
+// cloud trace v2 的 span 格式，见 https://cloud.google.com/trace/docs/reference/v2/rest/v2/projects.traces/batchWrite
+type cloudTraceSpan struct {
+	Name         string               `json:"name"`
+	SpanID       string               `json:"spanId"`
+	ParentSpanID string               `json:"parentSpanId,omitempty"`
+	DisplayName  cloudTraceString     `json:"displayName"`
+	StartTime    string               `json:"startTime"`
+	EndTime      string               `json:"endTime"`
+	Attributes   cloudTraceAttributes `json:"attributes"`
+	Status       *cloudTraceStatus    `json:"status,omitempty"`
+	SpanKind     string               `json:"spanKind"`
+}
+
+type cloudTraceString struct {
+	Value string `json:"value"`
+}
+
+type cloudTraceAttributes struct {
+	AttributeMap map[string]cloudTraceAttribute `json:"attributeMap"`
+}
+
+type cloudTraceAttribute struct {
+	StringValue cloudTraceString `json:"stringValue"`
+}
+
+type cloudTraceStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// 直接写入 google cloud trace，span 的名称为 projects/{project id}/traces/{trace id}/spans/{span id}
+// 运行在 GKE 中时不需要额外配置，项目 id 和 token 都从 metadata server 获取
+func NewCloudTraceReporter(cfg CloudTraceConfig) jaeger.Reporter {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = _defaultCloudTraceEndpoint
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	client := newReporterClient()
+	m := &metadataClient{client: client}
+	tokenSource := cfg.TokenSource
+	if tokenSource == nil {
+		tokenSource = m.token
+	}
+
+	var (
+		mu        sync.Mutex
+		projectID = cfg.ProjectID
+	)
+	if projectID == "" {
+		projectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	return newBatchReporter(func(spans []*spanData) error {
+		mu.Lock()
+		if projectID == "" {
+			id, err := m.get("project/project-id")
+			if err != nil {
+				mu.Unlock()
+				return fmt.Errorf("获取 google cloud 项目 id 失败, 错误原因: %w", err)
+			}
+			projectID = id
+		}
+		project := projectID
+		mu.Unlock()
+
+		token, err := tokenSource()
+		if err != nil {
+			return fmt.Errorf("获取 google cloud access token 失败, 错误原因: %w", err)
+		}
+		header := http.Header{}
+		header.Set("Authorization", "Bearer "+token)
+		url := fmt.Sprintf("%s/v2/projects/%s/traces:batchWrite", endpoint, project)
+		body := map[string]interface{}{"spans": toCloudTraceSpans(project, spans)}
+		return sendJSON(client, http.MethodPost, url, header, body)
+	}, nil)
+}
+
+func toCloudTraceSpans(projectID string, spans []*spanData) []cloudTraceSpan {
+	out := make([]cloudTraceSpan, 0, len(spans))
+	for _, d := range spans {
+		traceID := fmt.Sprintf("%016x%016x", d.TraceID.High, d.TraceID.Low)
+		spanID := fmt.Sprintf("%016x", uint64(d.SpanID))
+		span := cloudTraceSpan{
+			Name:        fmt.Sprintf("projects/%s/traces/%s/spans/%s", projectID, traceID, spanID),
+			SpanID:      spanID,
+			DisplayName: cloudTraceString{Value: "gorm." + d.Operation},
+			StartTime:   d.Start.UTC().Format(time.RFC3339Nano),
+			EndTime:     d.Start.Add(d.Duration).UTC().Format(time.RFC3339Nano),
+			Attributes:  cloudTraceAttributes{AttributeMap: map[string]cloudTraceAttribute{}},
+			SpanKind:    "CLIENT",
+		}
+		if d.ParentID != 0 {
+			span.ParentSpanID = fmt.Sprintf("%016x", uint64(d.ParentID))
+		}
+		for k, v := range d.Tags {
+			span.Attributes.AttributeMap[k] = cloudTraceAttribute{StringValue: cloudTraceString{Value: fmt.Sprint(v)}}
+		}
+		for k, v := range d.Fields {
+			span.Attributes.AttributeMap[k] = cloudTraceAttribute{StringValue: cloudTraceString{Value: v}}
+		}
+		// google.rpc.Code 中 2 为 UNKNOWN
+		if d.isError() {
+			span.Status = &cloudTraceStatus{Code: 2, Message: d.Fields["error.object"]}
+		}
+		out = append(out, span)
+	}
+	return out
+}
+
+// 访问 metadata server，缓存 token 直到快过期
+type metadataClient struct {
+	client *http.Client
+
+	mu      sync.Mutex
+	value   string
+	expires time.Time
+}
+
+func (m *metadataClient) get(path string) (string, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = _defaultMetadataHost
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+host+"/computeMetadata/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server 返回状态码 %d", resp.StatusCode)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (m *metadataClient) token() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.value != "" && time.Now().Before(m.expires) {
+		return m.value, nil
+	}
+	s, err := m.get("instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal([]byte(s), &token); err != nil {
+		return "", err
+	}
+	m.value = token.AccessToken
+	m.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - _tokenRefreshBefore)
+	return m.value, nil
+}
@@ -0,0 +1,64 @@
+package istiogormtracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestCloudTraceReporter(t *testing.T) {
+	var (
+		path  string
+		auth  string
+		spans []cloudTraceSpan
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/computeMetadata/v1/project/project-id":
+			w.Write([]byte("my-project"))
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"access_token":"token","expires_in":3600,"token_type":"Bearer"}`))
+		default:
+			path, auth = r.URL.Path, r.Header.Get("Authorization")
+			var body struct {
+				Spans []cloudTraceSpan `json:"spans"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			spans = body.Spans
+		}
+	}))
+	defer server.Close()
+	os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+	defer os.Unsetenv("GCE_METADATA_HOST")
+
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), NewCloudTraceReporter(CloudTraceConfig{Endpoint: server.URL}))
+	traceID, _ := jaeger.TraceIDFromString("463ac35c9f6413ad48485a3953bb6124")
+	parent := jaeger.NewSpanContext(traceID, 0x0020000000000001, 0, true, nil)
+	span := tracer.StartSpan(_opQuery, opentracing.ChildOf(parent))
+	span.LogFields(opentracinglog.String("sql", "SELECT 1"))
+	span.Finish()
+	closer.Close()
+
+	if path != "/v2/projects/my-project/traces:batchWrite" || auth != "Bearer token" {
+		t.Fatalf("path = %s, auth = %s", path, auth)
+	}
+	spanID := span.Context().(jaeger.SpanContext).SpanID()
+	if len(spans) != 1 || spans[0].Name != "projects/my-project/traces/463ac35c9f6413ad48485a3953bb6124/spans/"+spanID.String() ||
+		spans[0].ParentSpanID != "0020000000000001" {
+		t.Fatalf("spans = %+v", spans)
+	}
+	if spans[0].Attributes.AttributeMap["sql"].StringValue.Value != "SELECT 1" {
+		t.Errorf("attributes = %+v", spans[0].Attributes)
+	}
+}
@@ -0,0 +1,433 @@
+package istiogormtracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/config"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置文件的内容，支持 yaml 和 json，字段名相同
+type Config struct {
+	ServiceName string `yaml:"service_name" json:"service_name"`
+	// 数据库名称，记录在 span 的 db.instance tag 中
+	DBName string `yaml:"db_name" json:"db_name"`
+	// 按 OpenTelemetry 数据库语义约定记录 SQL 信息
+	SemanticConventions bool `yaml:"semantic_conventions" json:"semantic_conventions"`
+	// SQL 信息的记录方式，logs、tags 或 both
+	SQLRecordMode string `yaml:"sql_record_mode" json:"sql_record_mode"`
+	// 记录哪些 SQL 信息，可选 sql、query、bindings，为空时全部记录
+	SQLFields []string `yaml:"sql_fields" json:"sql_fields"`
+	// 记录的 SQL 的最大长度(字节)，为 0 时不限制
+	MaxSQLLength int `yaml:"max_sql_length" json:"max_sql_length"`
+	// 每个 span 最多记录的日志字段数量和字节数，为 0 时不限制
+	MaxLogFields int `yaml:"max_log_fields" json:"max_log_fields"`
+	MaxLogBytes  int `yaml:"max_log_bytes" json:"max_log_bytes"`
+	// 隐私模式，只记录带占位符的 SQL，不记录参数
+	RedactParams bool `yaml:"redact_params" json:"redact_params"`
+	// 参数需要替换为 *** 的敏感字段
+	MaskColumns []string `yaml:"mask_columns" json:"mask_columns"`
+	// 不追踪的表，见 WithExcludeTables
+	ExcludeTables []string `yaml:"exclude_tables" json:"exclude_tables"`
+	// 不追踪的操作，可选 create、update、delete、query、row、raw、count、pluck、scan
+	ExcludeOperations []string `yaml:"exclude_operations" json:"exclude_operations"`
+	// 记录 SQL 前使用的内置处理规则，可选 email、phone、bearer_token
+	SQLSanitizers []string `yaml:"sql_sanitizers" json:"sql_sanitizers"`
+	// 记录 SQL 指纹，为 hash 时记录指纹的哈希值，可选 plain、hash
+	Fingerprint string `yaml:"fingerprint" json:"fingerprint"`
+	// span 操作名称的模板，如 "{{.Op}} {{.Table}}"，见 WithOperationNameTemplate
+	OperationNameTemplate string `yaml:"operation_name_template" json:"operation_name_template"`
+	// 将 gorm.ErrRecordNotFound 记录为错误，默认不记录
+	RecordNotFoundAsError bool `yaml:"record_not_found_as_error" json:"record_not_found_as_error"`
+	// SQL 出错时记录调用栈
+	ErrorStackTrace bool `yaml:"error_stack_trace" json:"error_stack_trace"`
+	// 记录发起查询的代码位置
+	CallerTags bool `yaml:"caller_tags" json:"caller_tags"`
+	// 慢查询阈值，如 200ms，为空时不标记慢查询；slow_query_log 为 true 时在 span 中记录慢查询日志
+	SlowQueryThreshold string `yaml:"slow_query_threshold" json:"slow_query_threshold"`
+	SlowQueryLog       bool   `yaml:"slow_query_log" json:"slow_query_log"`
+	// 上报的最短执行时间，如 50ms，执行时间更短的 SQL 不上报，见 WithMinDuration
+	MinDuration string `yaml:"min_duration" json:"min_duration"`
+	// 从 baggage 中获取租户 id 使用的 key，见 TenantFromBaggage
+	TenantBaggageKey string `yaml:"tenant_baggage_key" json:"tenant_baggage_key"`
+	// 在 gorm.Statement 中保存 span 使用的 key，见 WithSpanKey
+	SpanKey string `yaml:"span_key" json:"span_key"`
+	// jaeger 收集器地址，如 http://jaeger-collector.istio-system:14268/api/traces
+	CollectorEndpoint string `yaml:"collector_endpoint" json:"collector_endpoint"`
+	// jaeger agent 地址，如 127.0.0.1:6831
+	AgentHostPort string `yaml:"agent_host_port" json:"agent_host_port"`
+	MaxPacketSize int    `yaml:"max_packet_size" json:"max_packet_size"`
+	// 生成 128 位的 trace id
+	TraceID128Bit bool `yaml:"traceid_128bit" json:"traceid_128bit"`
+	// 连接收集器使用的证书和认证信息
+	CollectorTLS  *TLSFileConfig `yaml:"collector_tls" json:"collector_tls"`
+	CollectorAuth AuthFileConfig `yaml:"collector_auth" json:"collector_auth"`
+	// 注册插件时检查收集器是否可以访问
+	ValidateEndpoint bool               `yaml:"validate_endpoint" json:"validate_endpoint"`
+	Sampler          *SamplerFileConfig `yaml:"sampler" json:"sampler"`
+	Reporter         ReporterFileConfig `yaml:"reporter" json:"reporter"`
+	// 解析父 span 时依次尝试的格式，如 [w3c, b3]，为空时使用默认的顺序
+	Propagation []string          `yaml:"propagation" json:"propagation"`
+	Tags        map[string]string `yaml:"tags" json:"tags"`
+	// 记录在每个 span 中的 tag，见 WithSpanTags
+	SpanTags map[string]string `yaml:"span_tags" json:"span_tags"`
+	// 是否记录 k8s 的部署信息和应用版本，见 WithProcessTags
+	ProcessTags bool   `yaml:"process_tags" json:"process_tags"`
+	Version     string `yaml:"version" json:"version"`
+}
+
+// 证书文件的路径，见 LoadTLSConfig
+type TLSFileConfig struct {
+	CAFile   string `yaml:"ca_file" json:"ca_file"`
+	CertFile string `yaml:"cert_file" json:"cert_file"`
+	KeyFile  string `yaml:"key_file" json:"key_file"`
+}
+
+// basic auth 和 bearer token 二选一
+type AuthFileConfig struct {
+	Username    string `yaml:"username" json:"username"`
+	Password    string `yaml:"password" json:"password"`
+	BearerToken string `yaml:"bearer_token" json:"bearer_token"`
+}
+
+// 采样配置，type 为 const、probabilistic、ratelimiting、remote
+type SamplerFileConfig struct {
+	Type  string  `yaml:"type" json:"type"`
+	Param float64 `yaml:"param" json:"param"`
+	// 只对 remote 生效，采样服务的地址和拉取间隔，间隔的格式如 1m
+	SamplingServerURL string `yaml:"sampling_server_url" json:"sampling_server_url"`
+	RefreshInterval   string `yaml:"refresh_interval" json:"refresh_interval"`
+	// 按操作名称分别采样时的操作数量上限
+	MaxOperations int `yaml:"max_operations" json:"max_operations"`
+}
+
+type ReporterFileConfig struct {
+	QueueSize int `yaml:"queue_size" json:"queue_size"`
+	// 格式如 1s、500ms
+	FlushInterval string `yaml:"flush_interval" json:"flush_interval"`
+	BatchSize     int    `yaml:"batch_size" json:"batch_size"`
+	LogSpans      *bool  `yaml:"log_spans" json:"log_spans"`
+}
+
+// 读取配置文件并校验，按扩展名区分格式，.json 为 json，其他为 yaml，不认识的字段会报错
+func LoadConfigFile(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("配置文件读取失败, 错误原因: %w", err)
+	}
+	cfg := &Config{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		// 空文件使用默认配置
+		if err = dec.Decode(cfg); err == io.EOF {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("配置文件 %s 解析失败, 错误原因: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("配置文件 %s 校验失败, 错误原因: %w", path, err)
+	}
+	// 提前加载证书，证书有问题时在启动时报错
+	if _, err := cfg.Options(); err != nil {
+		return nil, fmt.Errorf("配置文件 %s 校验失败, 错误原因: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// 校验配置，启动时就能发现写错的配置
+func (c *Config) Validate() error {
+	if c.CollectorEndpoint != "" {
+		u, err := url.Parse(c.CollectorEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("collector_endpoint 必须是 http(s) 地址: %s", c.CollectorEndpoint)
+		}
+	}
+	if c.MaxPacketSize < 0 {
+		return fmt.Errorf("max_packet_size 不能小于 0: %d", c.MaxPacketSize)
+	}
+	if c.Reporter.QueueSize < 0 {
+		return fmt.Errorf("reporter.queue_size 不能小于 0: %d", c.Reporter.QueueSize)
+	}
+	if c.Reporter.BatchSize < 0 {
+		return fmt.Errorf("reporter.batch_size 不能小于 0: %d", c.Reporter.BatchSize)
+	}
+	if c.Reporter.FlushInterval != "" {
+		if d, err := time.ParseDuration(c.Reporter.FlushInterval); err != nil || d <= 0 {
+			return fmt.Errorf("reporter.flush_interval 格式错误: %s", c.Reporter.FlushInterval)
+		}
+	}
+	if s := c.Sampler; s != nil {
+		switch s.Type {
+		case jaeger.SamplerTypeConst:
+			if s.Param != 0 && s.Param != 1 {
+				return fmt.Errorf("const 采样的 param 只能是 0 或 1: %v", s.Param)
+			}
+		case jaeger.SamplerTypeProbabilistic:
+			if s.Param < 0 || s.Param > 1 {
+				return fmt.Errorf("probabilistic 采样的 param 必须在 0 到 1 之间: %v", s.Param)
+			}
+		case jaeger.SamplerTypeRateLimiting:
+			if s.Param < 0 {
+				return fmt.Errorf("ratelimiting 采样的 param 不能小于 0: %v", s.Param)
+			}
+		case jaeger.SamplerTypeRemote:
+			if s.Param < 0 || s.Param > 1 {
+				return fmt.Errorf("remote 采样的 param 必须在 0 到 1 之间: %v", s.Param)
+			}
+			if s.SamplingServerURL != "" {
+				if u, err := url.Parse(s.SamplingServerURL); err != nil || u.Host == "" {
+					return fmt.Errorf("sampler.sampling_server_url 格式错误: %s", s.SamplingServerURL)
+				}
+			}
+			if s.MaxOperations < 0 {
+				return fmt.Errorf("sampler.max_operations 不能小于 0: %d", s.MaxOperations)
+			}
+			if s.RefreshInterval != "" {
+				if d, err := time.ParseDuration(s.RefreshInterval); err != nil || d <= 0 {
+					return fmt.Errorf("sampler.refresh_interval 格式错误: %s", s.RefreshInterval)
+				}
+			}
+		default:
+			return fmt.Errorf("不支持的采样类型: %s", s.Type)
+		}
+	}
+	if len(c.Propagation) > 0 {
+		if _, err := NewCompositePropagator(c.Propagation...); err != nil {
+			return err
+		}
+	}
+	switch SQLRecordMode(c.SQLRecordMode) {
+	case "", SQLAsLogs, SQLAsTags, SQLAsLogsAndTags:
+	default:
+		return fmt.Errorf("sql_record_mode 只能是 logs、tags 或 both: %s", c.SQLRecordMode)
+	}
+	if c.MaxSQLLength < 0 {
+		return fmt.Errorf("max_sql_length 不能小于 0: %d", c.MaxSQLLength)
+	}
+	if c.MaxLogFields < 0 {
+		return fmt.Errorf("max_log_fields 不能小于 0: %d", c.MaxLogFields)
+	}
+	if c.MaxLogBytes < 0 {
+		return fmt.Errorf("max_log_bytes 不能小于 0: %d", c.MaxLogBytes)
+	}
+	for _, name := range c.SQLFields {
+		if _, ok := _sqlFieldNames[name]; !ok {
+			return fmt.Errorf("sql_fields 只能包含 sql、query、bindings: %s", name)
+		}
+	}
+	if c.SlowQueryThreshold != "" {
+		if d, err := time.ParseDuration(c.SlowQueryThreshold); err != nil || d <= 0 {
+			return fmt.Errorf("slow_query_threshold 格式错误: %s", c.SlowQueryThreshold)
+		}
+	}
+	if c.MinDuration != "" {
+		if d, err := time.ParseDuration(c.MinDuration); err != nil || d <= 0 {
+			return fmt.Errorf("min_duration 格式错误: %s", c.MinDuration)
+		}
+	}
+	if c.OperationNameTemplate != "" {
+		if _, err := template.New("operation").Parse(c.OperationNameTemplate); err != nil {
+			return fmt.Errorf("operation_name_template 解析失败: %w", err)
+		}
+	}
+	switch c.Fingerprint {
+	case "", "plain", "hash":
+	default:
+		return fmt.Errorf("fingerprint 只能是 plain 或 hash: %s", c.Fingerprint)
+	}
+	for _, op := range c.ExcludeOperations {
+		if !_excludableOperations[op] {
+			return fmt.Errorf("exclude_operations 只能包含 create、update、delete、query、row、raw、count、pluck、scan: %s", op)
+		}
+	}
+	for _, name := range c.SQLSanitizers {
+		if _, ok := _sqlSanitizerNames[name]; !ok {
+			return fmt.Errorf("sql_sanitizers 只能包含 email、phone、bearer_token: %s", name)
+		}
+	}
+	if c.CollectorAuth.BearerToken != "" && c.CollectorAuth.Username != "" {
+		return fmt.Errorf("collector_auth 中 username 和 bearer_token 只能设置一个")
+	}
+	return nil
+}
+
+// 转换为配置项，设置了证书时会读取证书文件
+func (c *Config) Options() ([]Option, error) {
+	opts := []Option{
+		WithServiceName(c.ServiceName),
+		WithDBName(c.DBName),
+		WithSpanKey(c.SpanKey),
+		WithCollectorEndpoint(c.CollectorEndpoint),
+		WithReporterQueueSize(c.Reporter.QueueSize),
+		WithReporterBatchSize(c.Reporter.BatchSize),
+	}
+	if c.Reporter.FlushInterval != "" {
+		interval, err := time.ParseDuration(c.Reporter.FlushInterval)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithReporterFlushInterval(interval))
+	}
+	if c.Reporter.LogSpans != nil {
+		opts = append(opts, WithLogSpans(*c.Reporter.LogSpans))
+	}
+	if c.AgentHostPort != "" {
+		opts = append(opts, WithAgentHostPort(c.AgentHostPort), WithMaxPacketSize(c.MaxPacketSize))
+	}
+	if c.CollectorTLS != nil {
+		tlsConfig, err := LoadTLSConfig(c.CollectorTLS.CAFile, c.CollectorTLS.CertFile, c.CollectorTLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithCollectorTLS(tlsConfig))
+	}
+	if c.CollectorAuth.Username != "" {
+		opts = append(opts, WithCollectorBasicAuth(c.CollectorAuth.Username, c.CollectorAuth.Password))
+	}
+	if c.CollectorAuth.BearerToken != "" {
+		opts = append(opts, WithCollectorBearerToken(c.CollectorAuth.BearerToken))
+	}
+	if c.Sampler != nil {
+		sampler := &config.SamplerConfig{
+			Type:              c.Sampler.Type,
+			Param:             c.Sampler.Param,
+			SamplingServerURL: c.Sampler.SamplingServerURL,
+			MaxOperations:     c.Sampler.MaxOperations,
+		}
+		if c.Sampler.RefreshInterval != "" {
+			interval, err := time.ParseDuration(c.Sampler.RefreshInterval)
+			if err != nil {
+				return nil, err
+			}
+			sampler.SamplingRefreshInterval = interval
+		}
+		opts = append(opts, WithSampler(sampler))
+	}
+	if len(c.Propagation) > 0 {
+		p, _ := NewCompositePropagator(c.Propagation...)
+		opts = append(opts, WithPropagator(p))
+	}
+	if len(c.Tags) > 0 {
+		tags := make(map[string]interface{}, len(c.Tags))
+		for k, v := range c.Tags {
+			tags[k] = v
+		}
+		opts = append(opts, WithTags(tags))
+	}
+	if len(c.SpanTags) > 0 {
+		tags := make(map[string]interface{}, len(c.SpanTags))
+		for k, v := range c.SpanTags {
+			tags[k] = v
+		}
+		opts = append(opts, WithSpanTags(tags))
+	}
+	if c.SlowQueryThreshold != "" {
+		threshold, err := time.ParseDuration(c.SlowQueryThreshold)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithSlowQueryThreshold(threshold, c.SlowQueryLog))
+	}
+	if c.MinDuration != "" {
+		d, err := time.ParseDuration(c.MinDuration)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithMinDuration(d))
+	}
+	if c.TenantBaggageKey != "" {
+		opts = append(opts, WithTenantExtractor(TenantFromBaggage(c.TenantBaggageKey)))
+	}
+	if c.ErrorStackTrace {
+		opts = append(opts, WithErrorStackTrace())
+	}
+	if c.CallerTags {
+		opts = append(opts, WithCallerTags())
+	}
+	if c.RecordNotFoundAsError {
+		opts = append(opts, WithErrorFilter(nil))
+	}
+	if c.OperationNameTemplate != "" {
+		opts = append(opts, WithOperationNameTemplate(c.OperationNameTemplate))
+	}
+	if c.Fingerprint != "" {
+		opts = append(opts, WithFingerprint(c.Fingerprint == "hash"))
+	}
+	for _, name := range c.SQLSanitizers {
+		opts = append(opts, WithSQLSanitizer(_sqlSanitizerNames[name]))
+	}
+	if len(c.MaskColumns) > 0 {
+		opts = append(opts, WithMaskColumns(c.MaskColumns...))
+	}
+	if len(c.ExcludeOperations) > 0 {
+		opts = append(opts, WithExcludeOperations(c.ExcludeOperations...))
+	}
+	if len(c.ExcludeTables) > 0 {
+		opts = append(opts, WithExcludeTables(c.ExcludeTables...))
+	}
+	if c.RedactParams {
+		opts = append(opts, WithRedactParams())
+	}
+	if c.MaxSQLLength > 0 {
+		opts = append(opts, WithMaxSQLLength(c.MaxSQLLength))
+	}
+	if c.MaxLogFields > 0 {
+		opts = append(opts, WithMaxLogFields(c.MaxLogFields))
+	}
+	if c.MaxLogBytes > 0 {
+		opts = append(opts, WithMaxLogBytes(c.MaxLogBytes))
+	}
+	if len(c.SQLFields) > 0 {
+		var fields []SQLField
+		for _, name := range c.SQLFields {
+			fields = append(fields, _sqlFieldNames[name])
+		}
+		opts = append(opts, WithSQLFields(fields...))
+	}
+	if c.SQLRecordMode != "" {
+		opts = append(opts, WithSQLRecordMode(SQLRecordMode(c.SQLRecordMode)))
+	}
+	if c.SemanticConventions {
+		opts = append(opts, WithSemanticConventions())
+	}
+	if c.ValidateEndpoint {
+		opts = append(opts, WithValidateEndpoint())
+	}
+	if c.TraceID128Bit {
+		opts = append(opts, WithGen128Bit())
+	}
+	if c.ProcessTags {
+		opts = append(opts, WithProcessTags(c.Version))
+	}
+	return opts, nil
+}
+
+// 通过配置文件创建插件，便于运维在代码之外管理追踪配置，配置有误时返回错误，opts 的优先级高于配置文件
+func NewFromConfigFile(path string, opts ...Option) (*IstioGormTracing, error) {
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfgOpts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+	return New(append(cfgOpts, opts...)...)
+}
@@ -0,0 +1,79 @@
+package istiogormtracing
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	yamlPath := writeConfig(t, "tracing.yaml", `
+service_name: istio-gorm-tracing-test
+collector_endpoint: http://jaeger-collector:14268/api/traces
+sampler:
+  type: probabilistic
+  param: 0.1
+reporter:
+  queue_size: 500
+propagation: [w3c, b3]
+tags:
+  env: prod
+`)
+	jsonPath := writeConfig(t, "tracing.json", `{
+  "service_name": "istio-gorm-tracing-test",
+  "collector_endpoint": "http://jaeger-collector:14268/api/traces",
+  "sampler": {"type": "probabilistic", "param": 0.1},
+  "reporter": {"queue_size": 500},
+  "propagation": ["w3c", "b3"],
+  "tags": {"env": "prod"}
+}`)
+	for _, path := range []string{yamlPath, jsonPath} {
+		cfg, err := LoadConfigFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if cfg.ServiceName != "istio-gorm-tracing-test" || cfg.Sampler.Param != 0.1 || cfg.Reporter.QueueSize != 500 ||
+			len(cfg.Propagation) != 2 || cfg.Tags["env"] != "prod" {
+			t.Errorf("%s: config = %+v", path, cfg)
+		}
+	}
+
+	i, err := NewFromConfigFile(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	if i.sampler.Type != "probabilistic" || i.reporterQueueSize != 500 || len(i.tags) != 1 {
+		t.Errorf("plugin = %+v", i)
+	}
+	if names := i.getPropagator().(*CompositePropagator).names; strings.Join(names, ",") != "w3c,b3" {
+		t.Errorf("propagation = %v", names)
+	}
+}
+
+func TestLoadConfigFileInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":  "service_nmae: test",
+		"bad sampler":    "sampler: {type: always}",
+		"bad param":      "sampler: {type: probabilistic, param: 2}",
+		"bad endpoint":   "collector_endpoint: jaeger-collector:14268",
+		"bad format":     "propagation: [b4]",
+		"negative queue": "reporter: {queue_size: -1}",
+		"bad interval":   "reporter: {flush_interval: 1}",
+	}
+	for name, content := range tests {
+		if _, err := LoadConfigFile(writeConfig(t, "tracing.yml", content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package istiogormtracing
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"gorm.io/gorm"
+)
+
+// 执行 SQL 前等待连接池分配连接的耗时(毫秒)，连接池耗尽时 SQL 的耗时主要在这里
+const _tagConnWait = "db.conn_wait_ms"
+
+// 记录 SQL 执行前等待连接的耗时，通过 db.conn_wait_ms 区分连接池耗尽和 SQL 本身慢
+// 只记录直接在连接池上执行的 SQL，事务和预编译模式使用已有的连接，Row、Rows 的结果由调用方读取，都不记录
+func WithConnWaitTracing() Option {
+	return func(i *IstioGormTracing) {
+		i.connWait = true
+	}
+}
+
+// 包装 *sql.DB 的 gorm.ConnPool，每次执行 SQL 前先通过 sql.DB.Conn 获取连接并累计等待的耗时
+type connWaitPool struct {
+	db *sql.DB
+	// 累计的等待耗时(纳秒)和获取连接的次数，Create 等可能执行多条 SQL
+	wait     int64
+	acquired int64
+
+	mu sync.Mutex
+	// 查询使用的连接，gorm 读完 rows 后在预加载、保存关联或 SQL 结束时由 release 归还
+	conns    []*sql.Conn
+	released bool
+}
+
+// 获取连接并记录等待的耗时，已经归还过连接时返回 nil，直接使用连接池
+func (p *connWaitPool) acquire(ctx context.Context) (*sql.Conn, error) {
+	p.mu.Lock()
+	released := p.released
+	p.mu.Unlock()
+	if released {
+		return nil, nil
+	}
+	start := time.Now()
+	conn, err := p.db.Conn(ctx)
+	atomic.AddInt64(&p.wait, int64(time.Since(start)))
+	atomic.AddInt64(&p.acquired, 1)
+	return conn, err
+}
+
+// 记录查询使用的连接，SQL 结束后再归还
+func (p *connWaitPool) hold(conn *sql.Conn) {
+	p.mu.Lock()
+	p.conns = append(p.conns, conn)
+	p.mu.Unlock()
+}
+
+// 归还查询使用的连接，此时 rows 已经关闭，sql.Conn.Close 不会阻塞
+func (p *connWaitPool) release() {
+	p.mu.Lock()
+	conns := p.conns
+	p.conns, p.released = nil, true
+	p.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func (p *connWaitPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.db.PrepareContext(ctx, query)
+}
+
+func (p *connWaitPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if conn == nil {
+		return p.db.ExecContext(ctx, query, args...)
+	}
+	defer conn.Close()
+	return conn.ExecContext(ctx, query, args...)
+}
+
+func (p *connWaitPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if conn == nil {
+		return p.db.QueryContext(ctx, query, args...)
+	}
+	p.hold(conn)
+	return conn.QueryContext(ctx, query, args...)
+}
+
+func (p *connWaitPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	conn, err := p.acquire(ctx)
+	if err != nil || conn == nil {
+		// sql.Row 无法在外部构造，获取连接失败时交给连接池返回错误
+		return p.db.QueryRowContext(ctx, query, args...)
+	}
+	p.hold(conn)
+	return conn.QueryRowContext(ctx, query, args...)
+}
+
+// 会话中开启事务时仍使用 *sql.DB
+func (p *connWaitPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.db.BeginTx(ctx, opts)
+}
+
+// 实现 gorm.GetDBConnector，使 db.DB() 返回原来的 *sql.DB
+func (p *connWaitPool) GetDBConn() (*sql.DB, error) {
+	return p.db, nil
+}
+
+// 将 db.Statement.ConnPool 中的 *sql.DB 替换为 connWaitPool，会话复制了上一条 SQL 的 connWaitPool 时重新包装
+func (i *IstioGormTracing) wrapConnPool(db *gorm.DB) {
+	var sqlDB *sql.DB
+	switch pool := db.Statement.ConnPool.(type) {
+	case *sql.DB:
+		sqlDB = pool
+	case *connWaitPool:
+		sqlDB = pool.db
+	default:
+		return
+	}
+	db.Statement.ConnPool = &connWaitPool{db: sqlDB}
+}
+
+// 查询结束后归还连接，预加载和保存关联的 SQL 需要从连接池获取新的连接，连接数有限时持有连接会死锁
+func releaseConnPool(db *gorm.DB) {
+	if db.Statement == nil {
+		return
+	}
+	if pool, ok := db.Statement.ConnPool.(*connWaitPool); ok {
+		pool.release()
+	}
+}
+
+// 恢复 db.Statement.ConnPool 并归还查询使用的连接，获取过连接时记录等待的耗时
+func (i *IstioGormTracing) unwrapConnPool(span opentracing.Span, db *gorm.DB) {
+	pool, ok := db.Statement.ConnPool.(*connWaitPool)
+	if !ok {
+		return
+	}
+	db.Statement.ConnPool = pool.db
+	pool.release()
+	if atomic.LoadInt64(&pool.acquired) == 0 {
+		return
+	}
+	span.SetTag(_tagConnWait, float64(atomic.LoadInt64(&pool.wait))/float64(time.Millisecond))
+}
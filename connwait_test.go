@@ -0,0 +1,129 @@
+package istiogormtracing
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+)
+
+func TestWithConnWaitTracing(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithConnWaitTracing())); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	// 占用唯一的连接，查询需要等待连接归还
+	conn, err := sqlDB.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conn.Close()
+	}()
+	var list []map[string]interface{}
+	result := db.Table("users").Find(&list)
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	if _, ok := result.Statement.ConnPool.(*sql.DB); !ok {
+		t.Errorf("ConnPool = %T, want *sql.DB", result.Statement.ConnPool)
+	}
+	// SQL 结束时连接已经归还
+	if inUse := sqlDB.Stats().InUse; inUse != 0 {
+		t.Errorf("InUse = %d after query", inUse)
+	}
+	db.Table("users").Where("id = ?", 1).Updates(map[string]interface{}{"name": "a"})
+	db.Session(&gorm.Session{SkipDefaultTransaction: true}).Table("users").Create(map[string]interface{}{"id": 1})
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	if wait, _ := spans[0].Tag(_tagConnWait).(float64); wait < 40 {
+		t.Errorf("query: %s = %v", _tagConnWait, spans[0].Tag(_tagConnWait))
+	}
+	// 默认事务中的 SQL 使用事务的连接
+	if _, ok := spans[1].Tags()[_tagConnWait]; ok {
+		t.Error("update in transaction should not record conn wait")
+	}
+	if _, ok := spans[2].Tag(_tagConnWait).(float64); !ok {
+		t.Errorf("create: tags = %v", spans[2].Tags())
+	}
+}
+
+func TestConnWaitTracingDisabled(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	if _, ok := tracer.FinishedSpans()[0].Tags()[_tagConnWait]; ok {
+		t.Error("conn wait should not be recorded by default")
+	}
+}
+
+func TestConnWaitTracingSkipsRow(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithConnWaitTracing())); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Table("users").Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if _, ok := tracer.FinishedSpans()[0].Tags()[_tagConnWait]; ok {
+		t.Error("rows should not record conn wait")
+	}
+}
+
+func TestConnWaitTracingPreload(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithConnWaitTracing())); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	// 主查询的连接在预加载前归还，否则预加载等不到连接
+	done := make(chan error, 1)
+	go func() {
+		user := preloadUser{ID: 1}
+		done <- db.Preload("Orders").Find(&user).Error
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("preload blocked waiting for a connection")
+	}
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	for _, span := range spans {
+		if _, ok := span.Tag(_tagConnWait).(float64); !ok {
+			t.Errorf("tags = %v", span.Tags())
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package istiogormtracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+// 输出到控制台或文件的 span，每个 span 一行 json
+type spanRecord struct {
+	TraceID   string                 `json:"trace_id"`
+	SpanID    string                 `json:"span_id"`
+	ParentID  string                 `json:"parent_id,omitempty"`
+	Operation string                 `json:"operation"`
+	Table     string                 `json:"table,omitempty"`
+	SQL       string                 `json:"sql,omitempty"`
+	Start     time.Time              `json:"start"`
+	Duration  float64                `json:"duration_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Tags      map[string]interface{} `json:"tags,omitempty"`
+}
+
+func newSpanRecord(d *spanData) spanRecord {
+	record := spanRecord{
+		TraceID:   d.TraceID.String(),
+		SpanID:    d.SpanID.String(),
+		Operation: d.Operation,
+		Table:     d.table(),
+		SQL:       d.sql(),
+		Start:     d.Start,
+		Duration:  float64(d.Duration) / float64(time.Millisecond),
+		Error:     d.Fields["error.object"],
+		Tags:      d.Tags,
+	}
+	if d.ParentID != 0 {
+		record.ParentID = d.ParentID.String()
+	}
+	return record
+}
+
+// 将结束的 span 以 json 格式逐行输出到 w，w 为空时输出到标准输出，用于本地开发时不部署 jaeger 也能看到追踪信息
+func NewConsoleReporter(w io.Writer) jaeger.Reporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &consoleReporter{enc: json.NewEncoder(w)}
+}
+
+// 同步输出，不经过队列，只适合本地开发使用
+type consoleReporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (r *consoleReporter) Report(span *jaeger.Span) {
+	record := newSpanRecord(newSpanData(span))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.enc.Encode(record)
+}
+
+func (r *consoleReporter) Close() {}
@@ -0,0 +1,28 @@
+package istiogormtracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestConsoleReporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), NewConsoleReporter(&buf))
+	defer closer.Close()
+	span := tracer.StartSpan(_opQuery)
+	span.LogFields(opentracinglog.String("table", "users"), opentracinglog.String("sql", "SELECT * FROM `users`"))
+	span.Finish()
+
+	var record spanRecord
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("output = %s, err = %v", buf.String(), err)
+	}
+	if record.Operation != _opQuery || record.Table != "users" || record.SQL != "SELECT * FROM `users`" ||
+		record.TraceID != span.Context().(jaeger.SpanContext).TraceID().String() {
+		t.Errorf("record = %+v", record)
+	}
+}
@@ -0,0 +1,91 @@
+package istiogormtracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// context 中保存 header 使用的 key 类型，避免与其他包冲突
+type headerCtxKey struct{}
+
+// 将 Istio 传递过来的 header 信息保存到 context 中，每个请求使用自己的 header，互不干扰
+// 使用方式: db.WithContext(istiogormtracing.WithHeaders(ctx, r.Header))
+func WithHeaders(ctx context.Context, header http.Header) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, headerCtxKey{}, header)
+}
+
+// 消息队列的消费者使用，将消息头中携带的追踪信息放入 context 中，消息头需要实现 opentracing.TextMapReader
+// 使用方式: db.WithContext(istiogormtracing.FromCarrier(ctx, opentracing.TextMapCarrier(msgHeaders)))
+func FromCarrier(ctx context.Context, carrier opentracing.TextMapReader) context.Context {
+	h := http.Header{}
+	if carrier != nil {
+		_ = carrier.ForeachKey(func(key, val string) error {
+			h.Add(key, val)
+			return nil
+		})
+	}
+	return WithHeaders(ctx, h)
+}
+
+// 从 context 中取出 header 信息，如果没有，则兼容旧的全局变量 H
+func headersFromContext(ctx context.Context) http.Header {
+	if ctx != nil {
+		if h, ok := ctx.Value(headerCtxKey{}).(http.Header); ok && h != nil {
+			return h
+		}
+	}
+	return H
+}
+
+// Istio 要求应用自行转发的 header，见 https://istio.io/latest/docs/tasks/observability/distributed-tracing/overview/
+var _forwardHeaders = []string{
+	_headerRequestID,
+	"x-b3-traceid",
+	"x-b3-spanid",
+	"x-b3-parentspanid",
+	"x-b3-sampled",
+	"x-b3-flags",
+	_headerB3Single,
+	_headerTraceparent,
+	_headerTracestate,
+	_headerBaggage,
+	"x-ot-span-context",
+	"x-cloud-trace-context",
+	"grpc-trace-bin",
+}
+
+// 返回调用下游服务时需要携带的追踪 header，将其复制到发出的 http 请求中即可串联整条调用链
+// context 中有 span 时以该 span 为父 span 生成 B3 和 W3C header，否则原样转发 WithHeaders 保存的 header
+func PropagationHeaders(ctx context.Context) http.Header {
+	out := http.Header{}
+	in := headersFromContext(ctx)
+	if in != nil {
+		for _, k := range _forwardHeaders {
+			if vs := in.Values(k); len(vs) > 0 {
+				out[http.CanonicalHeaderKey(k)] = append([]string(nil), vs...)
+			}
+		}
+	}
+
+	if ctx == nil {
+		return out
+	}
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return out
+	}
+
+	// 使用当前 span 的信息替换掉上游传过来的追踪 header，x-request-id 和 baggage 保持不变
+	for _, k := range _forwardHeaders[1:] {
+		if k != _headerBaggage {
+			out.Del(k)
+		}
+	}
+	_ = Inject(span, opentracing.HTTPHeadersCarrier(out))
+	return out
+}
@@ -0,0 +1,117 @@
+package istiogormtracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+func b3Header(traceID, spanID string) http.Header {
+	h := http.Header{}
+	h.Set("x-b3-traceid", traceID)
+	h.Set("x-b3-spanid", spanID)
+	h.Set("x-b3-sampled", "1")
+	return h
+}
+
+func TestWithHeadersIsolatesConcurrentRequests(t *testing.T) {
+	ctxA := WithHeaders(context.Background(), b3Header("463ac35c9f6413ad48485a3953bb6124", "a2fb4a1d1a96d312"))
+	ctxB := WithHeaders(context.Background(), b3Header("0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"))
+
+	spanCtxA, err := defaultPropagator.Extract(opentracing.HTTPHeadersCarrier(headersFromContext(ctxA)))
+	if err != nil {
+		t.Fatalf("extract A: %v", err)
+	}
+	spanCtxB, err := defaultPropagator.Extract(opentracing.HTTPHeadersCarrier(headersFromContext(ctxB)))
+	if err != nil {
+		t.Fatalf("extract B: %v", err)
+	}
+
+	if got := spanCtxA.TraceID().String(); got != "463ac35c9f6413ad48485a3953bb6124" {
+		t.Errorf("trace id A = %s", got)
+	}
+	if got := spanCtxB.TraceID().String(); got != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("trace id B = %s", got)
+	}
+}
+
+func TestHeadersFromContextFallsBackToGlobal(t *testing.T) {
+	old := H
+	defer func() { H = old }()
+
+	H = b3Header("463ac35c9f6413ad48485a3953bb6124", "a2fb4a1d1a96d312")
+
+	spanCtx, err := defaultPropagator.Extract(opentracing.HTTPHeadersCarrier(headersFromContext(context.Background())))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if got := spanCtx.TraceID().String(); got != "463ac35c9f6413ad48485a3953bb6124" {
+		t.Errorf("trace id = %s", got)
+	}
+
+	// context 中有 header 时优先使用 context 中的
+	ctx := WithHeaders(context.Background(), b3Header("0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"))
+	spanCtx, err = defaultPropagator.Extract(opentracing.HTTPHeadersCarrier(headersFromContext(ctx)))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if got := spanCtx.TraceID().String(); got != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("trace id = %s", got)
+	}
+}
+
+func TestPropagationHeaders(t *testing.T) {
+	in := b3Header("463ac35c9f6413ad48485a3953bb6124", "a2fb4a1d1a96d312")
+	in.Set("x-request-id", "req-1")
+	in.Set("authorization", "secret")
+	ctx := WithHeaders(context.Background(), in)
+
+	// context 中没有 span 时原样转发
+	out := PropagationHeaders(ctx)
+	if out.Get("x-b3-traceid") != "463ac35c9f6413ad48485a3953bb6124" || out.Get("x-request-id") != "req-1" {
+		t.Errorf("headers = %v", out)
+	}
+	if out.Get("authorization") != "" {
+		t.Error("non tracing headers must not be forwarded")
+	}
+
+	// context 中有 span 时使用该 span 生成 header
+	traceID, _ := jaeger.TraceIDFromString("0af7651916cd43dd8448eb211c80319c")
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+	span := tracer.StartSpan("http", opentracing.ChildOf(jaeger.NewSpanContext(traceID, 1, 0, true, nil)))
+	defer span.Finish()
+
+	out = PropagationHeaders(opentracing.ContextWithSpan(ctx, span))
+	spanID := span.Context().(jaeger.SpanContext).SpanID().String()
+	if out.Get("x-b3-traceid") != "0af7651916cd43dd8448eb211c80319c" || out.Get("x-b3-spanid") != spanID {
+		t.Errorf("b3 headers = %v", out)
+	}
+	if want := "00-0af7651916cd43dd8448eb211c80319c-" + spanID + "-01"; out.Get("traceparent") != want {
+		t.Errorf("traceparent = %s, want %s", out.Get("traceparent"), want)
+	}
+	if out.Get("x-request-id") != "req-1" {
+		t.Errorf("x-request-id = %s", out.Get("x-request-id"))
+	}
+}
+
+func TestFromCarrier(t *testing.T) {
+	// kafka 等消息头的 key 通常是小写的
+	carrier := opentracing.TextMapCarrier{
+		"x-b3-traceid": "463ac35c9f6413ad48485a3953bb6124",
+		"x-b3-spanid":  "a2fb4a1d1a96d312",
+		"x-b3-sampled": "1",
+	}
+	ctx := FromCarrier(context.Background(), carrier)
+
+	spanCtx, err := defaultPropagator.Extract(opentracing.HTTPHeadersCarrier(headersFromContext(ctx)))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if got := spanCtx.TraceID().String(); got != "463ac35c9f6413ad48485a3953bb6124" {
+		t.Errorf("trace id = %s", got)
+	}
+}
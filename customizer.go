@@ -0,0 +1,23 @@
+package istiogormtracing
+
+import (
+	"github.com/opentracing/opentracing-go"
+	"gorm.io/gorm"
+)
+
+// 在 span 结束前调用，可以记录业务相关的 tag，如用户 id、功能开关、请求优先级
+type SpanCustomizer func(span opentracing.Span, db *gorm.DB)
+
+// 添加 span 结束前调用的方法，多次调用时按添加的顺序执行
+// 如: WithSpanCustomizer(func(span opentracing.Span, db *gorm.DB) { span.SetTag("user.id", auth.UserID(db.Statement.Context)) })
+func WithSpanCustomizer(customizers ...SpanCustomizer) Option {
+	return func(i *IstioGormTracing) {
+		i.spanCustomizers = append(i.spanCustomizers, customizers...)
+	}
+}
+
+func (i *IstioGormTracing) customizeSpan(span opentracing.Span, db *gorm.DB) {
+	for _, customize := range i.spanCustomizers {
+		customize(span, db)
+	}
+}
@@ -0,0 +1,37 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+)
+
+func TestWithSpanCustomizer(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	var order []string
+	first := func(span opentracing.Span, db *gorm.DB) {
+		order = append(order, "first")
+		// 插件记录的信息此时已经完整
+		span.SetTag("test.table", db.Statement.Table)
+		span.SetTag("test.rows", span.(*mocktracer.MockSpan).Tag(_tagRowsReturned))
+	}
+	second := func(span opentracing.Span, db *gorm.DB) {
+		order = append(order, "second")
+	}
+	if err := db.Use(NewWithTracer(tracer, WithSpanCustomizer(first), WithSpanCustomizer(second), WithSemanticConventions())); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+
+	span := tracer.FinishedSpans()[0]
+	if span.Tag("test.table") != "users" || span.Tag("test.rows") != int64(0) {
+		t.Errorf("tags = %v", span.Tags())
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("order = %v", order)
+	}
+}
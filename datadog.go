@@ -0,0 +1,94 @@
+package istiogormtracing
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	// Datadog 使用的 header，trace id 和 span id 都是十进制的 64 位整数
+	_headerDatadogTraceID          = "x-datadog-trace-id"
+	_headerDatadogParentID         = "x-datadog-parent-id"
+	_headerDatadogSamplingPriority = "x-datadog-sampling-priority"
+	// 128 位 trace id 的高 64 位以十六进制保存在 x-datadog-tags 的 _dd.p.tid 中
+	_headerDatadogTags = "x-datadog-tags"
+	_datadogTagTraceID = "_dd.p.tid"
+)
+
+// Datadog 格式: x-datadog-trace-id、x-datadog-parent-id、x-datadog-sampling-priority
+// 默认不会尝试此格式，需要时通过 WithPropagator 或 NewCompositePropagator(..., FormatDatadog) 启用
+func DatadogPropagator() Propagator {
+	return datadogPropagator{}
+}
+
+type datadogPropagator struct{}
+
+func (datadogPropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	h, err := carrierToHeader(carrier)
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+	return extractDatadog(h)
+}
+
+func (datadogPropagator) Inject(spanCtx jaeger.SpanContext, carrier interface{}) error {
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	traceID := spanCtx.TraceID()
+	w.Set(_headerDatadogTraceID, strconv.FormatUint(traceID.Low, 10))
+	w.Set(_headerDatadogParentID, strconv.FormatUint(uint64(spanCtx.SpanID()), 10))
+	if spanCtx.IsSampled() {
+		w.Set(_headerDatadogSamplingPriority, "1")
+	} else {
+		w.Set(_headerDatadogSamplingPriority, "0")
+	}
+	if traceID.High != 0 {
+		w.Set(_headerDatadogTags, fmt.Sprintf("%s=%016x", _datadogTagTraceID, traceID.High))
+	}
+	return nil
+}
+
+// 按 Datadog 格式解析，采样优先级大于 0 表示采样，没有采样优先级时交给本地的采样器决定
+func extractDatadog(h http.Header) (jaeger.SpanContext, error) {
+	rawTraceID := strings.TrimSpace(h.Get(_headerDatadogTraceID))
+	rawParentID := strings.TrimSpace(h.Get(_headerDatadogParentID))
+	if rawTraceID == "" && rawParentID == "" {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	low, err := strconv.ParseUint(rawTraceID, 10, 64)
+	if err != nil || low == 0 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	spanID, err := strconv.ParseUint(rawParentID, 10, 64)
+	if err != nil || spanID == 0 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	traceID := jaeger.TraceID{Low: low}
+	for _, tag := range strings.Split(h.Get(_headerDatadogTags), ",") {
+		kv := strings.SplitN(strings.TrimSpace(tag), "=", 2)
+		if len(kv) == 2 && kv[0] == _datadogTagTraceID && len(kv[1]) == 16 {
+			if high, err := strconv.ParseUint(kv[1], 16, 64); err == nil {
+				traceID.High = high
+			}
+		}
+	}
+
+	var sampled bool
+	if priority := strings.TrimSpace(h.Get(_headerDatadogSamplingPriority)); priority != "" {
+		p, err := strconv.Atoi(priority)
+		if err != nil {
+			return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+		}
+		sampled = p > 0
+	}
+
+	return jaeger.NewSpanContext(traceID, jaeger.SpanID(spanID), 0, sampled, nil), nil
+}
@@ -0,0 +1,86 @@
+package istiogormtracing
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+// datadog agent 接收 json 格式的接口，每个元素为同一条链路的 span 列表
+const _datadogTracesPath = "/v0.3/traces"
+
+// datadog APM 的 span 格式
+type datadogSpan struct {
+	TraceID  uint64            `json:"trace_id"`
+	SpanID   uint64            `json:"span_id"`
+	ParentID uint64            `json:"parent_id"`
+	Name     string            `json:"name"`
+	Resource string            `json:"resource"`
+	Service  string            `json:"service"`
+	Type     string            `json:"type"`
+	Start    int64             `json:"start"`
+	Duration int64             `json:"duration"`
+	Error    int32             `json:"error"`
+	Meta     map[string]string `json:"meta,omitempty"`
+}
+
+// 上报到 datadog agent，不需要部署 jaeger，agentURL 如 http://localhost:8126
+// span 的 resource 为使用占位符的 SQL，相同语句的不同参数会归为同一个 resource
+func NewDatadogReporter(serviceName, agentURL string) jaeger.Reporter {
+	client := newReporterClient()
+	url := strings.TrimSuffix(agentURL, "/") + _datadogTracesPath
+	header := http.Header{}
+	header.Set("Datadog-Meta-Lang", "go")
+	return newBatchReporter(func(spans []*spanData) error {
+		return sendJSON(client, http.MethodPut, url, header, toDatadogTraces(serviceName, spans))
+	}, nil)
+}
+
+// 按 trace id 分组，datadog 只支持 64 位的 trace id，取低 64 位
+func toDatadogTraces(serviceName string, spans []*spanData) [][]datadogSpan {
+	var traces [][]datadogSpan
+	index := map[uint64]int{}
+	for _, d := range spans {
+		span := datadogSpan{
+			TraceID:  d.TraceID.Low,
+			SpanID:   uint64(d.SpanID),
+			ParentID: uint64(d.ParentID),
+			Name:     "gorm." + d.Operation,
+			Resource: normalizeSQL(d.query()),
+			Service:  serviceName,
+			Type:     "sql",
+			Start:    d.Start.UnixNano(),
+			Duration: d.Duration.Nanoseconds(),
+			Meta:     map[string]string{},
+		}
+		if span.Resource == "" {
+			span.Resource = d.Operation
+		}
+		for k, v := range d.Tags {
+			span.Meta[k] = fmt.Sprint(v)
+		}
+		for k, v := range d.Fields {
+			span.Meta[k] = v
+		}
+		if d.isError() {
+			span.Error = 1
+			span.Meta["error.msg"] = d.Fields["error.object"]
+		}
+
+		idx, ok := index[span.TraceID]
+		if !ok {
+			idx = len(traces)
+			index[span.TraceID] = idx
+			traces = append(traces, nil)
+		}
+		traces[idx] = append(traces[idx], span)
+	}
+	return traces
+}
+
+// 合并 SQL 中的空白字符，避免格式不同的相同语句被当作不同的 resource
+func normalizeSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
@@ -0,0 +1,45 @@
+package istiogormtracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestDatadogReporter(t *testing.T) {
+	var got [][]datadogSpan
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/v0.3/traces" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), NewDatadogReporter("istio-gorm-tracing-test", server.URL))
+	span := tracer.StartSpan(_opQuery)
+	span.LogFields(opentracinglog.String("query", "SELECT *\n  FROM users WHERE id = ?"), opentracinglog.String("table", "users"))
+	span.Finish()
+	closer.Close()
+
+	if len(got) != 1 || len(got[0]) != 1 {
+		t.Fatalf("traces = %v", got)
+	}
+	d := got[0][0]
+	spanCtx := span.Context().(jaeger.SpanContext)
+	if d.TraceID != spanCtx.TraceID().Low || d.SpanID != uint64(spanCtx.SpanID()) {
+		t.Errorf("ids = %d/%d", d.TraceID, d.SpanID)
+	}
+	if d.Resource != "SELECT * FROM users WHERE id = ?" || d.Type != "sql" || d.Service != "istio-gorm-tracing-test" || d.Name != "gorm.query" {
+		t.Errorf("span = %+v", d)
+	}
+	if d.Meta["table"] != "users" || d.Error != 0 {
+		t.Errorf("meta = %v, error = %d", d.Meta, d.Error)
+	}
+}
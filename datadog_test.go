@@ -0,0 +1,75 @@
+package istiogormtracing
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestExtractDatadog(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		err     error
+		traceID string
+		spanID  string
+		sampled bool
+	}{
+		{name: "missing", headers: map[string]string{}, err: opentracing.ErrSpanContextNotFound},
+		{
+			name:    "sampled",
+			headers: map[string]string{"x-datadog-trace-id": "1234", "x-datadog-parent-id": "5678", "x-datadog-sampling-priority": "2"},
+			traceID: "00000000000004d2", spanID: "000000000000162e", sampled: true,
+		},
+		{
+			name:    "dropped",
+			headers: map[string]string{"x-datadog-trace-id": "1234", "x-datadog-parent-id": "5678", "x-datadog-sampling-priority": "-1"},
+			traceID: "00000000000004d2", spanID: "000000000000162e",
+		},
+		{
+			name:    "128 bit",
+			headers: map[string]string{"x-datadog-trace-id": "1234", "x-datadog-parent-id": "5678", "x-datadog-tags": "_dd.p.dm=-1,_dd.p.tid=640cfd8d00000000"},
+			traceID: "640cfd8d0000000000000000000004d2", spanID: "000000000000162e",
+		},
+		{name: "hex trace id", headers: map[string]string{"x-datadog-trace-id": "4d2", "x-datadog-parent-id": "5678"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "missing parent", headers: map[string]string{"x-datadog-trace-id": "1234"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "zero trace id", headers: map[string]string{"x-datadog-trace-id": "0", "x-datadog-parent-id": "5678"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "bad priority", headers: map[string]string{"x-datadog-trace-id": "1234", "x-datadog-parent-id": "5678", "x-datadog-sampling-priority": "yes"}, err: opentracing.ErrSpanContextCorrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			spanCtx, err := extractDatadog(h)
+			if err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if spanCtx.TraceID().String() != tt.traceID || spanCtx.SpanID().String() != tt.spanID || spanCtx.IsSampled() != tt.sampled {
+				t.Errorf("span context = %s", spanCtx)
+			}
+		})
+	}
+}
+
+func TestDatadogRoundTrip(t *testing.T) {
+	traceID := jaeger.TraceID{High: 0x640cfd8d00000000, Low: 1234}
+	spanCtx := jaeger.NewSpanContext(traceID, 5678, 0, true, nil)
+	h := http.Header{}
+	if err := DatadogPropagator().Inject(spanCtx, opentracing.HTTPHeadersCarrier(h)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DatadogPropagator().Extract(opentracing.HTTPHeadersCarrier(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TraceID() != traceID || got.SpanID() != 5678 || !got.IsSampled() {
+		t.Errorf("round trip = %s, headers = %v", got, h)
+	}
+}
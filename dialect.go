@@ -0,0 +1,30 @@
+package istiogormtracing
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// gorm 官方 dialector 的名称与 OpenTelemetry db.system 取值不同的部分
+var _dbSystems = map[string]string{
+	"postgres":  "postgresql",
+	"sqlserver": "mssql",
+}
+
+// 根据 db.Dialector.Name() 得到数据库类型，如 mysql、postgresql、sqlite、mssql、clickhouse
+func dbSystem(dialector string) string {
+	name := strings.ToLower(dialector)
+	if system, ok := _dbSystems[name]; ok {
+		return system
+	}
+	return name
+}
+
+// 没有 dialector 时为空
+func dbSystemOf(db *gorm.DB) string {
+	if db.Dialector == nil {
+		return ""
+	}
+	return dbSystem(db.Dialector.Name())
+}
@@ -0,0 +1,33 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestDBSystem(t *testing.T) {
+	for dialector, want := range map[string]string{
+		"mysql":      "mysql",
+		"postgres":   "postgresql",
+		"sqlite":     "sqlite",
+		"sqlserver":  "mssql",
+		"clickhouse": "clickhouse",
+	} {
+		if got := dbSystem(dialector); got != want {
+			t.Errorf("%s: db.system = %s, want %s", dialector, got, want)
+		}
+	}
+
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	span := tracer.FinishedSpans()[0]
+	if span.Tag(_tagDBSystem) != "fake" || span.Tag(_tagDBType) != "sql" {
+		t.Errorf("tags = %v", span.Tags())
+	}
+}
@@ -0,0 +1,19 @@
+// Echo 框架使用的中间件，与 istiogormtracing.Middleware 作用相同
+package echotracing
+
+import (
+	"github.com/labstack/echo/v4"
+	istiogormtracing "github.com/liamhao/istio-gorm-tracing"
+)
+
+// 将每个请求的追踪 header 放入请求的 context 中
+// handler 中使用 db.WithContext(c.Request().Context()) 即可与上下游服务做关联
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			c.SetRequest(r.WithContext(istiogormtracing.WithHeaders(r.Context(), r.Header)))
+			return next(c)
+		}
+	}
+}
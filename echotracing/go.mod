@@ -0,0 +1,9 @@
+module github.com/liamhao/istio-gorm-tracing/echotracing
+
+go 1.16
+
+require (
+	github.com/labstack/echo/v4 v4.7.2
+	github.com/liamhao/istio-gorm-tracing v0.0.0-20261016074853-841c9bfd9ff4
+	gorm.io/gorm v1.23.6
+)
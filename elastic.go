@@ -0,0 +1,161 @@
+package istiogormtracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+// elastic APM server 接收数据的接口，内容为 ndjson，第一行为 metadata
+const _elasticIntakePath = "/intake/v2/events"
+
+// 上报到 elastic APM server 的配置，可以通过 ElasticConfigFromEnv 从标准的 ELASTIC_APM_* 环境变量中读取
+type ElasticConfig struct {
+	// APM server 的地址，默认为 http://localhost:8200
+	ServerURL   string
+	ServiceName string
+	Environment string
+	// 认证信息，二选一
+	SecretToken string
+	APIKey      string
+}
+
+// 从 ELASTIC_APM_SERVER_URL、ELASTIC_APM_SERVICE_NAME、ELASTIC_APM_ENVIRONMENT、ELASTIC_APM_SECRET_TOKEN、ELASTIC_APM_API_KEY 中读取配置
+func ElasticConfigFromEnv() ElasticConfig {
+	return ElasticConfig{
+		ServerURL:   os.Getenv("ELASTIC_APM_SERVER_URL"),
+		ServiceName: os.Getenv("ELASTIC_APM_SERVICE_NAME"),
+		Environment: os.Getenv("ELASTIC_APM_ENVIRONMENT"),
+		SecretToken: os.Getenv("ELASTIC_APM_SECRET_TOKEN"),
+		APIKey:      os.Getenv("ELASTIC_APM_API_KEY"),
+	}
+}
+
+type elasticMetadata struct {
+	Service elasticService `json:"service"`
+}
+
+type elasticService struct {
+	Name        string       `json:"name"`
+	Environment string       `json:"environment,omitempty"`
+	Agent       elasticAgent `json:"agent"`
+}
+
+type elasticAgent struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// 有父 span 时上报为 span，没有时上报为 transaction，elastic 的 span 必须有 parent_id
+type elasticEvent struct {
+	ID        string          `json:"id"`
+	TraceID   string          `json:"trace_id"`
+	ParentID  string          `json:"parent_id,omitempty"`
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Subtype   string          `json:"subtype,omitempty"`
+	Action    string          `json:"action,omitempty"`
+	Timestamp int64           `json:"timestamp"`
+	Duration  float64         `json:"duration"`
+	Outcome   string          `json:"outcome"`
+	Context   *elasticContext `json:"context,omitempty"`
+	SpanCount *elasticCount   `json:"span_count,omitempty"`
+}
+
+type elasticContext struct {
+	DB   *elasticDB        `json:"db,omitempty"`
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+type elasticDB struct {
+	Statement string `json:"statement,omitempty"`
+	Type      string `json:"type"`
+}
+
+type elasticCount struct {
+	Started int `json:"started"`
+}
+
+// 将 gorm 的操作上报为 elastic 的 db span，SQL 记录在 context.db.statement 中
+func NewElasticReporter(cfg ElasticConfig) jaeger.Reporter {
+	serverURL := cfg.ServerURL
+	if serverURL == "" {
+		serverURL = "http://localhost:8200"
+	}
+	url := strings.TrimSuffix(serverURL, "/") + _elasticIntakePath
+	header := http.Header{}
+	switch {
+	case cfg.APIKey != "":
+		header.Set("Authorization", "ApiKey "+cfg.APIKey)
+	case cfg.SecretToken != "":
+		header.Set("Authorization", "Bearer "+cfg.SecretToken)
+	}
+	metadata := elasticMetadata{Service: elasticService{
+		Name:        cfg.ServiceName,
+		Environment: cfg.Environment,
+		Agent:       elasticAgent{Name: "istio-gorm-tracing", Version: jaeger.JaegerClientVersion},
+	}}
+	client := newReporterClient()
+
+	return newBatchReporter(func(spans []*spanData) error {
+		body, err := encodeElasticEvents(metadata, spans)
+		if err != nil {
+			return err
+		}
+		return send(client, http.MethodPost, url, header, "application/x-ndjson", body)
+	}, nil)
+}
+
+func encodeElasticEvents(metadata elasticMetadata, spans []*spanData) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(map[string]interface{}{"metadata": metadata}); err != nil {
+		return nil, err
+	}
+	for _, d := range spans {
+		event := elasticEvent{
+			ID:        d.SpanID.String(),
+			TraceID:   fmt.Sprintf("%016x%016x", d.TraceID.High, d.TraceID.Low),
+			Name:      d.Operation,
+			Type:      "db",
+			Timestamp: d.Start.UnixNano() / int64(time.Microsecond),
+			Duration:  float64(d.Duration) / float64(time.Millisecond),
+			Outcome:   "success",
+		}
+		if d.isError() {
+			event.Outcome = "failure"
+		}
+		tags := map[string]string{}
+		for k, v := range d.Tags {
+			tags[k] = fmt.Sprint(v)
+		}
+		if table := d.table(); table != "" {
+			tags["table"] = table
+		}
+
+		kind := "span"
+		if d.ParentID == 0 {
+			kind = "transaction"
+			event.SpanCount = &elasticCount{}
+			event.Context = &elasticContext{Tags: tags}
+		} else {
+			event.ParentID = d.ParentID.String()
+			event.Subtype, _ = d.Tags["db.type"].(string)
+			event.Action = d.Operation
+			event.Context = &elasticContext{
+				DB:   &elasticDB{Statement: d.sql(), Type: "sql"},
+				Tags: tags,
+			}
+		}
+		if err := enc.Encode(map[string]interface{}{kind: event}); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,66 @@
+package istiogormtracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestElasticReporter(t *testing.T) {
+	var lines []map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/intake/v2/events" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("request = %s %v", r.URL.Path, r.Header)
+		}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var line map[string]json.RawMessage
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Error(err)
+			}
+			lines = append(lines, line)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	os.Setenv("ELASTIC_APM_SERVER_URL", server.URL)
+	os.Setenv("ELASTIC_APM_SECRET_TOKEN", "secret")
+	os.Setenv("ELASTIC_APM_SERVICE_NAME", "istio-gorm-tracing-test")
+	defer os.Unsetenv("ELASTIC_APM_SERVER_URL")
+	defer os.Unsetenv("ELASTIC_APM_SECRET_TOKEN")
+	defer os.Unsetenv("ELASTIC_APM_SERVICE_NAME")
+
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), NewElasticReporter(ElasticConfigFromEnv()))
+	parent := tracer.StartSpan("http")
+	span := tracer.StartSpan(_opQuery, opentracing.ChildOf(parent.Context()))
+	span.LogFields(opentracinglog.String("sql", "SELECT * FROM users WHERE id = 1"))
+	span.Finish()
+	closer.Close()
+
+	if len(lines) != 2 {
+		t.Fatalf("lines = %d, want metadata and span", len(lines))
+	}
+	var metadata elasticMetadata
+	if err := json.Unmarshal(lines[0]["metadata"], &metadata); err != nil || metadata.Service.Name != "istio-gorm-tracing-test" {
+		t.Errorf("metadata = %s", lines[0]["metadata"])
+	}
+	var event elasticEvent
+	if err := json.Unmarshal(lines[1]["span"], &event); err != nil {
+		t.Fatalf("span = %s", lines[1]["span"])
+	}
+	spanCtx := span.Context().(jaeger.SpanContext)
+	if event.ID != spanCtx.SpanID().String() || event.ParentID != spanCtx.ParentID().String() || event.Type != "db" {
+		t.Errorf("event = %+v", event)
+	}
+	if event.Context == nil || event.Context.DB == nil || event.Context.DB.Statement != "SELECT * FROM users WHERE id = 1" {
+		t.Errorf("context = %+v", event.Context)
+	}
+}
@@ -0,0 +1,168 @@
+package istiogormtracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"gorm.io/gorm"
+)
+
+// 错误分类记录在 error.kind 中，无法识别的错误不记录
+const _tagErrorKind = "error.kind"
+
+// 错误的分类
+const (
+	// 违反唯一键、外键、非空等约束
+	ErrorKindConstraint = "constraint_violation"
+	// 死锁
+	ErrorKindDeadlock = "deadlock"
+	// 超时，包括 context 超时、锁等待超时和查询被取消
+	ErrorKindTimeout = "timeout"
+	// 连接错误，如连接被拒绝、连接断开、连接数过多
+	ErrorKindConnection = "connection"
+)
+
+// 按数据库返回的错误码分类，mysql 和 sqlserver 为错误编号，postgres 为 SQLSTATE(见 sqlStateErrorKind)
+var (
+	_mysqlErrorKinds = map[int64]string{
+		1062: ErrorKindConstraint, 1048: ErrorKindConstraint, 1451: ErrorKindConstraint, 1452: ErrorKindConstraint, 3819: ErrorKindConstraint,
+		1213: ErrorKindDeadlock,
+		1205: ErrorKindTimeout, 3024: ErrorKindTimeout,
+		1040: ErrorKindConnection, 1053: ErrorKindConnection, 2002: ErrorKindConnection, 2003: ErrorKindConnection, 2006: ErrorKindConnection, 2013: ErrorKindConnection,
+	}
+	_sqlserverErrorKinds = map[int64]string{
+		2627: ErrorKindConstraint, 2601: ErrorKindConstraint, 547: ErrorKindConstraint, 515: ErrorKindConstraint,
+		1205: ErrorKindDeadlock,
+		1222: ErrorKindTimeout,
+	}
+	_sqlStateErrorKinds = map[string]string{
+		"40P01": ErrorKindDeadlock,
+		"57014": ErrorKindTimeout, "55P03": ErrorKindTimeout,
+		"53300": ErrorKindConnection,
+	}
+	// 没有错误码时按错误信息分类
+	_errorMessageKinds = []struct {
+		substr, kind string
+	}{
+		{"deadlock", ErrorKindDeadlock},
+		{"constraint failed", ErrorKindConstraint},
+		{"duplicate key", ErrorKindConstraint},
+		{"duplicate entry", ErrorKindConstraint},
+		{"violates", ErrorKindConstraint},
+		{"timeout", ErrorKindTimeout},
+		{"timed out", ErrorKindTimeout},
+		{"connection refused", ErrorKindConnection},
+		{"connection reset", ErrorKindConnection},
+		{"broken pipe", ErrorKindConnection},
+		{"bad connection", ErrorKindConnection},
+		{"too many connections", ErrorKindConnection},
+	}
+)
+
+// 设置判断是否记录为错误的方法，返回 false 时不将 span 标记为出错
+// 默认不记录 gorm.ErrRecordNotFound，First 等方法查不到数据通常是正常的业务流程；传入 nil 时记录所有错误
+func WithErrorFilter(filter func(err error) bool) Option {
+	return func(i *IstioGormTracing) {
+		if filter == nil {
+			filter = func(error) bool { return true }
+		}
+		i.errorFilter = filter
+	}
+}
+
+// 默认的错误过滤，不记录 gorm.ErrRecordNotFound
+func defaultErrorFilter(err error) bool {
+	return !errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+func (i *IstioGormTracing) isError(err error) bool {
+	if i.errorFilter != nil {
+		return i.errorFilter(err)
+	}
+	return defaultErrorFilter(err)
+}
+
+// 将 span 标记为出错，记录错误信息和分类
+func setSpanError(span opentracing.Span, err error) {
+	ext.Error.Set(span, true)
+	span.LogFields(
+		opentracinglog.String("event", "error"),
+		opentracinglog.String("message", err.Error()),
+		opentracinglog.Error(err),
+	)
+	if kind := errorKind(err); kind != "" {
+		span.SetTag(_tagErrorKind, kind)
+	}
+}
+
+// 错误分类，依次按错误类型、驱动的错误码和错误信息判断，不依赖具体的驱动
+func errorKind(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return ErrorKindTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorKindTimeout
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return ErrorKindConnection
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if kind := driverErrorKind(e); kind != "" {
+			return kind
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range _errorMessageKinds {
+		if strings.Contains(msg, m.substr) {
+			return m.kind
+		}
+	}
+	return ""
+}
+
+// 按驱动的错误码分类
+func driverErrorKind(err error) string {
+	// pgx 和 lib/pq 的错误
+	if e, ok := err.(interface{ SQLState() string }); ok {
+		return sqlStateErrorKind(e.SQLState())
+	}
+	// go-mssqldb 的错误
+	if e, ok := err.(interface{ SQLErrorNumber() int32 }); ok {
+		return _sqlserverErrorKinds[int64(e.SQLErrorNumber())]
+	}
+	// go-sql-driver/mysql 的 MySQLError 没有方法，通过反射读取 Number 和 Message 字段
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct && v.FieldByName("Message").Kind() == reflect.String {
+		if f := v.FieldByName("Number"); f.Kind() >= reflect.Uint && f.Kind() <= reflect.Uint64 {
+			return _mysqlErrorKinds[int64(f.Uint())]
+		}
+	}
+	return ""
+}
+
+// SQLSTATE 的 23 类为约束错误，08 类为连接错误
+func sqlStateErrorKind(state string) string {
+	if kind, ok := _sqlStateErrorKinds[state]; ok {
+		return kind
+	}
+	switch {
+	case strings.HasPrefix(state, "23"):
+		return ErrorKindConstraint
+	case strings.HasPrefix(state, "08"):
+		return ErrorKindConnection
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package istiogormtracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 与 pgx 的 PgError 相同，通过 SQLState 返回错误码
+type fakePgError struct{ code string }
+
+func (e *fakePgError) Error() string    { return "pg error " + e.code }
+func (e *fakePgError) SQLState() string { return e.code }
+
+// 与 go-sql-driver/mysql 的 MySQLError 结构相同
+type fakeMySQLError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *fakeMySQLError) Error() string { return fmt.Sprintf("Error %d: %s", e.Number, e.Message) }
+
+type fakeMSSQLError struct{ number int32 }
+
+func (e fakeMSSQLError) Error() string         { return "mssql error" }
+func (e fakeMSSQLError) SQLErrorNumber() int32 { return e.number }
+
+func TestErrorKind(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{&fakeMySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}, ErrorKindConstraint},
+		{fmt.Errorf("wrapped: %w", &fakeMySQLError{Number: 1213, Message: "Deadlock found"}), ErrorKindDeadlock},
+		{&fakeMySQLError{Number: 2006, Message: "MySQL server has gone away"}, ErrorKindConnection},
+		{&fakePgError{code: "23505"}, ErrorKindConstraint},
+		{&fakePgError{code: "40P01"}, ErrorKindDeadlock},
+		{&fakePgError{code: "57014"}, ErrorKindTimeout},
+		{&fakePgError{code: "08006"}, ErrorKindConnection},
+		{fakeMSSQLError{number: 2627}, ErrorKindConstraint},
+		{context.DeadlineExceeded, ErrorKindTimeout},
+		{driver.ErrBadConn, ErrorKindConnection},
+		{errors.New("UNIQUE constraint failed: users.email"), ErrorKindConstraint},
+		{errors.New("dial tcp 127.0.0.1:3306: connect: connection refused"), ErrorKindConnection},
+		{errors.New("syntax error"), ""},
+	}
+	for _, c := range cases {
+		if got := errorKind(c.err); got != c.want {
+			t.Errorf("errorKind(%v) = %q, want %q", c.err, got, c.want)
+		}
+	}
+}
+
+func TestErrorTags(t *testing.T) {
+	tracer := mocktracer.New()
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	tx := db.Table("users")
+	tx.AddError(&fakePgError{code: "40P01"})
+	var list []map[string]interface{}
+	tx.Find(&list)
+
+	span := tracer.FinishedSpans()[0]
+	if span.Tag("error") != true {
+		t.Errorf("error = %v", span.Tag("error"))
+	}
+	if span.Tag(_tagErrorKind) != ErrorKindDeadlock {
+		t.Errorf("error.kind = %v", span.Tag(_tagErrorKind))
+	}
+	got := map[string]string{}
+	for _, record := range span.Logs() {
+		for _, field := range record.Fields {
+			got[field.Key] = field.ValueString
+		}
+	}
+	if got["event"] != "error" || got["message"] != "pg error 40P01" {
+		t.Errorf("fields = %v", got)
+	}
+}
+
+func TestWithErrorFilter(t *testing.T) {
+	cases := []struct {
+		opts []Option
+		err  error
+		want bool
+	}{
+		{nil, gorm.ErrRecordNotFound, false},
+		{nil, fmt.Errorf("wrapped: %w", gorm.ErrRecordNotFound), false},
+		{nil, errors.New("syntax error"), true},
+		{[]Option{WithErrorFilter(nil)}, gorm.ErrRecordNotFound, true},
+		{[]Option{WithErrorFilter(func(err error) bool { return !errors.Is(err, context.Canceled) })}, context.Canceled, false},
+	}
+	for n, c := range cases {
+		tracer := mocktracer.New()
+		db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Use(NewWithTracer(tracer, c.opts...)); err != nil {
+			t.Fatal(err)
+		}
+		tx := db.Table("users")
+		tx.AddError(c.err)
+		var list []map[string]interface{}
+		tx.Find(&list)
+
+		span := tracer.FinishedSpans()[0]
+		if got := span.Tag("error") == true; got != c.want {
+			t.Errorf("case %d: error = %v, want %v", n, got, c.want)
+		}
+		if _, ok := span.Tags()[_tagRowsReturned]; ok == c.want {
+			t.Errorf("case %d: rows returned tag = %v", n, ok)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package istiogormtracing
+
+import (
+	"io"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+// 结束的 span，交给 SpanExporter 输出
+type FinishedSpan struct {
+	// 十六进制格式，没有父 span 时 ParentID 为空
+	TraceID   string
+	SpanID    string
+	ParentID  string
+	Operation string
+	Table     string
+	// 替换了参数的完整 SQL
+	SQL      string
+	Start    time.Time
+	Duration time.Duration
+	// 执行出错时的错误信息
+	Error string
+	Tags  map[string]interface{}
+	// span 日志中记录的所有字段，如 query、bindings
+	Fields map[string]string
+}
+
+// 自定义的输出组件，如写入 ClickHouse、BigQuery 或内部接口，通过 WithExporter 使用
+// span 会在后台批量导出，返回的错误只记录日志；同时实现了 io.Closer 时，插件关闭时会调用 Close
+type SpanExporter interface {
+	ExportSpans(spans []FinishedSpan) error
+}
+
+// 将 SpanExporter 转换为 jaeger.Reporter，自己创建 tracer 时使用
+func NewExporterReporter(exporter SpanExporter) jaeger.Reporter {
+	r := newBatchReporter(func(spans []*spanData) error {
+		finished := make([]FinishedSpan, 0, len(spans))
+		for _, d := range spans {
+			finished = append(finished, newFinishedSpan(d))
+		}
+		return exporter.ExportSpans(finished)
+	}, nil)
+	return &exporterReporter{batchReporter: r, exporter: exporter}
+}
+
+type exporterReporter struct {
+	*batchReporter
+	exporter SpanExporter
+}
+
+func (r *exporterReporter) Close() {
+	r.batchReporter.Close()
+	if closer, ok := r.exporter.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			r.logger.Error("span 导出组件关闭失败, 错误原因: " + err.Error())
+		}
+	}
+}
+
+func newFinishedSpan(d *spanData) FinishedSpan {
+	span := FinishedSpan{
+		TraceID:   d.TraceID.String(),
+		SpanID:    d.SpanID.String(),
+		Operation: d.Operation,
+		Table:     d.table(),
+		SQL:       d.sql(),
+		Start:     d.Start,
+		Duration:  d.Duration,
+		Error:     d.Fields["error.object"],
+		Tags:      d.Tags,
+		Fields:    d.Fields,
+	}
+	if d.ParentID != 0 {
+		span.ParentID = d.ParentID.String()
+	}
+	return span
+}
@@ -0,0 +1,56 @@
+package istiogormtracing
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+)
+
+type recordExporter struct {
+	mu     sync.Mutex
+	spans  []FinishedSpan
+	closed bool
+}
+
+func (e *recordExporter) ExportSpans(spans []FinishedSpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordExporter) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestWithExporter(t *testing.T) {
+	exporter := &recordExporter{}
+	i, err := New(WithServiceName("istio-gorm-tracing-test"), WithExporter(exporter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := i.getTracer().StartSpan("http")
+	span := i.getTracer().StartSpan(_opQuery, opentracing.ChildOf(parent.Context()))
+	span.LogFields(
+		opentracinglog.String("table", "users"),
+		opentracinglog.String("sql", "SELECT * FROM `users`"),
+		opentracinglog.Error(errors.New("record not found")),
+	)
+	span.Finish()
+	if err := i.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !exporter.closed || len(exporter.spans) != 1 {
+		t.Fatalf("closed = %v, spans = %+v", exporter.closed, exporter.spans)
+	}
+	got := exporter.spans[0]
+	if got.Operation != _opQuery || got.Table != "users" || got.SQL != "SELECT * FROM `users`" ||
+		got.Error != "record not found" || got.ParentID == "" || got.TraceID == "" {
+		t.Errorf("span = %+v", got)
+	}
+}
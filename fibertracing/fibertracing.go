@@ -0,0 +1,27 @@
+// Fiber 框架使用的中间件，与 istiogormtracing.Middleware 作用相同
+package fibertracing
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	istiogormtracing "github.com/liamhao/istio-gorm-tracing"
+)
+
+// 将每个请求的追踪 header 放入 fiber 的 UserContext 中
+// handler 中使用 db.WithContext(c.UserContext()) 即可与上下游服务做关联
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(istiogormtracing.WithHeaders(c.UserContext(), requestHeader(c)))
+		return c.Next()
+	}
+}
+
+// fiber 基于 fasthttp，header 需要转换为 http.Header，这里的字节切片会被复用，必须复制一份
+func requestHeader(c *fiber.Ctx) http.Header {
+	h := http.Header{}
+	c.Request().Header.VisitAll(func(k, v []byte) {
+		h.Add(string(k), string(v))
+	})
+	return h
+}
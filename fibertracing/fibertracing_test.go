@@ -0,0 +1,110 @@
+package fibertracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	istiogormtracing "github.com/liamhao/istio-gorm-tracing"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// 测试用的 dialector，执行 SQL 时返回错误，只用来创建 span
+type testDialector struct{}
+
+func (testDialector) Name() string { return "test" }
+func (testDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	db.ConnPool = errPool{}
+	return nil
+}
+func (testDialector) Migrator(*gorm.DB) gorm.Migrator                             { return nil }
+func (testDialector) DataTypeOf(*schema.Field) string                             { return "" }
+func (testDialector) DefaultValueOf(*schema.Field) clause.Expression              { return clause.Expr{} }
+func (testDialector) BindVarTo(w clause.Writer, _ *gorm.Statement, _ interface{}) { w.WriteByte('?') }
+func (testDialector) QuoteTo(w clause.Writer, s string)                           { w.WriteString(s) }
+func (testDialector) Explain(sql string, _ ...interface{}) string                 { return sql }
+
+var errNoDatabase = errors.New("no database")
+
+type errPool struct{}
+
+func (errPool) PrepareContext(context.Context, string) (*sql.Stmt, error) { return nil, errNoDatabase }
+func (errPool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, errNoDatabase
+}
+func (errPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, errNoDatabase
+}
+func (errPool) QueryRowContext(context.Context, string, ...interface{}) *sql.Row { return nil }
+
+type recordExporter struct {
+	mu    sync.Mutex
+	spans []istiogormtracing.FinishedSpan
+}
+
+func (e *recordExporter) ExportSpans(spans []istiogormtracing.FinishedSpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// 在 handler 中执行一次查询，返回查询的 span
+func querySpan(t *testing.T, run func(db *gorm.DB)) istiogormtracing.FinishedSpan {
+	t.Helper()
+	exporter := &recordExporter{}
+	plugin, err := istiogormtracing.New(istiogormtracing.WithServiceName("fibertracing-test"), istiogormtracing.WithExporter(exporter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(testDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+	run(db)
+	if err := plugin.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(exporter.spans) != 1 {
+		t.Fatalf("got %d spans", len(exporter.spans))
+	}
+	return exporter.spans[0]
+}
+
+func find(ctx context.Context, db *gorm.DB) {
+	var list []map[string]interface{}
+	db.WithContext(ctx).Table("users").Find(&list)
+}
+
+func TestMiddleware(t *testing.T) {
+	span := querySpan(t, func(db *gorm.DB) {
+		app := fiber.New()
+		app.Use(Middleware())
+		app.Get("/users", func(c *fiber.Ctx) error {
+			var list []map[string]interface{}
+			db.WithContext(c.UserContext()).Table("users").Find(&list)
+			return c.SendStatus(http.StatusOK)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		if _, err := app.Test(req); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if span.TraceID != "0af7651916cd43dd8448eb211c80319c" || span.ParentID != "b7ad6b7169203331" {
+		t.Errorf("span = %s/%s", span.TraceID, span.ParentID)
+	}
+}
@@ -0,0 +1,125 @@
+package istiogormtracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	// 单个文件的默认大小上限
+	_defaultFileMaxSize = 100 << 20
+	// 默认保留的历史文件数量
+	_defaultFileMaxBackups = 5
+)
+
+// 写入文件的配置
+type FileConfig struct {
+	// 文件路径，历史文件为 {Path}.1、{Path}.2 ...，数字越大越旧
+	Path string
+	// 单个文件的大小上限(字节)，超过后轮转，默认为 100MB
+	MaxSize int64
+	// 保留的历史文件数量，默认为 5
+	MaxBackups int
+}
+
+// 将结束的 span 以 json 格式逐行追加到文件中，按大小轮转，用于隔离网络环境中由日志组件之后再收集上报
+func NewFileReporter(cfg FileConfig) (jaeger.Reporter, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = _defaultFileMaxSize
+	}
+	if cfg.MaxBackups <= 0 {
+		cfg.MaxBackups = _defaultFileMaxBackups
+	}
+	w := &rotateFile{cfg: cfg}
+	if err := w.open(); err != nil {
+		return nil, fmt.Errorf("span 文件打开失败, 错误原因: %w", err)
+	}
+	r := newBatchReporter(func(spans []*spanData) error {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, d := range spans {
+			if err := enc.Encode(newSpanRecord(d)); err != nil {
+				return err
+			}
+		}
+		return w.write(buf.Bytes())
+	}, nil)
+	return &fileReporter{batchReporter: r, file: w}, nil
+}
+
+// 上报完队列中的 span 后关闭文件
+type fileReporter struct {
+	*batchReporter
+	file *rotateFile
+}
+
+func (r *fileReporter) Close() {
+	r.batchReporter.Close()
+	r.file.close()
+}
+
+// 按大小轮转的文件，写入的内容不会被拆分到两个文件中
+type rotateFile struct {
+	cfg FileConfig
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func (f *rotateFile) open() error {
+	file, err := os.OpenFile(f.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotateFile) write(b []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.size > 0 && f.size+int64(len(b)) > f.cfg.MaxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return err
+}
+
+// 依次重命名历史文件，超出数量的最旧文件会被覆盖
+func (f *rotateFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	for n := f.cfg.MaxBackups - 1; n > 0; n-- {
+		old := fmt.Sprintf("%s.%d", f.cfg.Path, n)
+		if _, err := os.Stat(old); err == nil {
+			if err := os.Rename(old, fmt.Sprintf("%s.%d", f.cfg.Path, n+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(f.cfg.Path, f.cfg.Path+".1"); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotateFile) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.file.Close()
+}
@@ -0,0 +1,59 @@
+package istiogormtracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestFileReporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.log")
+	reporter, err := NewFileReporter(FileConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), reporter)
+	span := tracer.StartSpan(_opQuery)
+	span.Finish()
+	closer.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record spanRecord
+	if err := json.Unmarshal(b, &record); err != nil || record.SpanID != span.Context().(jaeger.SpanContext).SpanID().String() {
+		t.Errorf("file = %s, err = %v", b, err)
+	}
+}
+
+func TestRotateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.log")
+	f := &rotateFile{cfg: FileConfig{Path: path, MaxSize: 10, MaxBackups: 2}}
+	if err := f.open(); err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 4; n++ {
+		if err := f.write([]byte(fmt.Sprintf("line%d\n", n))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.close()
+
+	// 每行 6 字节，每个文件只能写一行，最旧的 line0 被删除
+	want := map[string]string{path: "line3\n", path + ".1": "line2\n", path + ".2": "line1\n"}
+	for name, content := range want {
+		b, err := ioutil.ReadFile(name)
+		if err != nil || string(b) != content {
+			t.Errorf("%s = %q, %v, want %q", name, b, err, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("backups exceed MaxBackups: %v", err)
+	}
+}
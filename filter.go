@@ -0,0 +1,90 @@
+package istiogormtracing
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 设置不追踪的表，如 sessions、schema_migrations 和高频的队列表，避免这些表的 SQL 占满追踪存储，不区分大小写，多次调用时追加
+// 带库名(如 shop.sessions)时只排除该库中的表，否则排除所有库中的同名表；Raw 和 Exec 的表名从 SQL 中解析
+// 可以通过 Reconfigure 在运行时修改
+func WithExcludeTables(tables ...string) Option {
+	return func(i *IstioGormTracing) {
+		i.excludeTables = lowerSet(i.excludeTables, tables)
+		i.excludedTables.Store(i.excludeTables)
+	}
+}
+
+// 在 base 的基础上加入 values 的新集合，值转为小写；集合保存到 atomic.Value 后不再修改
+func lowerSet(base map[string]bool, values []string) map[string]bool {
+	set := make(map[string]bool, len(base)+len(values))
+	for v := range base {
+		set[v] = true
+	}
+	for _, v := range values {
+		set[strings.ToLower(v)] = true
+	}
+	return set
+}
+
+// SQL 操作的表是否被排除
+func (i *IstioGormTracing) excludedTable(db *gorm.DB) bool {
+	tables, _ := i.excludedTables.Load().(map[string]bool)
+	if len(tables) == 0 {
+		return false
+	}
+	table := strings.ToLower(statementTable(db))
+	if table == "" {
+		return false
+	}
+	if tables[table] {
+		return true
+	}
+	if n := strings.LastIndexByte(table, '.'); n >= 0 {
+		return tables[table[n+1:]]
+	}
+	return false
+}
+
+// 可以排除的操作，Count、Pluck、Scan 可以单独排除，也随 query、row 一起排除
+var _excludableOperations = map[string]bool{
+	_opCreate: true,
+	_opUpdate: true,
+	_opDelete: true,
+	_opQuery:  true,
+	_opRow:    true,
+	_opRaw:    true,
+	_opCount:  true,
+	_opPluck:  true,
+	_opScan:   true,
+}
+
+// 设置不追踪的操作，可选 create、update、delete、query、row、raw、count、pluck、scan，多次调用时追加
+// 读请求量很大时可以只追踪写操作，如 WithExcludeOperations("query", "row", "raw")；可以通过 Reconfigure 在运行时修改
+func WithExcludeOperations(ops ...string) Option {
+	return func(i *IstioGormTracing) {
+		for _, op := range ops {
+			if !_excludableOperations[op] {
+				i.optionErr = fmt.Errorf("不支持排除的操作: %s", op)
+				return
+			}
+		}
+		i.excludeOperations = lowerSet(i.excludeOperations, ops)
+		i.excludedOperations.Store(i.excludeOperations)
+	}
+}
+
+// 操作是否被排除，Count 等方法同时按方法名判断
+func (i *IstioGormTracing) excludedOperation(db *gorm.DB, op string) bool {
+	ops, _ := i.excludedOperations.Load().(map[string]bool)
+	if len(ops) == 0 {
+		return false
+	}
+	if ops[op] {
+		return true
+	}
+	finisher := finisherOf(db, op)
+	return finisher != "" && ops[finisher]
+}
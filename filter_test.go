@@ -0,0 +1,180 @@
+package istiogormtracing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+type Session struct {
+	ID    uint
+	Token string
+}
+
+func TestWithExcludeTables(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithExcludeTables("Sessions", "shop.schema_migrations"))); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Model(&Session{}).Where("token = ?", "abc").Find(&list)
+	db.Table("sessions").Create(map[string]interface{}{"token": "abc"})
+	db.Exec("DELETE FROM `app`.`sessions` WHERE id = ?", 1)
+	db.Exec("INSERT INTO shop.schema_migrations (version) VALUES (1)")
+	db.Exec("INSERT INTO other.schema_migrations (version) VALUES (1)")
+	db.Table("users").Find(&list)
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	if spans[0].OperationName != "insert" || spans[1].OperationName != "query" {
+		t.Errorf("spans = %s, %s", spans[0].OperationName, spans[1].OperationName)
+	}
+}
+
+func TestReconfigureExcludeTables(t *testing.T) {
+	tracer := mocktracer.New()
+	i := NewWithTracer(tracer, WithExcludeTables("sessions"))
+	db := openDB(t)
+	if err := db.Use(i); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	query := func() string {
+		tracer.Reset()
+		db.Table("sessions").Find(&list)
+		db.Table("jobs").Find(&list)
+		var tables []string
+		for _, span := range tracer.FinishedSpans() {
+			tables = append(tables, span.Logs()[0].Fields[0].ValueString)
+		}
+		return strings.Join(tables, ",")
+	}
+	if got := query(); got != "jobs" {
+		t.Errorf("before reload: %s", got)
+	}
+	if err := i.Reconfigure(&Config{ExcludeTables: []string{"Jobs"}}); err != ErrExternalTracer {
+		t.Fatal(err)
+	}
+	if got := query(); got != "sessions" {
+		t.Errorf("after reload: %s", got)
+	}
+	// 去掉配置后恢复为创建时的设置
+	if err := i.Reconfigure(&Config{}); err != ErrExternalTracer {
+		t.Fatal(err)
+	}
+	if got := query(); got != "jobs" {
+		t.Errorf("after reset: %s", got)
+	}
+}
+
+func TestWithExcludeOperations(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithExcludeOperations("query", "row", "raw"))); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	var count int64
+	db.Table("users").Find(&list)
+	db.Table("users").Count(&count)
+	db.Table("users").Row()
+	db.Exec("UPDATE users SET name = ?", "a")
+	db.Table("users").Create(map[string]interface{}{"id": 1})
+	db.Table("users").Where("id = ?", 1).Delete(nil)
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 || spans[0].OperationName != "create" || spans[1].OperationName != "delete" {
+		t.Fatalf("got %d spans", len(spans))
+	}
+}
+
+func TestWithExcludeOperationsFinisher(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithExcludeOperations("count"))); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	var count int64
+	db.Table("users").Count(&count)
+	db.Table("users").Find(&list)
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 || spans[0].OperationName != "query" {
+		t.Fatalf("got %d spans", len(spans))
+	}
+}
+
+func TestReconfigureExcludeOperations(t *testing.T) {
+	tracer := mocktracer.New()
+	i := NewWithTracer(tracer, WithExcludeOperations("query"))
+	db := openDB(t)
+	if err := db.Use(i); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	run := func() string {
+		tracer.Reset()
+		db.Table("users").Find(&list)
+		db.Table("users").Create(map[string]interface{}{"id": 1})
+		var names []string
+		for _, span := range tracer.FinishedSpans() {
+			names = append(names, span.OperationName)
+		}
+		return strings.Join(names, ",")
+	}
+	if got := run(); got != "create" {
+		t.Errorf("before reload: %s", got)
+	}
+	if err := i.Reconfigure(&Config{ExcludeOperations: []string{"create"}}); err != ErrExternalTracer {
+		t.Fatal(err)
+	}
+	if got := run(); got != "query" {
+		t.Errorf("after reload: %s", got)
+	}
+	if err := i.Reconfigure(&Config{ExcludeOperations: []string{"select"}}); err == nil || err == ErrExternalTracer {
+		t.Errorf("invalid operation should be rejected: %v", err)
+	}
+	if got := run(); got != "query" {
+		t.Errorf("after invalid reload: %s", got)
+	}
+	if err := i.Reconfigure(&Config{}); err != ErrExternalTracer {
+		t.Fatal(err)
+	}
+	if got := run(); got != "create" {
+		t.Errorf("after reset: %s", got)
+	}
+}
+
+// 查询时重新加载过滤列表不会产生数据竞争
+func TestReconfigureFiltersConcurrently(t *testing.T) {
+	i := NewWithTracer(mocktracer.New())
+	db := openDB(t)
+	if err := db.Use(i); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 0; n < 50; n++ {
+			_ = i.Reconfigure(&Config{ExcludeTables: []string{"users"}, ExcludeOperations: []string{"raw"}})
+			_ = i.Reconfigure(&Config{})
+		}
+	}()
+	var list []map[string]interface{}
+	for n := 0; n < 50; n++ {
+		db.Table("users").Find(&list)
+	}
+	<-done
+}
+
+func TestWithExcludeOperationsInvalid(t *testing.T) {
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(mocktracer.New(), WithExcludeOperations("select"))); err == nil {
+		t.Error("expected error for unknown operation")
+	}
+}
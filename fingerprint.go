@@ -0,0 +1,119 @@
+package istiogormtracing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// 相同结构的 SQL 有相同的指纹，可以按指纹聚合不同 trace 中的查询
+const _tagFingerprint = "db.statement.fingerprint"
+
+var (
+	// 只包含占位符的列表，如 IN (?, ?, ?)
+	_placeholderListRe = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	// 批量插入的多组参数，如 VALUES (?+), (?+)
+	_repeatedListRe = regexp.MustCompile(`\(\?\+\)(?:\s*,\s*\(\?\+\))+`)
+)
+
+// 生成 SQL 的指纹: 去掉注释，字符串、数字和占位符替换为 ?，占位符列表合并为 (?+)，合并空白并转为小写
+// 如 SELECT * FROM users WHERE id IN (1, 2) AND name = 'a' 的指纹为 select * from users where id in (?+) and name = ?
+func fingerprint(sql string) string {
+	var b strings.Builder
+	space := false
+	write := func(s string) {
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(s)
+	}
+	for pos := 0; pos < len(sql); pos++ {
+		c := sql[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+		case c == '-' && strings.HasPrefix(sql[pos:], "--"):
+			for pos < len(sql) && sql[pos] != '\n' {
+				pos++
+			}
+			space = true
+		case c == '/' && strings.HasPrefix(sql[pos:], "/*"):
+			end := strings.Index(sql[pos+2:], "*/")
+			if end < 0 {
+				pos = len(sql)
+			} else {
+				pos += end + 3
+			}
+			space = true
+		case c == '\'':
+			// 跳过字符串，支持 '' 和 \' 转义
+			for pos++; pos < len(sql); pos++ {
+				if sql[pos] == '\\' {
+					pos++
+				} else if sql[pos] == '\'' {
+					if pos+1 < len(sql) && sql[pos+1] == '\'' {
+						pos++
+						continue
+					}
+					break
+				}
+			}
+			write("?")
+		case c == '`' || c == '"':
+			// 带引号的名称保持原样
+			end := strings.IndexByte(sql[pos+1:], c)
+			if end < 0 {
+				end = len(sql) - pos - 1
+			}
+			write(sql[pos : pos+end+2])
+			pos += end + 1
+		case (c == '$' || c == '@') && pos+1 < len(sql):
+			start := pos + 1
+			if c == '@' && (sql[start] == 'p' || sql[start] == 'P') {
+				start++
+			}
+			end := start
+			for end < len(sql) && isDigit(sql[end]) {
+				end++
+			}
+			if end == start {
+				write(string(c))
+				continue
+			}
+			write("?")
+			pos = end - 1
+		case isDigit(c):
+			for pos+1 < len(sql) && (isDigit(sql[pos+1]) || sql[pos+1] == '.') {
+				pos++
+			}
+			write("?")
+		case isIdentStart(c):
+			end := pos + 1
+			for end < len(sql) && (isIdentStart(sql[end]) || isDigit(sql[end])) {
+				end++
+			}
+			write(strings.ToLower(sql[pos:end]))
+			pos = end - 1
+		default:
+			write(string(c))
+		}
+	}
+	s := _placeholderListRe.ReplaceAllString(b.String(), "(?+)")
+	return _repeatedListRe.ReplaceAllString(s, "(?+)")
+}
+
+// 指纹的 sha256 值，取前 16 位
+func hashFingerprint(fp string) string {
+	sum := sha256.Sum256([]byte(fp))
+	return hex.EncodeToString(sum[:8])
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,55 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestFingerprint(t *testing.T) {
+	cases := []struct {
+		sql, want string
+	}{
+		{"SELECT * FROM users WHERE id IN (1, 2,3) AND name = 'it''s'", "select * from users where id in (?+) and name = ?"},
+		{"select *\n  from   users where id in (?,?) and name = ?", "select * from users where id in (?+) and name = ?"},
+		{`SELECT * FROM "users" WHERE "id" = $1 AND score > 1.5`, `select * from "users" where "id" = ? and score > ?`},
+		{"INSERT INTO `t1` (`a`,`b`) VALUES (?,?),(?,?) /* hint */", "insert into `t1` (`a`,`b`) values (?+)"},
+		{"SELECT col2 FROM t3 WHERE x = @p1 -- comment", "select col2 from t3 where x = ?"},
+	}
+	for _, c := range cases {
+		if got := fingerprint(c.sql); got != c.want {
+			t.Errorf("fingerprint(%q) = %q, want %q", c.sql, got, c.want)
+		}
+	}
+}
+
+func TestWithFingerprint(t *testing.T) {
+	for _, hashed := range []bool{false, true} {
+		tracer := mocktracer.New()
+		db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Use(NewWithTracer(tracer, WithFingerprint(hashed))); err != nil {
+			t.Fatal(err)
+		}
+		var list []map[string]interface{}
+		db.Table("users").Where("id IN ?", []int{1, 2}).Find(&list)
+		db.Table("users").Where("id IN ?", []int{3, 4, 5}).Find(&list)
+
+		spans := tracer.FinishedSpans()
+		first, second := spans[0].Tag(_tagFingerprint), spans[1].Tag(_tagFingerprint)
+		if first != second {
+			t.Errorf("hashed=%v: fingerprints differ: %v, %v", hashed, first, second)
+		}
+		want := "select * from users where id in (?+)"
+		if hashed {
+			want = hashFingerprint(want)
+		}
+		if first != want {
+			t.Errorf("hashed=%v: fingerprint = %v, want %v", hashed, first, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package istiogormtracing
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// Count、Pluck、Scan 等聚合方法的 span 使用方法名作为操作名称，可以单独统计耗时
+const (
+	_opCount = "count"
+	_opPluck = "pluck"
+	_opScan  = "scan"
+	// 执行 SQL 的 gorm 方法
+	_tagFinisher = "db.finisher"
+)
+
+// Scan 执行时 gorm 会临时替换为记录 SQL 的日志组件，通过它的类型区分 Scan 和 Rows
+var _recorderType = reflect.TypeOf(logger.Recorder.New())
+
+// 识别执行 SQL 的 gorm 方法，不是 Count、Pluck、Scan 时返回空字符串
+func finisherOf(db *gorm.DB, op string) string {
+	switch op {
+	case _opQuery:
+		if _, ok := db.Statement.Dest.(*int64); ok && isCountSelect(db) {
+			return _opCount
+		}
+		if isPluck(db) {
+			return _opPluck
+		}
+	case _opRow:
+		if reflect.TypeOf(db.Logger) == _recorderType {
+			return _opScan
+		}
+	}
+	return ""
+}
+
+// Count 会将 SELECT 子句替换为 count(*)、COUNT(?) 或 COUNT(DISTINCT(?))
+func isCountSelect(db *gorm.DB) bool {
+	c, ok := db.Statement.Clauses["SELECT"]
+	if !ok {
+		return false
+	}
+	// clause.Select 合并到子句时，设置了 Expression 的会直接使用 Expression
+	expr, ok := c.Expression.(clause.Expr)
+	return ok && strings.HasPrefix(strings.ToLower(expr.SQL), "count(")
+}
+
+// Pluck 只查询一个字段，结果为基本类型的切片
+func isPluck(db *gorm.DB) bool {
+	c, ok := db.Statement.Clauses["SELECT"]
+	if !ok {
+		return false
+	}
+	if sel, ok := c.Expression.(clause.Select); !ok || len(sel.Columns) != 1 || sel.Expression != nil {
+		return false
+	}
+	t := reflect.TypeOf(db.Statement.Dest)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Slice {
+		return false
+	}
+	elem := t.Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	switch elem.Kind() {
+	case reflect.Struct:
+		return elem == reflect.TypeOf(time.Time{})
+	case reflect.Map, reflect.Interface:
+		return false
+	}
+	return true
+}
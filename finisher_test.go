@@ -0,0 +1,43 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestFinisherOperationNames(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&tracingUser{}).Count(&count)
+	db.Model(&tracingUser{}).Distinct("name").Count(&count)
+	var names []string
+	db.Model(&tracingUser{}).Pluck("name", &names)
+	var users []tracingUser
+	db.Raw("SELECT * FROM tracing_users").Scan(&users)
+	db.Find(&users)
+	rows, err := db.Table("users").Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	want := []string{_opCount, _opCount, _opPluck, _opScan, _opQuery, _opRow}
+	spans := tracer.FinishedSpans()
+	if len(spans) != len(want) {
+		t.Fatalf("spans = %v", spans)
+	}
+	for n, span := range spans {
+		if span.OperationName != want[n] {
+			t.Errorf("span %d: operation = %q, want %q", n, span.OperationName, want[n])
+		}
+		finisher, ok := span.Tags()[_tagFinisher]
+		if tagged := want[n] != _opQuery && want[n] != _opRow; ok != tagged || (ok && finisher != want[n]) {
+			t.Errorf("span %d: db.finisher = %v", n, finisher)
+		}
+	}
+}
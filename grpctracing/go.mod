@@ -0,0 +1,9 @@
+module github.com/liamhao/istio-gorm-tracing/grpctracing
+
+go 1.16
+
+require (
+	github.com/liamhao/istio-gorm-tracing v0.0.0-20261016074853-841c9bfd9ff4
+	google.golang.org/grpc v1.47.0
+	gorm.io/gorm v1.23.6
+)
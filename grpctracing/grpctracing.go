@@ -0,0 +1,77 @@
+// gRPC 服务使用的辅助方法，gRPC 请求中的追踪信息保存在 metadata 中，而不是 http.Header
+package grpctracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	istiogormtracing "github.com/liamhao/istio-gorm-tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// 从 gRPC 的 incoming metadata 中取出 B3/W3C 等追踪信息，放入 context 中供 gorm 回调使用
+// 只有二进制的 grpc-trace-bin 时转换为 W3C 格式，需要插件的 Propagator 支持 FormatW3C(默认支持)
+// 使用方式: db.WithContext(grpctracing.FromGRPCMetadata(ctx))
+func FromGRPCMetadata(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return istiogormtracing.WithHeaders(ctx, metadataToHeader(md))
+}
+
+// 一元调用的服务端拦截器，自动将 metadata 中的追踪信息放入 context
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(FromGRPCMetadata(ctx), req)
+	}
+}
+
+// 流式调用的服务端拦截器，自动将 metadata 中的追踪信息放入 context
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: FromGRPCMetadata(ss.Context())})
+	}
+}
+
+// 替换了 context 的 grpc.ServerStream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// OpenCensus 和 gRPC 内置追踪使用的二进制追踪信息
+const _grpcTraceBin = "grpc-trace-bin"
+
+// metadata 中的 key 都是小写的，转换为 http.Header 时需要规范化
+// 二进制的 -bin 字段中只处理 grpc-trace-bin，转换为 W3C 的 traceparent，metadata 中已有 traceparent 时以它为准
+func metadataToHeader(md metadata.MD) http.Header {
+	h := make(http.Header, len(md))
+	for k, vs := range md {
+		if !strings.HasSuffix(k, "-bin") {
+			h[http.CanonicalHeaderKey(k)] = vs
+		}
+	}
+	if vs := md.Get(_grpcTraceBin); len(vs) > 0 && len(md.Get("traceparent")) == 0 {
+		if traceparent := traceparentFromBinary([]byte(vs[0])); traceparent != "" {
+			h.Set("traceparent", traceparent)
+		}
+	}
+	return h
+}
+
+// 解析 grpc-trace-bin 的二进制格式，转换为 traceparent，格式有误时返回空字符串
+// 格式: 版本(0) | 0 trace id(16 字节) | 1 span id(8 字节) | 2 trace options(1 字节，最低位为是否采样)
+func traceparentFromBinary(b []byte) string {
+	if len(b) < 29 || b[0] != 0 || b[1] != 0 || b[18] != 1 || b[27] != 2 {
+		return ""
+	}
+	return fmt.Sprintf("00-%x-%x-%02x", b[2:18], b[19:27], b[28]&1)
+}
@@ -0,0 +1,158 @@
+package grpctracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	istiogormtracing "github.com/liamhao/istio-gorm-tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// 测试用的 dialector，执行 SQL 时返回错误，只用来创建 span
+type testDialector struct{}
+
+func (testDialector) Name() string { return "test" }
+func (testDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	db.ConnPool = errPool{}
+	return nil
+}
+func (testDialector) Migrator(*gorm.DB) gorm.Migrator                             { return nil }
+func (testDialector) DataTypeOf(*schema.Field) string                             { return "" }
+func (testDialector) DefaultValueOf(*schema.Field) clause.Expression              { return clause.Expr{} }
+func (testDialector) BindVarTo(w clause.Writer, _ *gorm.Statement, _ interface{}) { w.WriteByte('?') }
+func (testDialector) QuoteTo(w clause.Writer, s string)                           { w.WriteString(s) }
+func (testDialector) Explain(sql string, _ ...interface{}) string                 { return sql }
+
+var errNoDatabase = errors.New("no database")
+
+type errPool struct{}
+
+func (errPool) PrepareContext(context.Context, string) (*sql.Stmt, error) { return nil, errNoDatabase }
+func (errPool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, errNoDatabase
+}
+func (errPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, errNoDatabase
+}
+func (errPool) QueryRowContext(context.Context, string, ...interface{}) *sql.Row { return nil }
+
+type recordExporter struct {
+	mu    sync.Mutex
+	spans []istiogormtracing.FinishedSpan
+}
+
+func (e *recordExporter) ExportSpans(spans []istiogormtracing.FinishedSpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// 在 handler 中执行一次查询，返回查询的 span
+func querySpan(t *testing.T, run func(db *gorm.DB)) istiogormtracing.FinishedSpan {
+	t.Helper()
+	exporter := &recordExporter{}
+	plugin, err := istiogormtracing.New(istiogormtracing.WithServiceName("grpctracing-test"), istiogormtracing.WithExporter(exporter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(testDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+	run(db)
+	if err := plugin.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(exporter.spans) != 1 {
+		t.Fatalf("got %d spans", len(exporter.spans))
+	}
+	return exporter.spans[0]
+}
+
+func find(ctx context.Context, db *gorm.DB) {
+	var list []map[string]interface{}
+	db.WithContext(ctx).Table("users").Find(&list)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	md := metadata.Pairs(
+		"x-b3-traceid", "463ac35c9f6413ad48485a3953bb6124",
+		"x-b3-spanid", "a2fb4a1d1a96d312",
+		"x-b3-sampled", "1",
+	)
+	span := querySpan(t, func(db *gorm.DB) {
+		interceptor := UnaryServerInterceptor()
+		_, err := interceptor(metadata.NewIncomingContext(context.Background(), md), nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			find(ctx, db)
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if span.TraceID != "463ac35c9f6413ad48485a3953bb6124" || span.ParentID != "a2fb4a1d1a96d312" {
+		t.Errorf("span = %s/%s", span.TraceID, span.ParentID)
+	}
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context { return s.ctx }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	md := metadata.Pairs("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	span := querySpan(t, func(db *gorm.DB) {
+		stream := &testServerStream{ctx: metadata.NewIncomingContext(context.Background(), md)}
+		err := StreamServerInterceptor()(nil, stream, &grpc.StreamServerInfo{}, func(srv interface{}, ss grpc.ServerStream) error {
+			find(ss.Context(), db)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if span.TraceID != "0af7651916cd43dd8448eb211c80319c" || span.ParentID != "b7ad6b7169203331" {
+		t.Errorf("span = %s/%s", span.TraceID, span.ParentID)
+	}
+}
+
+// 只有 grpc-trace-bin 时，从二进制格式中解析父 span
+func TestGRPCTraceBin(t *testing.T) {
+	bin := []byte{0, 0}
+	bin = append(bin, 0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c)
+	bin = append(bin, 1, 0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31)
+	bin = append(bin, 2, 1)
+	md := metadata.Pairs(_grpcTraceBin, string(bin))
+	span := querySpan(t, func(db *gorm.DB) {
+		find(FromGRPCMetadata(metadata.NewIncomingContext(context.Background(), md)), db)
+	})
+	if span.TraceID != "0af7651916cd43dd8448eb211c80319c" || span.ParentID != "b7ad6b7169203331" {
+		t.Errorf("span = %s/%s", span.TraceID, span.ParentID)
+	}
+
+	if got := traceparentFromBinary(bin[:20]); got != "" {
+		t.Errorf("truncated grpc-trace-bin = %q", got)
+	}
+	h := metadataToHeader(metadata.Pairs(_grpcTraceBin, string(bin), "custom-bin", "x", "traceparent", "00-463ac35c9f6413ad48485a3953bb6124-a2fb4a1d1a96d312-01"))
+	if !strings.HasPrefix(h.Get("traceparent"), "00-463ac35c9f6413ad") || h.Get("custom-bin") != "" {
+		t.Errorf("header = %v", h)
+	}
+}
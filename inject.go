@@ -0,0 +1,50 @@
+package istiogormtracing
+
+import (
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"gorm.io/gorm"
+)
+
+// 取出 SQL 执行时创建的 span，查询结束后 span 已经结束，但仍可以作为后续操作的父 span
+// 使用方式: tx := db.WithContext(ctx).Create(&order); span := istiogormtracing.SpanFromDB(tx)
+// 通过 WithSpanKey 修改了 key 时请使用插件的 SpanFromDB 方法
+func SpanFromDB(db *gorm.DB) opentracing.Span {
+	return spanFromDB(db, spankey)
+}
+
+// 与 SpanFromDB 相同，使用插件设置的 key
+func (i *IstioGormTracing) SpanFromDB(db *gorm.DB) opentracing.Span {
+	return spanFromDB(db, i.getSpanKey())
+}
+
+func spanFromDB(db *gorm.DB, key string) opentracing.Span {
+	if db == nil || db.Statement == nil {
+		return nil
+	}
+	v, ok := db.InstanceGet(key)
+	if !ok {
+		return nil
+	}
+	span, _ := v.(opentracing.Span)
+	return span
+}
+
+// 将 span 的追踪信息写入 carrier，如写入消息头后发布消息，下游即可接着这条链路继续追踪
+// jaeger span 同时写入 B3 和 W3C 格式，其他 tracer 使用 tracer 自己注册的格式
+func Inject(span opentracing.Span, carrier opentracing.TextMapWriter) error {
+	if span == nil {
+		return opentracing.ErrInvalidSpanContext
+	}
+	if spanCtx, ok := span.Context().(jaeger.SpanContext); ok {
+		if err := B3Propagator().Inject(spanCtx, carrier); err != nil {
+			return err
+		}
+		return W3CPropagator().Inject(spanCtx, carrier)
+	}
+	// 部分 tracer(如 OpenTelemetry 的 bridge)只支持 HTTPHeaders 格式
+	if _, ok := carrier.(opentracing.HTTPHeadersCarrier); ok {
+		return span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, carrier)
+	}
+	return span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier)
+}
@@ -0,0 +1,86 @@
+package istiogormtracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/uber/jaeger-client-go"
+	"gorm.io/gorm"
+)
+
+func TestInjectFromDB(t *testing.T) {
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+	i := NewWithTracer(tracer)
+
+	db := &gorm.DB{Config: &gorm.Config{}, Statement: &gorm.Statement{Context: context.Background()}}
+	i.beforeCreate(db)
+	span := SpanFromDB(db)
+	if span == nil {
+		t.Fatal("span not found")
+	}
+	span.Finish()
+
+	carrier := opentracing.TextMapCarrier{}
+	if err := Inject(span, carrier); err != nil {
+		t.Fatal(err)
+	}
+	got, err := defaultPropagator.Extract(carrier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := span.Context().(jaeger.SpanContext)
+	if got.TraceID() != want.TraceID() || got.SpanID() != want.SpanID() {
+		t.Errorf("injected = %s, want %s", got, want)
+	}
+}
+
+func TestInjectNonJaeger(t *testing.T) {
+	tracer := mocktracer.New()
+	span := tracer.StartSpan("db")
+	carrier := opentracing.TextMapCarrier{}
+	if err := Inject(span, carrier); err != nil {
+		t.Fatal(err)
+	}
+	got, err := tracer.Extract(opentracing.TextMap, carrier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.(mocktracer.MockSpanContext).SpanID != span.Context().(mocktracer.MockSpanContext).SpanID {
+		t.Errorf("carrier = %v", carrier)
+	}
+
+	if err := Inject(nil, carrier); err == nil {
+		t.Error("nil span should fail")
+	}
+	if SpanFromDB(&gorm.DB{Statement: &gorm.Statement{}}) != nil {
+		t.Error("span should be nil without callbacks")
+	}
+}
+
+func TestWithSpanKey(t *testing.T) {
+	tracer := mocktracer.New()
+	i := NewWithTracer(tracer, WithSpanKey("tracing:span"))
+	db := openDB(t)
+	// 其他插件使用了默认的 key
+	db.Callback().Query().Before("gorm:query").Register("other:before_query", func(db *gorm.DB) {
+		db.InstanceSet(spankey, "other")
+	})
+	if err := db.Use(i); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	tx := db.Table("users").Find(&list)
+
+	if len(tracer.FinishedSpans()) != 1 {
+		t.Fatalf("spans = %d", len(tracer.FinishedSpans()))
+	}
+	if span := i.SpanFromDB(tx); span != tracer.FinishedSpans()[0] {
+		t.Errorf("span = %v", span)
+	}
+	if SpanFromDB(tx) != nil {
+		t.Error("default key should not hold the span")
+	}
+}
@@ -2,27 +2,135 @@ package istiogormtracing
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"crypto/tls"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	opentracinglog "github.com/opentracing/opentracing-go/log"
 	"github.com/uber/jaeger-client-go"
 	"github.com/uber/jaeger-client-go/config"
 	jaegerlog "github.com/uber/jaeger-client-go/log"
-	"github.com/uber/jaeger-client-go/zipkin"
+	"github.com/uber/jaeger-client-go/transport"
 	"gorm.io/gorm"
 )
 
 type IstioGormTracing struct {
 	ServiceName       string
 	CollectorEndpoint string
+
+	sampler *config.SamplerConfig
+	// 远程采样时单独采样的操作数量上限
+	samplingMaxOperations int
+	// 没有父 span 时生成 128 位的 trace id
+	gen128Bit         bool
+	reporterQueueSize int
+	// 上报的间隔和每次 http 上报的 span 数量，为 0 时使用 jaeger 的默认值
+	reporterFlushInterval time.Duration
+	reporterBatchSize     int
+	// 是否在日志中打印每个上报的 span，为空时只有上报到 jaeger 收集器时打印
+	logSpans          *bool
+	logger            jaeger.Logger
+	tags              []opentracing.Tag
+	spanTags          []opentracing.Tag
+	reporters         []jaeger.Reporter
+	agentHostPort     string
+	maxPacketSize     int
+	collectorTLS      *tls.Config
+	collectorUser     string
+	collectorPassword string
+	collectorToken    string
+	// 注册插件时检查收集器是否可以访问
+	validateEndpoint bool
+	propagator       Propagator
+	// 按 OpenTelemetry 的语义约定记录 SQL 信息
+	semconv bool
+	// 记录等待连接池分配连接的耗时
+	connWait bool
+	// 预编译模式下为预编译创建 span
+	prepareSpans bool
+	// 不追踪的表，表名为小写；excludeTables 为创建时的设置，excludedTables 为当前的集合，可以通过 Reconfigure 修改
+	excludeTables  map[string]bool
+	excludedTables atomic.Value
+	// 不追踪的操作，excludeOperations 为创建时的设置，excludedOperations 为当前的集合，可以通过 Reconfigure 修改
+	excludeOperations  map[string]bool
+	excludedOperations atomic.Value
+	// SQL 信息记录在日志还是 tag 中，为空时记录在日志中
+	sqlRecordMode SQLRecordMode
+	// 记录哪些 SQL 信息，为 0 时全部记录
+	sqlFieldSet SQLField
+	// SQL 的最大长度(字节)，为 0 时不限制
+	maxSQLLength int
+	// 不记录 SQL 的参数
+	redactParams bool
+	// 参数需要替换为 *** 的字段，字段名为小写
+	maskColumns map[string]bool
+	// 记录 SQL 前依次执行的处理方法
+	sqlSanitizers []SQLSanitizer
+	// 记录 SQL 指纹，fingerprintHashed 为 true 时记录指纹的哈希值
+	fingerprintEnabled bool
+	fingerprintHashed  bool
+	// span 操作名称的模板
+	opNameTemplate *template.Template
+	// 判断是否记录为错误，为空时不记录 gorm.ErrRecordNotFound
+	errorFilter func(err error) bool
+	// 慢查询阈值，slowQuery 为创建时的设置，slowQueryThreshold 为当前的阈值(纳秒)，可以通过 Reconfigure 修改
+	slowQuery          time.Duration
+	slowQueryThreshold int64
+	slowQueryLog       bool
+	// 上报的最短执行时间，minDuration 为创建时的设置，minDurationThreshold 为当前的值(纳秒)，可以通过 Reconfigure 修改
+	minDuration          time.Duration
+	minDurationThreshold int64
+	// 出错时记录调用栈
+	errorStack bool
+	// 记录发起查询的代码位置
+	callerTags bool
+	// 获取租户 id 的方法
+	tenantExtractor TenantExtractor
+	// span 结束前调用的方法
+	spanCustomizers []SpanCustomizer
+	// 每个 span 的日志字段数量和字节数的限制
+	maxLogFields int
+	maxLogBytes  int
+	// 选项中的错误，注册插件时返回
+	optionErr error
+	// 保存 span 使用的 key，为空时使用命名空间，都为空时使用 spankey
+	spanKey string
+	// 回调事件名称的命名空间，为空时使用 istio-gorm-tracing
+	callbackNamespace string
+	// 与其他插件回调的先后顺序，orderBefore 和 orderAfter 为其他插件的前置和后置回调名称
+	callbackOrder CallbackOrder
+	orderBefore   string
+	orderAfter    string
+	dbName        string
+	// 通过 WithDSN 设置的 DSN，为空时从 dialector 中读取
+	dsn string
+	// 每个 gorm.DB 从 DSN 中解析出的连接信息，key 为 db.Callback()，同一个 gorm.DB 的会话共用
+	dsnInfos          sync.Map
+	baggageTags       map[string]string
+	parentFromContext func(ctx context.Context) opentracing.SpanContext
+	closer            io.Closer
+	// 是否由此插件设置了全局 tracer
+	global bool
+	// 为 1 时暂停追踪，通过 Disable/Enable 修改
+	disabled int32
+	// 插件创建的 tracer 使用的采样器，通过 Reconfigure 替换
+	dynamicSampler *reloadableSampler
+
+	mu     sync.RWMutex
+	tracer opentracing.Tracer
 }
 
 var (
 	// 保留 Istio 发送请求时的 header 信息(x-b3-traceid|x-b3-parentspanid|x-b3-spanid|x-b3-sampled)
+	// Deprecated: 全局变量在并发请求下会串号，请使用 WithHeaders 将 header 保存到 context 中
 	H http.Header
 	// 注册插件
 	_ gorm.Plugin = &IstioGormTracing{}
@@ -31,6 +139,30 @@ var (
 const (
 	spankey = "istio-gorm-tracing"
 
+	// span 的 component tag
+	_component = "gorm"
+
+	// envoy 生成的请求 id，tag 名称与 envoy 上报的 span 保持一致
+	_headerRequestID = "x-request-id"
+	_tagRequestID    = "guid:x-request-id"
+
+	// 数据库名称
+	_tagDBInstance = "db.instance"
+	// 从 DSN 中解析出的数据库地址和用户名
+	_tagPeerAddress = "peer.address"
+	_tagDBUser      = "db.user"
+	// 数据库类型，db.type 按 OpenTracing 的约定固定为 sql，db.system 为具体的数据库
+	_tagDBType   = "db.type"
+	_tagDBSystem = "db.system"
+	// SQL 超过最大长度被截断
+	_tagTruncated = "truncated"
+	// 写操作影响的行数和查询返回的行数
+	_tagRowsAffected = "db.rows_affected"
+	_tagRowsReturned = "db.rows_returned"
+
+	// 解析父 span 时匹配到的追踪信息格式
+	_tagPropagationFormat = "propagation.format"
+
 	// 自定义事件名称
 	_eventBeforeCreate = "istio-gorm-tracing-event:before_create"
 	_eventAfterCreate  = "istio-gorm-tracing-event:after_create"
@@ -55,12 +187,87 @@ const (
 )
 
 // 开箱即用，svcName: 此项目的微服务名称，collectorEndpoint: jaeger 收集器的地址(如:http://127.0.0.1:14268/api/traces)
-func NewDefault(svcName, collectorEndpoint string) gorm.Plugin {
+// tracer 初始化失败时返回错误，由调用方决定是否在没有追踪的情况下继续运行
+func NewDefault(svcName, collectorEndpoint string) (*IstioGormTracing, error) {
 	i := &IstioGormTracing{
 		ServiceName:       svcName,
 		CollectorEndpoint: collectorEndpoint,
 	}
-	i.bootTracerBasedJaeger()
+	if err := i.bootTracerBasedJaeger(); err != nil {
+		return nil, err
+	}
+	// 保持原有行为，设为全局使用的 tracer
+	opentracing.SetGlobalTracer(i.tracer)
+	i.global = true
+	return i, nil
+}
+
+// 通过可选配置项创建插件，未传入 tracer 时会根据配置初始化一个 jaeger tracer
+// 创建的 tracer 只给此插件使用，不会修改全局 tracer
+func New(opts ...Option) (*IstioGormTracing, error) {
+	i := &IstioGormTracing{}
+	for _, opt := range opts {
+		opt(i)
+	}
+	if i.tracer == nil {
+		if err := i.bootTracerBasedJaeger(); err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+// 通过 JAEGER_* 环境变量创建插件，如 JAEGER_ENDPOINT、JAEGER_AGENT_HOST、JAEGER_SAMPLER_TYPE、JAEGER_TAGS，
+// k8s 中部署时不需要修改代码就能调整追踪配置；svcName 为空时使用 JAEGER_SERVICE_NAME，opts 的优先级高于环境变量
+// 使用 OpenTelemetry 的 OTEL_* 环境变量时请使用 oteltracing.NewFromEnv
+func NewFromEnv(svcName string, opts ...Option) (*IstioGormTracing, error) {
+	cfg, err := config.FromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("读取 jaeger 环境变量失败, 错误原因: %w", err)
+	}
+	if cfg.Disabled {
+		return NewWithTracer(opentracing.NoopTracer{}, opts...), nil
+	}
+	if svcName == "" {
+		svcName = cfg.ServiceName
+	}
+
+	envOpts := []Option{
+		WithServiceName(svcName),
+		WithCollectorEndpoint(cfg.Reporter.CollectorEndpoint),
+		WithReporterQueueSize(cfg.Reporter.QueueSize),
+		WithReporterFlushInterval(cfg.Reporter.BufferFlushInterval),
+	}
+	if os.Getenv("JAEGER_REPORTER_LOG_SPANS") != "" {
+		envOpts = append(envOpts, WithLogSpans(cfg.Reporter.LogSpans))
+	}
+	for _, tag := range cfg.Tags {
+		envOpts = append(envOpts, WithTags(map[string]interface{}{tag.Key: tag.Value}))
+	}
+	if cfg.Gen128Bit {
+		envOpts = append(envOpts, WithGen128Bit())
+	}
+	if cfg.Reporter.User != "" {
+		envOpts = append(envOpts, WithCollectorBasicAuth(cfg.Reporter.User, cfg.Reporter.Password))
+	}
+	// 没有设置采样类型时 jaeger 默认使用远程采样，保持插件默认的全部采样
+	if os.Getenv("JAEGER_SAMPLER_TYPE") != "" {
+		envOpts = append(envOpts, WithSampler(cfg.Sampler))
+	}
+	// 与 jaeger 相同，同时设置时优先使用收集器
+	if cfg.Reporter.CollectorEndpoint == "" && (os.Getenv("JAEGER_AGENT_HOST") != "" || os.Getenv("JAEGER_AGENT_PORT") != "") {
+		envOpts = append(envOpts, WithAgentHostPort(cfg.Reporter.LocalAgentHostPort))
+	}
+	return New(append(envOpts, opts...)...)
+}
+
+// 使用外部创建好的 tracer，插件不会再自行创建 tracer，也不会修改全局 tracer
+func NewWithTracer(tracer opentracing.Tracer, opts ...Option) *IstioGormTracing {
+	i := &IstioGormTracing{}
+	for _, opt := range opts {
+		opt(i)
+	}
+	i.tracer = tracer
 	return i
 }
 
@@ -71,52 +278,209 @@ func (i *IstioGormTracing) Name() string {
 
 // 实现 gorm 插件所需方法
 func (i *IstioGormTracing) Initialize(db *gorm.DB) (err error) {
+	if i.optionErr != nil {
+		return i.optionErr
+	}
+	if i.validateEndpoint && i.CollectorEndpoint != "" {
+		if err := i.checkEndpoint(); err != nil {
+			return err
+		}
+	}
+	i.loadDSN(db)
+	// 同一个 gorm.DB 重复注册时，由当前实例注册的直接跳过，由其他实例注册的替换为当前实例
+	switch owner := i.callbackOwner(db); {
+	case owner == i:
+		return nil
+	case owner != nil:
+		if err := owner.Remove(db); err != nil {
+			return err
+		}
+	default:
+		if name := i.registeredEvent(db); name != "" {
+			return fmt.Errorf("%w: %s", ErrCallbackConflict, name)
+		}
+	}
 	// 在 gorm 中注册各种回调事件
+	create, update, query := i.hookAnchors(db, _opCreate), i.hookAnchors(db, _opUpdate), i.hookAnchors(db, _opQuery)
+	del, row, raw := i.hookAnchors(db, _opDelete), i.hookAnchors(db, _opRow), i.hookAnchors(db, _opRaw)
 	for _, e := range []error{
-		db.Callback().Create().Before("gorm:create").Register(_eventBeforeCreate, beforeCreate),
-		db.Callback().Create().After("gorm:create").Register(_eventAfterCreate, after),
-		db.Callback().Update().Before("gorm:update").Register(_eventBeforeUpdate, beforeUpdate),
-		db.Callback().Update().After("gorm:update").Register(_eventAfterUpdate, after),
-		db.Callback().Query().Before("gorm:query").Register(_eventBeforeQuery, beforeQuery),
-		db.Callback().Query().After("gorm:query").Register(_eventAfterQuery, after),
-		db.Callback().Delete().Before("gorm:delete").Register(_eventBeforeDelete, beforeDelete),
-		db.Callback().Delete().After("gorm:delete").Register(_eventAfterDelete, after),
-		db.Callback().Row().Before("gorm:row").Register(_eventBeforeRow, beforeRow),
-		db.Callback().Row().After("gorm:row").Register(_eventAfterRow, after),
-		db.Callback().Raw().Before("gorm:raw").Register(_eventBeforeRaw, beforeRaw),
-		db.Callback().Raw().After("gorm:raw").Register(_eventAfterRaw, after),
+		db.Callback().Create().Before(create.beforeHookBefore).After(create.beforeHookAfter).Register(i.eventName(_eventBeforeCreate), i.beforeCreate),
+		db.Callback().Create().After(create.afterHookAfter).Before(create.afterHookBefore).Register(i.eventName(_eventAfterCreate), i.afterCreate),
+		db.Callback().Create().After("gorm:before_create").Before("gorm:save_before_associations").Register(i.eventName(_eventBeforeSaveBeforeAssociations), i.beforeSaveAssociations(true, true)),
+		db.Callback().Create().After("gorm:save_before_associations").Before("gorm:create").Register(i.eventName(_eventAfterSaveBeforeAssociations), i.afterSaveAssociations),
+		db.Callback().Create().After("gorm:create").Before("gorm:save_after_associations").Register(i.eventName(_eventBeforeSaveAfterAssociations), i.beforeSaveAssociations(true, false)),
+		db.Callback().Create().After("gorm:save_after_associations").Before("gorm:after_create").Register(i.eventName(_eventAfterSaveAfterAssociations), i.afterSaveAssociations),
+		db.Callback().Update().Before(update.beforeHookBefore).After(update.beforeHookAfter).Register(i.eventName(_eventBeforeUpdate), i.beforeUpdate),
+		db.Callback().Update().After(update.afterHookAfter).Before(update.afterHookBefore).Register(i.eventName(_eventAfterUpdate), i.afterUpdate),
+		db.Callback().Update().After("gorm:before_update").Before("gorm:save_before_associations").Register(i.eventName(_eventBeforeSaveBeforeAssociations), i.beforeSaveAssociations(false, true)),
+		db.Callback().Update().After("gorm:save_before_associations").Before("gorm:update").Register(i.eventName(_eventAfterSaveBeforeAssociations), i.afterSaveAssociations),
+		db.Callback().Update().After("gorm:update").Before("gorm:save_after_associations").Register(i.eventName(_eventBeforeSaveAfterAssociations), i.beforeSaveAssociations(false, false)),
+		db.Callback().Update().After("gorm:save_after_associations").Before("gorm:after_update").Register(i.eventName(_eventAfterSaveAfterAssociations), i.afterSaveAssociations),
+		db.Callback().Query().Before(query.beforeHookBefore).After(query.beforeHookAfter).Register(i.eventName(_eventBeforeQuery), i.beforeQuery),
+		db.Callback().Query().After(query.afterHookAfter).Before(query.afterHookBefore).Register(i.eventName(_eventAfterQuery), i.afterQuery),
+		db.Callback().Query().Before("gorm:preload").Register(i.eventName(_eventBeforePreload), i.beforePreload),
+		db.Callback().Query().After("gorm:preload").Register(i.eventName(_eventAfterPreload), i.afterPreload),
+		db.Callback().Delete().Before(del.beforeHookBefore).After(del.beforeHookAfter).Register(i.eventName(_eventBeforeDelete), i.beforeDelete),
+		db.Callback().Delete().After(del.afterHookAfter).Before(del.afterHookBefore).Register(i.eventName(_eventAfterDelete), i.afterDelete),
+		db.Callback().Row().Before(row.beforeHookBefore).After(row.beforeHookAfter).Register(i.eventName(_eventBeforeRow), i.beforeRow),
+		db.Callback().Row().After(row.afterHookAfter).Before(row.afterHookBefore).Register(i.eventName(_eventAfterRow), i.afterRow),
+		db.Callback().Raw().Before(raw.beforeHookBefore).After(raw.beforeHookAfter).Register(i.eventName(_eventBeforeRaw), i.beforeRaw),
+		db.Callback().Raw().After(raw.afterHookAfter).Before(raw.afterHookBefore).Register(i.eventName(_eventAfterRaw), i.afterRaw),
 	} {
 		if e != nil {
 			return e
 		}
 	}
+	i.setCallbackOwner(db)
 	return
 }
 
+// 注销 Initialize 注册的回调事件，之后可以重新调用 db.Use 注册，用于测试或重新创建 gorm.DB 的场景
+func (i *IstioGormTracing) Remove(db *gorm.DB) error {
+	for _, e := range i.callbackEvents(db) {
+		if err := e.processor.Remove(e.name); err != nil {
+			return err
+		}
+	}
+	i.dsnInfos.Delete(dsnKey(db))
+	// 从 gorm 已注册的插件中删除，否则再次 db.Use 会返回 gorm.ErrRegistered
+	i.removeCallbackOwner(db)
+	if p, ok := db.Plugins[i.Name()]; ok && p == i {
+		delete(db.Plugins, i.Name())
+	}
+	return nil
+}
+
+// 暂停追踪，之后的 SQL 不再创建 span，出现故障时可以在不重启服务的情况下关闭追踪
+// 已经开始的 span 仍会正常结束并上报
+func (i *IstioGormTracing) Disable() {
+	atomic.StoreInt32(&i.disabled, 1)
+}
+
+// 恢复追踪
+func (i *IstioGormTracing) Enable() {
+	atomic.StoreInt32(&i.disabled, 0)
+}
+
+// 是否正在追踪
+func (i *IstioGormTracing) Enabled() bool {
+	return atomic.LoadInt32(&i.disabled) == 0
+}
+
 // 注册各种前置事件时，对应的事件方法
-func _injectBefore(db *gorm.DB, op string) {
+func (i *IstioGormTracing) _injectBefore(db *gorm.DB, op string) {
 
 	if db == nil {
 		return
 	}
 
+	if !i.Enabled() {
+		return
+	}
+
 	if db.Statement == nil || db.Statement.Context == nil {
 		db.Logger.Error(context.TODO(), "未定义 db.Statement 或 db.Statement.Context")
 		return
 	}
 
-	// 这里是关键，通过 istio 传过来的 header 解析出父 span，如果没有，则会创建新的根 span
-	zipkinPropagator := zipkin.NewZipkinB3HTTPHeaderPropagator()
-	spanCtx, err := zipkinPropagator.Extract(opentracing.HTTPHeadersCarrier(H))
-	if err != nil {
-		log.Printf("jaeger span 解析失败, 错误原因: %v", err)
+	// DryRun 和 ToSQL 只生成 SQL，不会访问数据库
+	if db.DryRun || skipTracing(db) || i.excludedOperation(db, op) || i.excludedTable(db) {
+		return
+	}
+
+	// 这里是关键，父 span 的优先级为: context 中已有的 span > 其他追踪 API 的 span > istio 传过来的 header > 新的根 span
+	// context 中已有 span 时(如 http/grpc 服务端 span)，由 StartSpanFromContextWithTracer 将其作为父 span
+	// header 优先从 context 中获取，兼容旧的全局变量 H
+	h := headersFromContext(db.Statement.Context)
+	opts := i.parentOptions(db.Statement.Context, h)
+	// 标记为客户端 span，jaeger 才会在服务依赖图中将数据库显示为下游服务
+	opts = append(opts, ext.SpanKindRPCClient, opentracing.Tag{Key: string(ext.Component), Value: _component})
+	for _, tag := range i.spanTags {
+		opts = append(opts, tag)
+	}
+	ctx := db.Statement.Context
+	if op == _opQuery {
+		ctx = startBatchSpan(ctx)
+	}
+	name := op
+	finisher := finisherOf(db, op)
+	if finisher != "" {
+		name = finisher
+		opts = append(opts, opentracing.Tag{Key: _tagFinisher, Value: finisher})
+	}
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, i.getTracer(), operationName(db, name), opts...)
+	if atomic.LoadInt64(&i.minDurationThreshold) > 0 {
+		span = newPendingSpan(span, ctx)
+	}
+	i.applyBaggage(span, h)
+	i.setTenantTag(span, db.Statement.Context)
+	// envoy 生成的请求 id，即使整条链路没有被采样，也能通过它与 envoy 的访问日志关联
+	if requestID := h.Get(_headerRequestID); requestID != "" {
+		span.SetTag(_tagRequestID, requestID)
+	}
+	if route := routeFromContext(db.Statement.Context); route != "" {
+		span.SetTag(_tagRoute, route)
+	}
+	span.SetTag(_tagDBType, "sql")
+	if system := dbSystemOf(db); system != "" {
+		span.SetTag(_tagDBSystem, system)
+	}
+	if info, ok := i.dsnInfoOf(db); ok {
+		if info.Address != "" {
+			span.SetTag(_tagPeerAddress, info.Address)
+		}
+		if info.User != "" {
+			span.SetTag(_tagDBUser, info.User)
+		}
+	}
+	dbName := i.dbInstance(db)
+	if dbName != "" {
+		span.SetTag(_tagDBInstance, dbName)
+	}
+	// 依赖图中数据库节点的名称，没有库名时使用数据库类型
+	if peer := firstNonEmpty(dbName, dbSystemOf(db)); peer != "" {
+		ext.PeerService.Set(span, peer)
+	}
+	if i.callerTags && spanSampled(span) {
+		setCallerTags(span)
+	}
+	setTransactionTag(span, db)
+	span.SetTag(_tagPluginVersion, Version())
+	span.SetTag(_tagGormVersion, gormModuleVersion())
+	db.InstanceSet(i.getSpanKey(), span)
+	if i.timed() {
+		db.InstanceSet(i.startTimeKey(), time.Now())
+	}
+	i.markPrepared(db)
+	if i.prepareSpans {
+		i.wrapPreparedStmt(span, db)
+	}
+	// Row、Rows 的结果由调用方读取，连接在回调结束后仍被占用，不记录
+	if i.connWait && op != _opRow {
+		i.wrapConnPool(db)
+	}
+}
+
+// context 中没有 span 时，从其他追踪 API 或 header 中解析父 span
+func (i *IstioGormTracing) parentOptions(ctx context.Context, h http.Header) []opentracing.StartSpanOption {
+	var opts []opentracing.StartSpanOption
+	if opentracing.SpanFromContext(ctx) == nil {
+		if spanCtx := i.parentFromOtherAPI(ctx); spanCtx != nil {
+			opts = append(opts, opentracing.ChildOf(spanCtx))
+		} else if spanCtx, format, err := i.extractParent(h); err != nil {
+			i.getLogger().Error("jaeger span 解析失败, 错误原因: " + err.Error())
+		} else {
+			opts = append(opts, opentracing.ChildOf(spanCtx))
+			if format != "" {
+				opts = append(opts, opentracing.Tag{Key: _tagPropagationFormat, Value: format})
+			}
+		}
 	}
-	span, _ := opentracing.StartSpanFromContext(db.Statement.Context, op, opentracing.ChildOf(spanCtx))
-	db.InstanceSet(spankey, span)
+	return opts
 }
 
 // 注册后置事件时，对应的事件方法
-func after(db *gorm.DB) {
+func (i *IstioGormTracing) _injectAfter(db *gorm.DB, op string) {
 
 	if db == nil {
 		return
@@ -127,7 +491,7 @@ func after(db *gorm.DB) {
 		return
 	}
 
-	_span, isExist := db.InstanceGet(spankey)
+	_span, isExist := db.InstanceGet(i.getSpanKey())
 	if !isExist || _span == nil {
 		return
 	}
@@ -137,74 +501,292 @@ func after(db *gorm.DB) {
 	if !ok || span == nil {
 		return
 	}
-	defer span.Finish()
+	defer i.finishSpan(span, db)
+	span = i.limitLogs(span)
+	// 在插件记录完所有信息之后、span 结束之前调用
+	defer i.customizeSpan(span, db)
+
+	// 记录error，标记 error=true 后 jaeger 才会将 span 显示为出错；被过滤的错误(默认为 gorm.ErrRecordNotFound)不记录
+	failed := db.Error != nil && i.isError(db.Error)
+	if failed {
+		setSpanError(span, db.Error)
+		if i.errorStack {
+			span.LogFields(opentracinglog.String(_fieldStack, stackTrace()))
+		}
+	}
 
-	// 记录error
-	if db.Error != nil {
-		span.LogFields(opentracinglog.Error(db.Error))
+	// 影响的行数，可以发现没有条件的全表更新；Row 查询时 gorm 不知道返回的行数
+	switch op {
+	case _opCreate, _opUpdate, _opDelete, _opRaw:
+		span.SetTag(_tagRowsAffected, db.RowsAffected)
+	case _opQuery:
+		if !failed {
+			span.SetTag(_tagRowsReturned, db.RowsAffected)
+		}
 	}
 
-	b, err := json.Marshal(db.Statement.Vars)
-	if err != nil {
-		span.LogFields(opentracinglog.Error(err))
+	i.markSlowQuery(span, db)
+	setClauseTags(span, db, op)
+	setModelTags(span, db)
+	if op == _opQuery {
+		setPreloadTag(span, db)
+	}
+	i.setPreparedTags(span, db)
+	i.unwrapPreparedStmt(db)
+	i.unwrapConnPool(span, db)
+	if op == _opCreate && !failed {
+		setInsertIDTag(span, db)
+	}
+	if !failed {
+		setBatchSizeTag(span, db, op)
+	}
+	// 保存点操作使用固定的名称，不使用操作名称模板
+	savepoint := op == _opRaw && setSavepointTags(span, db.Statement.SQL.String(), customOperationName(db) != "")
+	if name, ok := i.renameOperation(db, op); ok && !savepoint {
+		span.SetOperationName(name)
+	} else if op == _opRaw && !savepoint && customOperationName(db) == "" {
+		// Raw 和 Exec 的 span 按 SQL 的操作类型命名，如 select、insert、ddl
+		if name := rawOperationName(db.Statement.SQL.String()); name != "" {
+			span.SetOperationName(name)
+		}
+	}
+
+	// 隐私模式下只记录带占位符的 SQL，参数可能包含邮箱、token、密码等敏感信息
+	sql := db.Statement.SQL.String()
+	vars := maskVars(sql, db.Statement.Vars, i.maskColumns)
+	if !i.redactParams {
+		sql = db.Dialector.Explain(sql, vars...)
+	}
+	sql = i.sanitize(sql)
+	if i.fingerprintEnabled {
+		fp := fingerprint(db.Statement.SQL.String())
+		if i.fingerprintHashed {
+			fp = hashFingerprint(fp)
+		}
+		span.SetTag(_tagFingerprint, fp)
+	}
+	if i.semconv {
+		i.setSemconvTags(span, db, op, sql)
+		return
 	}
 
 	// 记录其他内容
-	span.LogFields(
-		opentracinglog.String("sql", db.Dialector.Explain(db.Statement.SQL.String(), db.Statement.Vars...)),
-		opentracinglog.String("table", db.Statement.Table),
-		opentracinglog.String("query", db.Statement.SQL.String()),
-		opentracinglog.String("bindings", string(b)),
-	)
+	fields := append([]opentracinglog.Field{opentracinglog.String(_fieldTable, statementTable(db))}, i.sqlFields(span, db, sql, vars)...)
+	if i.sqlRecordMode != SQLAsTags {
+		span.LogFields(fields...)
+	}
+	// jaeger 只能按 tag 搜索，记录为 tag 后可以按表名或 SQL 查找
+	if i.sqlRecordMode == SQLAsTags || i.sqlRecordMode == SQLAsLogsAndTags {
+		for _, field := range fields {
+			span.SetTag(field.Key(), field.Value())
+		}
+	}
+
+}
+
+func (i *IstioGormTracing) beforeCreate(db *gorm.DB) {
+	i._injectBefore(db, _opCreate)
+}
+
+func (i *IstioGormTracing) beforeUpdate(db *gorm.DB) {
+	i._injectBefore(db, _opUpdate)
+}
+
+func (i *IstioGormTracing) beforeQuery(db *gorm.DB) {
+	i._injectBefore(db, _opQuery)
+}
+
+func (i *IstioGormTracing) beforeDelete(db *gorm.DB) {
+	i._injectBefore(db, _opDelete)
+}
+
+func (i *IstioGormTracing) beforeRow(db *gorm.DB) {
+	i._injectBefore(db, _opRow)
+}
+
+func (i *IstioGormTracing) beforeRaw(db *gorm.DB) {
+	i._injectBefore(db, _opRaw)
+}
+
+func (i *IstioGormTracing) afterCreate(db *gorm.DB) {
+	i._injectAfter(db, _opCreate)
+}
+
+func (i *IstioGormTracing) afterUpdate(db *gorm.DB) {
+	i._injectAfter(db, _opUpdate)
+}
 
+func (i *IstioGormTracing) afterQuery(db *gorm.DB) {
+	i._injectAfter(db, _opQuery)
 }
 
-func beforeCreate(db *gorm.DB) {
-	_injectBefore(db, _opCreate)
+func (i *IstioGormTracing) afterDelete(db *gorm.DB) {
+	i._injectAfter(db, _opDelete)
 }
 
-func beforeUpdate(db *gorm.DB) {
-	_injectBefore(db, _opUpdate)
+func (i *IstioGormTracing) afterRow(db *gorm.DB) {
+	i._injectAfter(db, _opRow)
 }
 
-func beforeQuery(db *gorm.DB) {
-	_injectBefore(db, _opQuery)
+func (i *IstioGormTracing) afterRaw(db *gorm.DB) {
+	i._injectAfter(db, _opRaw)
 }
 
-func beforeDelete(db *gorm.DB) {
-	_injectBefore(db, _opDelete)
+// 通过 WithParentFromContext 设置的方法从 context 中获取其他追踪 API(如 OpenTelemetry)的 span
+func (i *IstioGormTracing) parentFromOtherAPI(ctx context.Context) opentracing.SpanContext {
+	if i.parentFromContext == nil {
+		return nil
+	}
+	return i.parentFromContext(ctx)
 }
 
-func beforeRow(db *gorm.DB) {
-	_injectBefore(db, _opRow)
+// 获取插件使用的 tracer，未设置时使用全局 tracer
+func (i *IstioGormTracing) getTracer() opentracing.Tracer {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.tracer != nil {
+		return i.tracer
+	}
+	return opentracing.GlobalTracer()
 }
 
-func beforeRaw(db *gorm.DB) {
-	_injectBefore(db, _opRaw)
+// 在 gorm.Statement 中保存 span 使用的 key
+func (i *IstioGormTracing) getSpanKey() string {
+	if i.spanKey != "" {
+		return i.spanKey
+	}
+	if i.callbackNamespace != "" {
+		return i.callbackNamespace
+	}
+	return spankey
+}
+
+// 插件内部使用的日志组件，未设置时使用 jaegerlog.StdLogger
+func (i *IstioGormTracing) getLogger() jaeger.Logger {
+	if i.logger != nil {
+		return i.logger
+	}
+	return jaegerlog.StdLogger
 }
 
 // 默认初始化一个 jaeger tracer
-func (i *IstioGormTracing) bootTracerBasedJaeger() {
+func (i *IstioGormTracing) bootTracerBasedJaeger() error {
+	sampler := i.samplerConfig()
+	// 包装一层，便于通过 Reconfigure 替换
+	s, err := sampler.NewSampler(i.ServiceName, jaeger.NewNullMetrics())
+	if err != nil {
+		return fmt.Errorf("jaeger tracer 插件初始化失败, 错误原因: %w", err)
+	}
+	dynamic := newReloadableSampler(s)
+	logger := i.getLogger()
+	// WithReporter 传入的插件内置 reporter 也使用同一个日志组件
+	if i.logger != nil {
+		for _, r := range i.reporters {
+			if s, ok := r.(loggerSetter); ok {
+				s.setLogger(logger)
+			}
+		}
+	}
+
+	reporterOpts := []jaeger.ReporterOption{jaeger.ReporterOptions.Logger(logger)}
+	if i.reporterQueueSize > 0 {
+		reporterOpts = append(reporterOpts, jaeger.ReporterOptions.QueueSize(i.reporterQueueSize))
+	}
+	if i.reporterFlushInterval > 0 {
+		reporterOpts = append(reporterOpts, jaeger.ReporterOptions.BufferFlushInterval(i.reporterFlushInterval))
+	}
+	reporters := append([]jaeger.Reporter(nil), i.reporters...)
+	if i.agentHostPort != "" {
+		// jaeger 的配置中不能设置 UDP 包的大小，需要自己创建 reporter
+		udp, err := jaeger.NewUDPTransport(i.agentHostPort, i.maxPacketSize)
+		if err != nil {
+			return fmt.Errorf("jaeger agent 连接失败, 错误原因: %w", err)
+		}
+		reporters = append(reporters, jaeger.NewRemoteReporter(udp, reporterOpts...))
+	}
+	// 同时设置了收集器地址时，收集器作为其中一个后端，便于迁移期间同时上报到新旧两套系统
+	// jaeger 的配置中不能设置 TLS、token 和每批的数量，需要时也自己创建 reporter
+	if i.CollectorEndpoint != "" && (len(reporters) > 0 || i.collectorTLS != nil || i.collectorUser != "" || i.collectorToken != "" || i.reporterBatchSize > 0) {
+		reporters = append(reporters, jaeger.NewRemoteReporter(i.newCollectorTransport(), reporterOpts...))
+	}
+	logSpans := len(reporters) == 0
+	if i.logSpans != nil {
+		logSpans = *i.logSpans
+	}
+	if logSpans && len(reporters) > 0 {
+		reporters = append(reporters, jaeger.NewLoggingReporter(logger))
+	}
+
+	opts := []config.Option{config.Logger(logger), config.Sampler(dynamic)}
+	// 只设置了 WithReporter 或 WithAgentHostPort 时不再上报到 jaeger 收集器
+	switch len(reporters) {
+	case 0:
+	case 1:
+		opts = append(opts, config.Reporter(reporters[0]))
+	default:
+		opts = append(opts, config.Reporter(newMultiReporter(logger, reporters...)))
+	}
+
 	// 基础配置
-	tracer, _, err := config.Configuration{
-		Sampler: &config.SamplerConfig{
-			Type:  jaeger.SamplerTypeConst,
-			Param: 1,
-		},
+	tracer, closer, err := config.Configuration{
+		Sampler:     sampler,
 		ServiceName: i.ServiceName,
 		Reporter: &config.ReporterConfig{
-			LogSpans:          true,
-			CollectorEndpoint: i.CollectorEndpoint,
+			QueueSize:           i.reporterQueueSize,
+			BufferFlushInterval: i.reporterFlushInterval,
+			LogSpans:            logSpans,
+			CollectorEndpoint:   i.CollectorEndpoint,
 		},
-	}.NewTracer(
-		config.Logger(jaegerlog.StdLogger),
-	)
+		Tags:      i.tags,
+		Gen128Bit: i.gen128Bit,
+	}.NewTracer(opts...)
 
 	if err != nil {
-		log.Printf("jaeger tracer 插件初始化失败, 错误原因: %v", err)
-		os.Exit(1)
+		dynamic.Close()
+		return fmt.Errorf("jaeger tracer 插件初始化失败, 错误原因: %w", err)
 	}
 
-	// 设为全局使用的 tracer
-	opentracing.SetGlobalTracer(tracer)
+	i.tracer = tracer
+	i.closer = closer
+	i.dynamicSampler = dynamic
+	return nil
+}
+
+// 通过 http 上报到 jaeger 收集器
+func (i *IstioGormTracing) newCollectorTransport() jaeger.Transport {
+	var opts []transport.HTTPOption
+	if i.collectorTLS != nil {
+		opts = append(opts, transport.HTTPRoundTripper(&http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: i.collectorTLS,
+		}))
+	}
+	if i.collectorUser != "" {
+		opts = append(opts, transport.HTTPBasicAuth(i.collectorUser, i.collectorPassword))
+	}
+	if i.reporterBatchSize > 0 {
+		opts = append(opts, transport.HTTPBatchSize(i.reporterBatchSize))
+	}
+	if i.collectorToken != "" {
+		opts = append(opts, transport.HTTPHeaders(map[string]string{"Authorization": "Bearer " + i.collectorToken}))
+	}
+	return transport.NewHTTPTransport(i.CollectorEndpoint, opts...)
+}
+
+// 关闭插件创建的 tracer，会将缓冲队列中还未上报的 span 全部发送出去，应在服务退出前调用
+// 使用外部传入的 tracer 时不做任何处理，由创建方负责关闭
+// 关闭后插件及其设置的全局 tracer 都会替换为 NoopTracer，之后的查询不再上报
+func (i *IstioGormTracing) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.closer == nil {
+		return nil
+	}
+	if i.global && opentracing.GlobalTracer() == i.tracer {
+		opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	}
+	err := i.closer.Close()
+	i.closer = nil
+	i.tracer = opentracing.NoopTracer{}
+	return err
 }
@@ -0,0 +1,600 @@
+package istiogormtracing
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/uber/jaeger-client-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+)
+
+// 不连接数据库的 dialector，SQL 由测试驱动 fakeDriver 执行
+type fakeDialector struct{}
+
+func (fakeDialector) Name() string { return "fake" }
+func (fakeDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	sqlDB, err := sql.Open("istio-gorm-tracing-fake", "")
+	if err != nil {
+		return err
+	}
+	db.ConnPool = sqlDB
+	return nil
+}
+func (fakeDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return migrator.Migrator{Config: migrator.Config{DB: db, Dialector: fakeDialector{}}}
+}
+func (fakeDialector) DataTypeOf(*schema.Field) string                             { return "" }
+func (fakeDialector) DefaultValueOf(*schema.Field) clause.Expression              { return nil }
+func (fakeDialector) BindVarTo(w clause.Writer, _ *gorm.Statement, _ interface{}) { w.WriteByte('?') }
+func (fakeDialector) QuoteTo(w clause.Writer, s string)                           { w.WriteString(s) }
+func (fakeDialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, nil, `'`, vars...)
+}
+
+// 与 mysql 驱动相同，通过保存点实现嵌套事务
+func (fakeDialector) SavePoint(tx *gorm.DB, name string) error {
+	return tx.Exec("SAVEPOINT " + name).Error
+}
+func (fakeDialector) RollbackTo(tx *gorm.DB, name string) error {
+	return tx.Exec("ROLLBACK TO SAVEPOINT " + name).Error
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// 只执行前置回调，取出创建的 span
+func startSpan(t *testing.T, i *IstioGormTracing, ctx context.Context) *mocktracer.MockSpan {
+	t.Helper()
+	db := &gorm.DB{Config: &gorm.Config{}, Statement: &gorm.Statement{Context: ctx}}
+	i.beforeQuery(db)
+	v, ok := db.InstanceGet(spankey)
+	if !ok {
+		t.Fatal("span not set")
+	}
+	span := v.(*mocktracer.MockSpan)
+	span.Finish()
+	return span
+}
+
+func TestNewWithTracerNonJaeger(t *testing.T) {
+	tracer := mocktracer.New()
+	i := NewWithTracer(tracer)
+
+	// 没有 header 时创建根 span
+	span := startSpan(t, i, context.Background())
+	if span.ParentID != 0 {
+		t.Errorf("parent id = %d, want root span", span.ParentID)
+	}
+
+	// 有 header 时交给 tracer 自己解析
+	parent := tracer.StartSpan("http")
+	h := http.Header{}
+	if err := tracer.Inject(parent.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h)); err != nil {
+		t.Fatal(err)
+	}
+	span = startSpan(t, i, WithHeaders(context.Background(), h))
+	want := parent.Context().(mocktracer.MockSpanContext)
+	if span.ParentID != want.SpanID || span.SpanContext.TraceID != want.TraceID {
+		t.Errorf("span = %d/%d, want child of %d/%d", span.SpanContext.TraceID, span.ParentID, want.TraceID, want.SpanID)
+	}
+}
+
+func TestRequestIDTag(t *testing.T) {
+	i := NewWithTracer(mocktracer.New())
+	h := http.Header{}
+	h.Set("x-request-id", "3b6f5a3e-9c1d-4e8a-b1f2-7d0c2e4a5b6c")
+	span := startSpan(t, i, WithHeaders(context.Background(), h))
+	if got := span.Tag(_tagRequestID); got != "3b6f5a3e-9c1d-4e8a-b1f2-7d0c2e4a5b6c" {
+		t.Errorf("%s = %v", _tagRequestID, got)
+	}
+
+	// 没有 x-request-id 时不记录
+	span = startSpan(t, i, WithHeaders(context.Background(), http.Header{}))
+	if _, ok := span.Tags()[_tagRequestID]; ok {
+		t.Errorf("%s should not be recorded without the header", _tagRequestID)
+	}
+}
+
+func TestCloseResetsTracers(t *testing.T) {
+	old := opentracing.GlobalTracer()
+	defer opentracing.SetGlobalTracer(old)
+
+	i, err := NewDefault("istio-gorm-tracing-test", "http://127.0.0.1:14268/api/traces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opentracing.GlobalTracer() != i.getTracer() {
+		t.Fatal("NewDefault should register the global tracer")
+	}
+
+	if err := i.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := opentracing.GlobalTracer().(opentracing.NoopTracer); !ok {
+		t.Errorf("global tracer = %T, want NoopTracer", opentracing.GlobalTracer())
+	}
+	if _, ok := i.getTracer().(opentracing.NoopTracer); !ok {
+		t.Errorf("plugin tracer = %T, want NoopTracer", i.getTracer())
+	}
+	if err := i.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestPreferSpanInContext(t *testing.T) {
+	tracer := mocktracer.New()
+	i := NewWithTracer(tracer)
+
+	// header 中的父 span 与 context 中的 span 不同时，以 context 中的为准
+	upstream := tracer.StartSpan("upstream")
+	h := http.Header{}
+	if err := tracer.Inject(upstream.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h)); err != nil {
+		t.Fatal(err)
+	}
+	server := tracer.StartSpan("server", opentracing.ChildOf(upstream.Context()))
+	ctx := opentracing.ContextWithSpan(WithHeaders(context.Background(), h), server)
+
+	span := startSpan(t, i, ctx)
+	want := server.Context().(mocktracer.MockSpanContext)
+	if span.ParentID != want.SpanID || span.SpanContext.TraceID != want.TraceID {
+		t.Errorf("span = %d/%d, want child of %d/%d", span.SpanContext.TraceID, span.ParentID, want.TraceID, want.SpanID)
+	}
+}
+
+func TestWithParentFromContext(t *testing.T) {
+	tracer := mocktracer.New()
+	other := tracer.StartSpan("other-api")
+	i := NewWithTracer(tracer, WithParentFromContext(func(ctx context.Context) opentracing.SpanContext {
+		return other.Context()
+	}))
+
+	span := startSpan(t, i, context.Background())
+	want := other.Context().(mocktracer.MockSpanContext)
+	if span.ParentID != want.SpanID {
+		t.Errorf("parent id = %d, want %d", span.ParentID, want.SpanID)
+	}
+
+	// context 中有 opentracing 的 span 时优先使用
+	server := tracer.StartSpan("server")
+	span = startSpan(t, i, opentracing.ContextWithSpan(context.Background(), server))
+	if span.ParentID != server.Context().(mocktracer.MockSpanContext).SpanID {
+		t.Errorf("parent id = %d, want server span", span.ParentID)
+	}
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func TestWithCloser(t *testing.T) {
+	closed := 0
+	i := NewWithTracer(mocktracer.New(), WithCloser(closerFunc(func() error {
+		closed++
+		return nil
+	})))
+	if err := i.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if closed != 1 {
+		t.Errorf("closed %d times, want 1", closed)
+	}
+}
+
+func TestWithAgentHostPort(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	i, err := New(WithServiceName("istio-gorm-tracing-test"), WithAgentHostPort(conn.LocalAddr().String()), WithMaxPacketSize(8192))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.getTracer().StartSpan(_opQuery).Finish()
+	if err := i.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 8192)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read udp: %v", err)
+	}
+	if n == 0 {
+		t.Error("empty packet")
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	host, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+
+	env := map[string]string{
+		"JAEGER_SERVICE_NAME":  "istio-gorm-tracing-env",
+		"JAEGER_AGENT_HOST":    host,
+		"JAEGER_AGENT_PORT":    port,
+		"JAEGER_SAMPLER_TYPE":  "probabilistic",
+		"JAEGER_SAMPLER_PARAM": "0",
+		"JAEGER_TAGS":          "cluster=test",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	i, err := NewFromEnv("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	if i.ServiceName != "istio-gorm-tracing-env" || i.agentHostPort != conn.LocalAddr().String() {
+		t.Errorf("service = %s, agent = %s", i.ServiceName, i.agentHostPort)
+	}
+	if i.sampler == nil || i.sampler.Type != "probabilistic" {
+		t.Errorf("sampler = %+v", i.sampler)
+	}
+	if len(i.tags) != 1 || i.tags[0].Key != "cluster" || i.tags[0].Value != "test" {
+		t.Errorf("tags = %+v", i.tags)
+	}
+	if span := i.getTracer().StartSpan(_opQuery); span.Context().(jaeger.SpanContext).IsSampled() {
+		t.Error("span sampled with probabilistic param 0")
+	}
+}
+
+func TestSamplerOptions(t *testing.T) {
+	sampled := func(i *IstioGormTracing) bool {
+		span := i.getTracer().StartSpan(_opQuery)
+		defer span.Finish()
+		return span.Context().(jaeger.SpanContext).IsSampled()
+	}
+
+	i, err := New(WithServiceName("istio-gorm-tracing-test"), WithReporter(jaeger.NewNullReporter()), WithProbabilisticSampler(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampled(i) {
+		t.Error("probabilistic 0 sampled")
+	}
+	i.Close()
+
+	i, err = New(WithServiceName("istio-gorm-tracing-test"), WithReporter(jaeger.NewNullReporter()), WithRateLimitingSampler(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sampled(i) || sampled(i) {
+		t.Error("rate limiting 1/s should sample only the first span")
+	}
+	i.Close()
+
+	// 拉取到的策略为不采样，之前使用初始的全部采样
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"strategyType":"PROBABILISTIC","probabilisticSampling":{"samplingRate":0}}`))
+	}))
+	defer server.Close()
+	i, err = New(WithServiceName("istio-gorm-tracing-test"), WithReporter(jaeger.NewNullReporter()), WithRemoteSampler(server.URL, 10*time.Millisecond, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for sampled(i) {
+		if time.Now().After(deadline) {
+			t.Fatal("remote strategy not applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPerOperationSampling(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("service") != "istio-gorm-tracing-test" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"operationSampling":{"defaultSamplingProbability":1,"defaultLowerBoundTracesPerSecond":0,` +
+			`"perOperationStrategies":[{"operation":"query","probabilisticSampling":{"samplingRate":0}}]}}`))
+	}))
+	defer server.Close()
+
+	i, err := New(
+		WithServiceName("istio-gorm-tracing-test"),
+		WithReporter(jaeger.NewNullReporter()),
+		WithRemoteSampler(server.URL, 10*time.Millisecond, 1),
+		WithSamplingMaxOperations(10),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	sampled := func(op string) bool {
+		span := i.getTracer().StartSpan(op)
+		defer span.Finish()
+		return span.Context().(jaeger.SpanContext).IsSampled()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sampled(_opQuery) {
+		if time.Now().After(deadline) {
+			t.Fatal("per-operation strategy not applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !sampled(_opCreate) {
+		t.Error("create should use the default probability")
+	}
+}
+
+func TestDisableEnable(t *testing.T) {
+	tracer := mocktracer.New()
+	i := NewWithTracer(tracer)
+
+	i.Disable()
+	db := &gorm.DB{Config: &gorm.Config{}, Statement: &gorm.Statement{Context: context.Background()}}
+	i.beforeQuery(db)
+	if _, ok := db.InstanceGet(spankey); ok || i.Enabled() {
+		t.Fatal("span created while disabled")
+	}
+
+	i.Enable()
+	startSpan(t, i, context.Background())
+	if !i.Enabled() || len(tracer.FinishedSpans()) != 1 {
+		t.Errorf("spans = %d after enable", len(tracer.FinishedSpans()))
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tracer := mocktracer.New()
+	i := NewWithTracer(tracer)
+	db := openDB(t)
+	if err := db.Use(i); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	if len(tracer.FinishedSpans()) != 1 {
+		t.Fatalf("spans = %d before remove", len(tracer.FinishedSpans()))
+	}
+
+	if err := i.Remove(db); err != nil {
+		t.Fatal(err)
+	}
+	db.Table("users").Find(&list)
+	if len(tracer.FinishedSpans()) != 1 {
+		t.Errorf("spans = %d after remove", len(tracer.FinishedSpans()))
+	}
+
+	// 注销后可以重新注册
+	if err := db.Use(i); err != nil {
+		t.Fatal(err)
+	}
+	db.Table("users").Find(&list)
+	if len(tracer.FinishedSpans()) != 2 {
+		t.Errorf("spans = %d after re-register", len(tracer.FinishedSpans()))
+	}
+}
+
+func TestMultipleInstances(t *testing.T) {
+	newPlugin := func(svcName, dbName string) (*IstioGormTracing, *jaeger.InMemoryReporter, *gorm.DB) {
+		reporter := jaeger.NewInMemoryReporter()
+		i, err := New(WithServiceName(svcName), WithDBName(dbName), WithReporter(reporter))
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := openDB(t)
+		if err := db.Use(i); err != nil {
+			t.Fatal(err)
+		}
+		return i, reporter, db
+	}
+	orders, ordersReporter, ordersDB := newPlugin("orders-service", "orders")
+	defer orders.Close()
+	users, usersReporter, usersDB := newPlugin("users-service", "users")
+	defer users.Close()
+
+	var list []map[string]interface{}
+	ordersDB.Table("orders").Find(&list)
+	usersDB.Table("users").Find(&list)
+	usersDB.Table("users").Find(&list)
+
+	for _, c := range []struct {
+		plugin   *IstioGormTracing
+		reporter *jaeger.InMemoryReporter
+		svcName  string
+		dbName   string
+		spans    int
+	}{
+		{orders, ordersReporter, "orders-service", "orders", 1},
+		{users, usersReporter, "users-service", "users", 2},
+	} {
+		spans := c.reporter.GetSpans()
+		if len(spans) != c.spans {
+			t.Fatalf("%s: spans = %d, want %d", c.svcName, len(spans), c.spans)
+		}
+		for _, s := range spans {
+			span := s.(*jaeger.Span)
+			if span.Tracer() != c.plugin.getTracer() {
+				t.Errorf("%s: span reported by another tracer", c.svcName)
+			}
+			if span.Tags()[_tagDBInstance] != c.dbName {
+				t.Errorf("%s: db.instance = %v", c.svcName, span.Tags()[_tagDBInstance])
+			}
+		}
+	}
+	if _, ok := opentracing.GlobalTracer().(opentracing.NoopTracer); !ok {
+		t.Error("plugins should not replace the global tracer")
+	}
+}
+
+func TestWithProcessTags(t *testing.T) {
+	os.Setenv("POD_NAME", "orders-7d9c5b7f4-x2kqz")
+	os.Setenv("POD_NAMESPACE", "prod")
+	defer os.Unsetenv("POD_NAME")
+	defer os.Unsetenv("POD_NAMESPACE")
+
+	i, err := New(WithServiceName("istio-gorm-tracing-test"), WithReporter(jaeger.NewNullReporter()), WithProcessTags("v1.2.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	tags := map[string]interface{}{}
+	for _, tag := range i.getTracer().(*jaeger.Tracer).Tags() {
+		tags[tag.Key] = tag.Value
+	}
+	if tags[_tagPodName] != "orders-7d9c5b7f4-x2kqz" || tags[_tagPodNamespace] != "prod" || tags[_tagServiceVersion] != "v1.2.3" {
+		t.Errorf("tags = %v", tags)
+	}
+	if _, ok := tags[_tagNodeName]; ok {
+		t.Error("unset NODE_NAME should be skipped")
+	}
+}
+
+func TestWithGen128Bit(t *testing.T) {
+	for _, gen128Bit := range []bool{false, true} {
+		opts := []Option{WithServiceName("istio-gorm-tracing-test"), WithReporter(jaeger.NewNullReporter())}
+		if gen128Bit {
+			opts = append(opts, WithGen128Bit())
+		}
+		i, err := New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		span := i.getTracer().StartSpan(_opQuery)
+		span.Finish()
+		if high := span.Context().(jaeger.SpanContext).TraceID().High; (high != 0) != gen128Bit {
+			t.Errorf("gen128Bit = %v, trace id high = %x", gen128Bit, high)
+		}
+		i.Close()
+	}
+}
+
+func TestRowsTags(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	// 测试驱动不会返回数据，模拟驱动返回的行数
+	setRows := func(db *gorm.DB) { db.RowsAffected = 3 }
+	db.Callback().Update().Before(_eventAfterUpdate).Register("test:rows", setRows)
+	db.Callback().Query().Before(_eventAfterQuery).Register("test:rows", setRows)
+
+	var list []map[string]interface{}
+	db.Table("users").Where("1 = 1").Update("name", "xiaoming")
+	db.Table("users").Find(&list)
+	db.Table("users").Row()
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 3 {
+		t.Fatalf("spans = %d", len(spans))
+	}
+	if v := spans[0].Tag(_tagRowsAffected); v != int64(3) {
+		t.Errorf("update rows affected = %v", v)
+	}
+	if v := spans[1].Tag(_tagRowsReturned); v != int64(3) {
+		t.Errorf("query rows returned = %v", v)
+	}
+	if v := spans[2].Tag(_tagRowsReturned); v != nil {
+		t.Errorf("row rows returned = %v", v)
+	}
+}
+
+func TestClientSpanTags(t *testing.T) {
+	for _, c := range []struct {
+		opts []Option
+		peer string
+	}{
+		{nil, "fake"},
+		{[]Option{WithDBName("orders")}, "orders"},
+	} {
+		tracer := mocktracer.New()
+		db := openDB(t)
+		if err := db.Use(NewWithTracer(tracer, c.opts...)); err != nil {
+			t.Fatal(err)
+		}
+		var list []map[string]interface{}
+		db.Table("users").Find(&list)
+		span := tracer.FinishedSpans()[0]
+		if span.Tag("span.kind") != ext.SpanKindRPCClientEnum || span.Tag("component") != "gorm" || span.Tag("peer.service") != c.peer {
+			t.Errorf("tags = %v", span.Tags())
+		}
+	}
+}
+
+func TestWithSQLRecordMode(t *testing.T) {
+	for _, c := range []struct {
+		mode       SQLRecordMode
+		logs, tags bool
+	}{
+		{"", true, false},
+		{SQLAsLogs, true, false},
+		{SQLAsTags, false, true},
+		{SQLAsLogsAndTags, true, true},
+	} {
+		tracer := mocktracer.New()
+		db := openDB(t)
+		if err := db.Use(NewWithTracer(tracer, WithSQLRecordMode(c.mode))); err != nil {
+			t.Fatal(err)
+		}
+		var list []map[string]interface{}
+		db.Table("users").Find(&list)
+		span := tracer.FinishedSpans()[0]
+
+		logged := false
+		for _, record := range span.Logs() {
+			for _, field := range record.Fields {
+				if field.Key == "table" && field.ValueString == "users" {
+					logged = true
+				}
+			}
+		}
+		tagged := span.Tag("table") == "users" && span.Tag("sql") == "SELECT * FROM users"
+		if logged != c.logs || tagged != c.tags {
+			t.Errorf("mode %q: logged = %v, tagged = %v", c.mode, logged, tagged)
+		}
+	}
+}
+
+func TestWithSpanTags(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithSpanTags(map[string]interface{}{"env": "prod", "team": "order"}))); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+
+	span := tracer.FinishedSpans()[0]
+	if span.Tag("env") != "prod" || span.Tag("team") != "order" {
+		t.Errorf("tags = %v", span.Tags())
+	}
+}
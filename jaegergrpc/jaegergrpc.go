@@ -0,0 +1,137 @@
+// 通过 gRPC 上报到 jaeger 收集器(默认端口 14250)，生产环境推荐的上报方式
+// 只依赖 gRPC，不引入 jaeger 主仓库，请求按 jaeger 的 model.proto 手动编码
+package jaegergrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+	j "github.com/uber/jaeger-client-go/thrift-gen/jaeger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	_postSpansMethod = "/jaeger.api_v2.CollectorService/PostSpans"
+	// 缓冲的 span 达到此数量时立即上报
+	_defaultBatchSize = 100
+	_defaultTimeout   = 10 * time.Second
+)
+
+// 上报到 jaeger 收集器的配置
+type Config struct {
+	// 收集器地址，如 jaeger-collector.istio-system:14250
+	Endpoint string
+	// 不使用 TLS
+	Insecure bool
+	// TLS 配置，需要 mTLS 时设置 Certificates，为空且 Insecure 为 false 时使用系统的根证书
+	TLSConfig *tls.Config
+	// 每次上报的超时时间，默认为 10s
+	Timeout time.Duration
+}
+
+// 创建通过 gRPC 上报的 reporter，配合 istiogormtracing.WithReporter 使用
+// span 的排队和定时上报由 jaeger 的 RemoteReporter 完成，opts 可以设置队列长度、上报间隔等
+func NewReporter(cfg Config, opts ...jaeger.ReporterOption) (jaeger.Reporter, error) {
+	transport, err := NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return jaeger.NewRemoteReporter(transport, opts...), nil
+}
+
+// 创建通过 gRPC 上报的 jaeger.Transport
+func NewTransport(cfg Config) (jaeger.Transport, error) {
+	creds := credentials.NewTLS(cfg.TLSConfig)
+	if cfg.Insecure {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.Dial(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("jaeger 收集器连接失败, 错误原因: %w", err)
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = _defaultTimeout
+	}
+	return &transport{conn: conn, timeout: timeout}, nil
+}
+
+type transport struct {
+	conn    *grpc.ClientConn
+	timeout time.Duration
+
+	mu      sync.Mutex
+	process *j.Process
+	spans   []*j.Span
+}
+
+func (t *transport) Append(span *jaeger.Span) (int, error) {
+	t.mu.Lock()
+	if t.process == nil {
+		t.process = jaeger.BuildJaegerProcessThrift(span)
+	}
+	t.spans = append(t.spans, jaeger.BuildJaegerThrift(span))
+	full := len(t.spans) >= _defaultBatchSize
+	t.mu.Unlock()
+
+	if full {
+		return t.Flush()
+	}
+	return 0, nil
+}
+
+func (t *transport) Flush() (int, error) {
+	t.mu.Lock()
+	spans, process := t.spans, t.process
+	t.spans = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	req := rawMessage(encodePostSpansRequest(process, spans))
+	var resp rawMessage
+	if err := t.conn.Invoke(ctx, _postSpansMethod, &req, &resp, grpc.ForceCodec(rawCodec{})); err != nil {
+		return len(spans), fmt.Errorf("jaeger 收集器上报失败, 错误原因: %w", err)
+	}
+	return len(spans), nil
+}
+
+func (t *transport) Close() error {
+	return t.conn.Close()
+}
+
+// 已经编码好的 protobuf 内容
+type rawMessage []byte
+
+// 直接收发编码好的内容，名称为 proto 以使用 application/grpc+proto
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(*rawMessage)
+	if !ok {
+		return nil, fmt.Errorf("不支持的消息类型 %T", v)
+	}
+	return *m, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(*rawMessage)
+	if !ok {
+		return fmt.Errorf("不支持的消息类型 %T", v)
+	}
+	*m = append((*m)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,92 @@
+package jaegergrpc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 按字段编号取出 protobuf 中的嵌套消息
+func fields(t *testing.T, b []byte, num protowire.Number) [][]byte {
+	t.Helper()
+	var out [][]byte
+	for len(b) > 0 {
+		n, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			t.Fatal(protowire.ParseError(l))
+		}
+		b = b[l:]
+		if typ == protowire.BytesType {
+			v, m := protowire.ConsumeBytes(b)
+			if n == num {
+				out = append(out, v)
+			}
+			b = b[m:]
+			continue
+		}
+		m := protowire.ConsumeFieldValue(n, typ, b)
+		if m < 0 {
+			t.Fatal(protowire.ParseError(m))
+		}
+		b = b[m:]
+	}
+	return out
+}
+
+func TestReporter(t *testing.T) {
+	received := make(chan []byte, 1)
+	server := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}), grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		if method != _postSpansMethod {
+			t.Errorf("method = %s", method)
+		}
+		var req rawMessage
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		received <- req
+		resp := rawMessage{}
+		return stream.SendMsg(&resp)
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	defer server.Stop()
+
+	reporter, err := NewReporter(Config{Endpoint: lis.Addr().String(), Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer, closer := jaeger.NewTracer("istio-gorm-tracing-test", jaeger.NewConstSampler(true), reporter)
+	parent := tracer.StartSpan("http")
+	span := tracer.StartSpan("query", opentracing.ChildOf(parent.Context()))
+	span.SetTag("db.table", "users")
+	span.Finish()
+	closer.Close()
+
+	req := <-received
+	batch := fields(t, req, 1)
+	if len(batch) != 1 {
+		t.Fatalf("batch = %d", len(batch))
+	}
+	spans := fields(t, batch[0], 1)
+	if len(spans) != 1 {
+		t.Fatalf("spans = %d, want 1", len(spans))
+	}
+	if name := fields(t, spans[0], 3); len(name) != 1 || string(name[0]) != "query" {
+		t.Errorf("operation name = %q", name)
+	}
+	if refs := fields(t, spans[0], 4); len(refs) != 1 {
+		t.Errorf("references = %d, want parent reference", len(refs))
+	}
+	process := fields(t, batch[0], 2)
+	if len(process) != 1 || string(fields(t, process[0], 1)[0]) != "istio-gorm-tracing-test" {
+		t.Errorf("process = %q", process)
+	}
+}
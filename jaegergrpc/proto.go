@@ -0,0 +1,183 @@
+package jaegergrpc
+
+import (
+	"encoding/binary"
+	"math"
+
+	j "github.com/uber/jaeger-client-go/thrift-gen/jaeger"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 按 jaeger 的 model.proto 和 collector.proto 编码，字段编号见
+// https://github.com/jaegertracing/jaeger-idl/blob/main/proto/api_v2/model.proto
+
+// model.proto 中 ValueType 的取值，与 thrift 的 TagType 顺序不同
+const (
+	_valueString  = 0
+	_valueBool    = 1
+	_valueInt64   = 2
+	_valueFloat64 = 3
+	_valueBinary  = 4
+)
+
+// PostSpansRequest{ batch = 1 }
+func encodePostSpansRequest(process *j.Process, spans []*j.Span) []byte {
+	return appendMessage(nil, 1, encodeBatch(process, spans))
+}
+
+// Batch{ spans = 1, process = 2 }
+func encodeBatch(process *j.Process, spans []*j.Span) []byte {
+	var b []byte
+	for _, span := range spans {
+		b = appendMessage(b, 1, encodeSpan(span))
+	}
+	if process != nil {
+		b = appendMessage(b, 2, encodeProcess(process))
+	}
+	return b
+}
+
+// Span{ trace_id = 1, span_id = 2, operation_name = 3, references = 4, flags = 5,
+// start_time = 6, duration = 7, tags = 8, logs = 9 }
+func encodeSpan(span *j.Span) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, traceID(span.TraceIdHigh, span.TraceIdLow))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, spanID(span.SpanId))
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, span.OperationName)
+
+	// proto 中没有 parent_span_id 字段，父 span 需要作为 CHILD_OF 引用
+	hasParent := span.ParentSpanId == 0
+	for _, ref := range span.References {
+		if ref.SpanId == span.ParentSpanId && ref.RefType == j.SpanRefType_CHILD_OF {
+			hasParent = true
+		}
+		b = appendMessage(b, 4, encodeSpanRef(ref.TraceIdHigh, ref.TraceIdLow, ref.SpanId, int32(ref.RefType)))
+	}
+	if !hasParent {
+		b = appendMessage(b, 4, encodeSpanRef(span.TraceIdHigh, span.TraceIdLow, span.ParentSpanId, int32(j.SpanRefType_CHILD_OF)))
+	}
+
+	b = protowire.AppendTag(b, 5, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(uint32(span.Flags)))
+	b = appendMessage(b, 6, encodeTimestamp(span.StartTime))
+	b = appendMessage(b, 7, encodeTimestamp(span.Duration))
+	for _, tag := range span.Tags {
+		b = appendMessage(b, 8, encodeKeyValue(tag))
+	}
+	for _, log := range span.Logs {
+		b = appendMessage(b, 9, encodeLog(log))
+	}
+	return b
+}
+
+// SpanRef{ trace_id = 1, span_id = 2, ref_type = 3 }
+func encodeSpanRef(high, low, id int64, refType int32) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, traceID(high, low))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, spanID(id))
+	if refType != 0 {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(refType))
+	}
+	return b
+}
+
+// Process{ service_name = 1, tags = 2 }
+func encodeProcess(process *j.Process) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, process.ServiceName)
+	for _, tag := range process.Tags {
+		b = appendMessage(b, 2, encodeKeyValue(tag))
+	}
+	return b
+}
+
+// Log{ timestamp = 1, fields = 2 }
+func encodeLog(log *j.Log) []byte {
+	b := appendMessage(nil, 1, encodeTimestamp(log.Timestamp))
+	for _, field := range log.Fields {
+		b = appendMessage(b, 2, encodeKeyValue(field))
+	}
+	return b
+}
+
+// KeyValue{ key = 1, v_type = 2, v_str = 3, v_bool = 4, v_int64 = 5, v_float64 = 6, v_binary = 7 }
+func encodeKeyValue(tag *j.Tag) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, tag.Key)
+	switch tag.VType {
+	case j.TagType_BOOL:
+		b = appendValueType(b, _valueBool)
+		if tag.VBool != nil && *tag.VBool {
+			b = protowire.AppendTag(b, 4, protowire.VarintType)
+			b = protowire.AppendVarint(b, 1)
+		}
+	case j.TagType_LONG:
+		b = appendValueType(b, _valueInt64)
+		if tag.VLong != nil {
+			b = protowire.AppendTag(b, 5, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(*tag.VLong))
+		}
+	case j.TagType_DOUBLE:
+		b = appendValueType(b, _valueFloat64)
+		if tag.VDouble != nil {
+			b = protowire.AppendTag(b, 6, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, math.Float64bits(*tag.VDouble))
+		}
+	case j.TagType_BINARY:
+		b = appendValueType(b, _valueBinary)
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, tag.VBinary)
+	default:
+		if tag.VStr != nil {
+			b = protowire.AppendTag(b, 3, protowire.BytesType)
+			b = protowire.AppendString(b, *tag.VStr)
+		}
+	}
+	return b
+}
+
+func appendValueType(b []byte, valueType uint64) []byte {
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	return protowire.AppendVarint(b, valueType)
+}
+
+// google.protobuf.Timestamp 和 Duration 的格式相同: { seconds = 1, nanos = 2 }，thrift 中的单位为微秒
+func encodeTimestamp(micros int64) []byte {
+	var b []byte
+	if seconds := micros / 1e6; seconds != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(seconds))
+	}
+	if nanos := (micros % 1e6) * 1e3; nanos != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(nanos))
+	}
+	return b
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// trace id 为 16 字节的大端序，高 64 位在前
+func traceID(high, low int64) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[:8], uint64(high))
+	binary.BigEndian.PutUint64(b[8:], uint64(low))
+	return b
+}
+
+func spanID(id int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
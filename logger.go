@@ -0,0 +1,56 @@
+package istiogormtracing
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+// 将插件内部的日志(丢弃 span、上报失败、追踪信息解析失败等)转交给应用自己的日志组件，如 zap、logrus，通过 WithLogger 使用
+// level 为 error 或 info
+type LoggerFunc func(level, msg string)
+
+func (f LoggerFunc) Error(msg string) {
+	f("error", msg)
+}
+
+func (f LoggerFunc) Infof(msg string, args ...interface{}) {
+	f("info", fmt.Sprintf(msg, args...))
+}
+
+// 可以替换日志组件的 reporter，插件会将 WithLogger 设置的日志组件传给通过 WithReporter 传入的 reporter
+type loggerSetter interface {
+	setLogger(logger jaeger.Logger)
+}
+
+// 可以在后台 goroutine 运行时替换的日志组件
+type syncLogger struct {
+	v atomic.Value
+}
+
+// atomic.Value 要求每次存入的类型相同
+type loggerHolder struct {
+	jaeger.Logger
+}
+
+func newSyncLogger(logger jaeger.Logger) *syncLogger {
+	if logger == nil {
+		logger = jaeger.StdLogger
+	}
+	l := &syncLogger{}
+	l.set(logger)
+	return l
+}
+
+func (l *syncLogger) set(logger jaeger.Logger) {
+	l.v.Store(loggerHolder{logger})
+}
+
+func (l *syncLogger) Error(msg string) {
+	l.v.Load().(loggerHolder).Error(msg)
+}
+
+func (l *syncLogger) Infof(msg string, args ...interface{}) {
+	l.v.Load().(loggerHolder).Infof(msg, args...)
+}
@@ -0,0 +1,43 @@
+package istiogormtracing
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type failExporter struct{}
+
+func (failExporter) ExportSpans(spans []FinishedSpan) error {
+	return errors.New("connection refused")
+}
+
+func TestWithLogger(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		logs []string
+	)
+	logger := LoggerFunc(func(level, msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, level+": "+msg)
+	})
+	i, err := New(WithServiceName("istio-gorm-tracing-test"), WithLogger(logger), WithExporter(failExporter{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.getTracer().StartSpan(_opQuery).Finish()
+	if err := i.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, l := range logs {
+		if strings.HasPrefix(l, "error: ") && strings.Contains(l, "connection refused") {
+			return
+		}
+	}
+	t.Errorf("export error not logged, logs = %v", logs)
+}
@@ -0,0 +1,71 @@
+package istiogormtracing
+
+import (
+	"fmt"
+
+	"github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+)
+
+// 因超过限制被丢弃的日志字段数量
+const _tagDroppedLogFields = "log.dropped_fields"
+
+// 设置每个 span 最多记录的日志字段数量，超过的字段会被丢弃，并在 log.dropped_fields 中记录丢弃的数量
+// 避免异常的 SQL 使上报的数据过大，整批被收集器拒绝；默认不限制
+func WithMaxLogFields(n int) Option {
+	return func(i *IstioGormTracing) {
+		i.maxLogFields = n
+	}
+}
+
+// 设置每个 span 的日志字段最多占用的字节数(字段名和值的长度之和)，超过的字段会被丢弃，默认不限制
+func WithMaxLogBytes(n int) Option {
+	return func(i *IstioGormTracing) {
+		i.maxLogBytes = n
+	}
+}
+
+// 设置了限制时返回限制日志字段的 span
+func (i *IstioGormTracing) limitLogs(span opentracing.Span) opentracing.Span {
+	if i.maxLogFields <= 0 && i.maxLogBytes <= 0 {
+		return span
+	}
+	return &limitedSpan{Span: span, maxFields: i.maxLogFields, maxBytes: i.maxLogBytes}
+}
+
+// 限制日志字段数量和大小的 span，只在 _injectAfter 中使用，不需要加锁
+type limitedSpan struct {
+	opentracing.Span
+	maxFields, maxBytes int
+	fields, bytes       int
+	dropped             int
+}
+
+func (s *limitedSpan) LogFields(fields ...opentracinglog.Field) {
+	kept := make([]opentracinglog.Field, 0, len(fields))
+	for _, f := range fields {
+		size := len(f.Key()) + len(fmt.Sprint(f.Value()))
+		if (s.maxFields > 0 && s.fields >= s.maxFields) || (s.maxBytes > 0 && s.bytes+size > s.maxBytes) {
+			s.dropped++
+			continue
+		}
+		s.fields++
+		s.bytes += size
+		kept = append(kept, f)
+	}
+	if len(kept) > 0 {
+		s.Span.LogFields(kept...)
+	}
+	if len(kept) < len(fields) {
+		s.Span.SetTag(_tagDroppedLogFields, s.dropped)
+	}
+}
+
+func (s *limitedSpan) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := opentracinglog.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		s.LogFields(opentracinglog.Error(err), opentracinglog.String("function", "LogKV"))
+		return
+	}
+	s.LogFields(fields...)
+}
@@ -0,0 +1,54 @@
+package istiogormtracing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestLimitLogs(t *testing.T) {
+	cases := []struct {
+		opts    []Option
+		fields  int
+		dropped interface{}
+	}{
+		{nil, 4, nil},
+		{[]Option{WithMaxLogFields(2)}, 2, 2},
+		// table 和 sql 字段共 57 字节，超出的 query 和 bindings 被丢弃
+		{[]Option{WithMaxLogBytes(60)}, 2, 2},
+	}
+	for n, c := range cases {
+		tracer := mocktracer.New()
+		db := openDB(t)
+		if err := db.Use(NewWithTracer(tracer, c.opts...)); err != nil {
+			t.Fatal(err)
+		}
+		var list []map[string]interface{}
+		db.Table("users").Where("name = ?", strings.Repeat("a", 10)).Find(&list)
+
+		span := tracer.FinishedSpans()[0]
+		fields := 0
+		for _, record := range span.Logs() {
+			fields += len(record.Fields)
+		}
+		if fields != c.fields {
+			t.Errorf("case %d: fields = %d, want %d", n, fields, c.fields)
+		}
+		if got := span.Tag(_tagDroppedLogFields); got != c.dropped {
+			t.Errorf("case %d: dropped = %v, want %v", n, got, c.dropped)
+		}
+	}
+}
+
+func TestLimitedSpanLogKV(t *testing.T) {
+	span := mocktracer.New().StartSpan("test")
+	limited := &limitedSpan{Span: span, maxFields: 1}
+	limited.LogKV("a", 1, "b", 2)
+	span.Finish()
+
+	mock := span.(*mocktracer.MockSpan)
+	if len(mock.Logs()) != 1 || len(mock.Logs()[0].Fields) != 1 || mock.Tag(_tagDroppedLogFields) != 1 {
+		t.Errorf("logs = %v, tags = %v", mock.Logs(), mock.Tags())
+	}
+}
@@ -0,0 +1,117 @@
+package istiogormtracing
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 替换敏感字段参数的内容
+const _maskedValue = "***"
+
+var (
+	// 占位符前的条件，如 password = ?、email LIKE ?、id IN (?,?,
+	_columnBeforeRe = regexp.MustCompile(`(?i)([\w.` + "`" + `"\[\]]+)\s*(?:=|<>|!=|<=|>=|<|>|\bLIKE|\bIN\s*\((?:\s*(?:\?|\$\d+|@p\d+)\s*,)*)\s*$`)
+	// INSERT 语句的字段列表
+	_insertColumnsRe = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+\S+\s*\(([^)]*)\)\s*VALUES`)
+)
+
+// 将 columns 中字段对应的参数替换为 ***，返回新的参数，不修改原参数
+// 根据 SQL 模板中占位符(?、$1、@p1)前的条件或 INSERT 的字段列表确定参数对应的字段
+func maskVars(sql string, vars []interface{}, columns map[string]bool) []interface{} {
+	if len(columns) == 0 || len(vars) == 0 {
+		return vars
+	}
+	var insertColumns []string
+	valuesAt := -1
+	if m := _insertColumnsRe.FindStringSubmatchIndex(sql); m != nil {
+		insertColumns = strings.Split(sql[m[2]:m[3]], ",")
+		valuesAt = m[1]
+	}
+
+	var masked []interface{}
+	forEachPlaceholder(sql, func(pos, index int) {
+		if index < 0 || index >= len(vars) {
+			return
+		}
+		var column string
+		if valuesAt >= 0 && pos >= valuesAt {
+			if n := tuplePosition(sql[valuesAt:pos]); n < len(insertColumns) {
+				column = insertColumns[n]
+			}
+		} else if m := _columnBeforeRe.FindStringSubmatch(sql[:pos]); m != nil {
+			column = m[1]
+		}
+		if !columns[normalizeColumn(column)] {
+			return
+		}
+		if masked == nil {
+			masked = append([]interface{}(nil), vars...)
+		}
+		masked[index] = _maskedValue
+	})
+	if masked == nil {
+		return vars
+	}
+	return masked
+}
+
+// 依次找出字符串以外的占位符，index 为对应的参数下标
+func forEachPlaceholder(sql string, fn func(pos, index int)) {
+	next := 0
+	inQuote := false
+	for pos := 0; pos < len(sql); pos++ {
+		c := sql[pos]
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '?':
+			fn(pos, next)
+			next++
+		case c == '$' || (c == '@' && pos+1 < len(sql) && (sql[pos+1] == 'p' || sql[pos+1] == 'P')):
+			start := pos + 1
+			if c == '@' {
+				start++
+			}
+			end := start
+			for end < len(sql) && sql[end] >= '0' && sql[end] <= '9' {
+				end++
+			}
+			if n, err := strconv.Atoi(sql[start:end]); err == nil && end > start {
+				fn(pos, n-1)
+				pos = end - 1
+			}
+		}
+	}
+}
+
+// 占位符在当前 VALUES 元组中的位置
+func tuplePosition(s string) int {
+	n, depth := 0, 0
+	for j := len(s) - 1; j >= 0; j-- {
+		switch s[j] {
+		case ')':
+			depth++
+		case '(':
+			if depth == 0 {
+				return n
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// 去掉引号和表名，如 `users`.`password` 为 password
+func normalizeColumn(column string) string {
+	column = strings.Trim(strings.TrimSpace(column), "`\"[]")
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		column = strings.Trim(column[i+1:], "`\"[]")
+	}
+	return strings.ToLower(column)
+}
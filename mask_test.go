@@ -0,0 +1,63 @@
+package istiogormtracing
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMaskVars(t *testing.T) {
+	columns := map[string]bool{"password": true, "ssn": true}
+	cases := []struct {
+		sql  string
+		vars []interface{}
+		want []interface{}
+	}{
+		{"SELECT * FROM users WHERE name = ? AND password = ?", []interface{}{"a", "b"}, []interface{}{"a", _maskedValue}},
+		{"SELECT * FROM `users` WHERE `users`.`Password` = ?", []interface{}{"b"}, []interface{}{_maskedValue}},
+		{"SELECT * FROM users WHERE ssn IN (?,?) AND id > ?", []interface{}{"1", "2", 3}, []interface{}{_maskedValue, _maskedValue, 3}},
+		{"INSERT INTO users (name,password) VALUES (?,?),(?,?)", []interface{}{"a", "b", "c", "d"}, []interface{}{"a", _maskedValue, "c", _maskedValue}},
+		{`UPDATE "users" SET "password"=$2 WHERE "id" = $1`, []interface{}{1, "b"}, []interface{}{1, _maskedValue}},
+		{"SELECT * FROM users WHERE name = 'password = ?' AND id = ?", []interface{}{1}, []interface{}{1}},
+	}
+	for _, c := range cases {
+		if got := maskVars(c.sql, c.vars, columns); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("maskVars(%q) = %v, want %v", c.sql, got, c.want)
+		}
+	}
+
+	vars := []interface{}{"b"}
+	maskVars("SELECT * FROM users WHERE password = ?", vars, columns)
+	if vars[0] != "b" {
+		t.Errorf("原参数被修改: %v", vars)
+	}
+}
+
+func TestWithMaskColumns(t *testing.T) {
+	tracer := mocktracer.New()
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewWithTracer(tracer, WithMaskColumns("Password"))); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Where("name = ? AND password = ?", "xiaoming", "secret").Find(&list)
+
+	got := map[string]string{}
+	for _, record := range tracer.FinishedSpans()[0].Logs() {
+		for _, field := range record.Fields {
+			got[field.Key] = field.ValueString
+		}
+	}
+	if got[_fieldBindings] != `["xiaoming","***"]` {
+		t.Errorf("bindings = %s", got[_fieldBindings])
+	}
+	if got[_fieldSQL] != `SELECT * FROM users WHERE name = 'xiaoming' AND password = '***'` {
+		t.Errorf("sql = %s", got[_fieldSQL])
+	}
+}
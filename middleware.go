@@ -0,0 +1,47 @@
+package istiogormtracing
+
+import (
+	"context"
+	"net/http"
+)
+
+// 匹配到的路由记录在 span 中使用的 tag
+const _tagRoute = "http.route"
+
+// net/http 中间件，将每个请求的追踪 header 放入请求的 context 中
+// handler 中使用 db.WithContext(r.Context()) 即可与上下游服务做关联，不再需要修改全局变量 H
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithHeaders(r.Context(), r.Header)))
+	})
+}
+
+// 从请求中取出匹配到的路由模板，如 /users/{id}
+type RouteFunc func(r *http.Request) string
+
+// context 中保存路由的 key 类型
+type routeCtxKey struct{}
+
+// 与 Middleware 相同，同时将匹配到的路由模板记录到 SQL 的 span 中，方便在 Jaeger 中按接口分组
+// 路由在创建 span 时才会获取，chi 等在 handler 执行过程中才完成路由匹配的框架也能取到
+// chi: RouteMiddleware(func(r *http.Request) string { return chi.RouteContext(r.Context()).RoutePattern() })
+// gorilla/mux: RouteMiddleware(func(r *http.Request) string { t, _ := mux.CurrentRoute(r).GetPathTemplate(); return t })
+func RouteMiddleware(route RouteFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithHeaders(r.Context(), r.Header)
+			r = r.WithContext(context.WithValue(ctx, routeCtxKey{}, func() string {
+				return route(r)
+			}))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// 取出 RouteMiddleware 记录的路由模板
+func routeFromContext(ctx context.Context) string {
+	if fn, ok := ctx.Value(routeCtxKey{}).(func() string); ok {
+		return fn()
+	}
+	return ""
+}
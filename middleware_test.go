@@ -0,0 +1,41 @@
+package istiogormtracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestMiddleware(t *testing.T) {
+	var got http.Header
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = headersFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("x-b3-traceid", "463ac35c9f6413ad48485a3953bb6124")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.Get("x-b3-traceid") != "463ac35c9f6413ad48485a3953bb6124" {
+		t.Errorf("headers = %v", got)
+	}
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	i := NewWithTracer(mocktracer.New())
+	// 路由在 handler 执行过程中才确定，模拟 chi 的行为
+	route := ""
+	var span *mocktracer.MockSpan
+	handler := RouteMiddleware(func(r *http.Request) string { return route })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route = "/users/{id}"
+		span = startSpan(t, i, r.Context())
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	if got := span.Tag(_tagRoute); got != "/users/{id}" {
+		t.Errorf("route tag = %v", got)
+	}
+}
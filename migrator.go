@@ -0,0 +1,139 @@
+package istiogormtracing
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// 迁移操作的 span 名称为 migrate. 加上操作名称，如 migrate.auto_migrate、migrate.add_column
+const (
+	_opMigratePrefix = "migrate."
+	// 迁移的表名，多个时用逗号分隔
+	_tagMigrationTable = "db.migration.table"
+	// 迁移的字段、索引、约束或视图名称
+	_tagMigrationTarget = "db.migration.target"
+)
+
+// 追踪 DDL 的 Migrator，每个修改表结构的操作创建一个 span，执行的 SQL 作为它的子 span
+// HasTable、ColumnTypes 等只读操作不单独创建 span
+type tracingMigrator struct {
+	gorm.Migrator
+	plugin *IstioGormTracing
+	db     *gorm.DB
+}
+
+// 返回追踪迁移操作的 Migrator，部署时较慢的 DDL 可以在链路中直接看到
+// 使用方式: plugin.Migrator(gormDb.WithContext(ctx)).AddColumn(&User{}, "Age")
+func (i *IstioGormTracing) Migrator(db *gorm.DB) gorm.Migrator {
+	return &tracingMigrator{Migrator: db.Migrator(), plugin: i, db: db}
+}
+
+// 与 db.AutoMigrate 相同，同时创建 migrate.auto_migrate span
+func (i *IstioGormTracing) AutoMigrate(db *gorm.DB, dst ...interface{}) error {
+	return i.Migrator(db).AutoMigrate(dst...)
+}
+
+// 在 span 中执行迁移操作，不追踪时直接执行
+func (m *tracingMigrator) trace(op string, tables []interface{}, target string, fc func(migrator gorm.Migrator) error) error {
+	span, ctx := m.plugin.startParentSpan(m.db, _opMigratePrefix+op)
+	if span == nil {
+		return fc(m.Migrator)
+	}
+	if names := m.tableNames(tables); len(names) > 0 {
+		span.SetTag(_tagMigrationTable, strings.Join(names, ","))
+	}
+	if target != "" {
+		span.SetTag(_tagMigrationTarget, target)
+	}
+	err := fc(m.db.WithContext(ctx).Migrator())
+	if err != nil && m.plugin.isError(err) {
+		setSpanError(span, err)
+	}
+	span.Finish()
+	return err
+}
+
+// 模型对应的表名，传入字符串时即为表名，无法解析的模型不记录
+func (m *tracingMigrator) tableNames(tables []interface{}) []string {
+	var names []string
+	for _, dst := range tables {
+		switch v := dst.(type) {
+		case string:
+			names = append(names, v)
+		case *schema.Schema:
+			names = append(names, v.Table)
+		default:
+			stmt := &gorm.Statement{DB: m.db}
+			if err := stmt.Parse(dst); err == nil {
+				names = append(names, stmt.Table)
+			}
+		}
+	}
+	return names
+}
+
+func (m *tracingMigrator) AutoMigrate(dst ...interface{}) error {
+	return m.trace("auto_migrate", dst, "", func(mg gorm.Migrator) error { return mg.AutoMigrate(dst...) })
+}
+
+func (m *tracingMigrator) CreateTable(dst ...interface{}) error {
+	return m.trace("create_table", dst, "", func(mg gorm.Migrator) error { return mg.CreateTable(dst...) })
+}
+
+func (m *tracingMigrator) DropTable(dst ...interface{}) error {
+	return m.trace("drop_table", dst, "", func(mg gorm.Migrator) error { return mg.DropTable(dst...) })
+}
+
+func (m *tracingMigrator) RenameTable(oldName, newName interface{}) error {
+	return m.trace("rename_table", []interface{}{oldName, newName}, "", func(mg gorm.Migrator) error { return mg.RenameTable(oldName, newName) })
+}
+
+func (m *tracingMigrator) AddColumn(dst interface{}, field string) error {
+	return m.trace("add_column", []interface{}{dst}, field, func(mg gorm.Migrator) error { return mg.AddColumn(dst, field) })
+}
+
+func (m *tracingMigrator) DropColumn(dst interface{}, field string) error {
+	return m.trace("drop_column", []interface{}{dst}, field, func(mg gorm.Migrator) error { return mg.DropColumn(dst, field) })
+}
+
+func (m *tracingMigrator) AlterColumn(dst interface{}, field string) error {
+	return m.trace("alter_column", []interface{}{dst}, field, func(mg gorm.Migrator) error { return mg.AlterColumn(dst, field) })
+}
+
+func (m *tracingMigrator) MigrateColumn(dst interface{}, field *schema.Field, columnType gorm.ColumnType) error {
+	return m.trace("migrate_column", []interface{}{dst}, field.DBName, func(mg gorm.Migrator) error { return mg.MigrateColumn(dst, field, columnType) })
+}
+
+func (m *tracingMigrator) RenameColumn(dst interface{}, oldName, field string) error {
+	return m.trace("rename_column", []interface{}{dst}, oldName+","+field, func(mg gorm.Migrator) error { return mg.RenameColumn(dst, oldName, field) })
+}
+
+func (m *tracingMigrator) CreateView(name string, option gorm.ViewOption) error {
+	return m.trace("create_view", nil, name, func(mg gorm.Migrator) error { return mg.CreateView(name, option) })
+}
+
+func (m *tracingMigrator) DropView(name string) error {
+	return m.trace("drop_view", nil, name, func(mg gorm.Migrator) error { return mg.DropView(name) })
+}
+
+func (m *tracingMigrator) CreateConstraint(dst interface{}, name string) error {
+	return m.trace("create_constraint", []interface{}{dst}, name, func(mg gorm.Migrator) error { return mg.CreateConstraint(dst, name) })
+}
+
+func (m *tracingMigrator) DropConstraint(dst interface{}, name string) error {
+	return m.trace("drop_constraint", []interface{}{dst}, name, func(mg gorm.Migrator) error { return mg.DropConstraint(dst, name) })
+}
+
+func (m *tracingMigrator) CreateIndex(dst interface{}, name string) error {
+	return m.trace("create_index", []interface{}{dst}, name, func(mg gorm.Migrator) error { return mg.CreateIndex(dst, name) })
+}
+
+func (m *tracingMigrator) DropIndex(dst interface{}, name string) error {
+	return m.trace("drop_index", []interface{}{dst}, name, func(mg gorm.Migrator) error { return mg.DropIndex(dst, name) })
+}
+
+func (m *tracingMigrator) RenameIndex(dst interface{}, oldName, newName string) error {
+	return m.trace("rename_index", []interface{}{dst}, oldName+","+newName, func(mg gorm.Migrator) error { return mg.RenameIndex(dst, oldName, newName) })
+}
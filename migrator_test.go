@@ -0,0 +1,48 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestMigratorSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	plugin := NewWithTracer(tracer)
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+	if err := plugin.AutoMigrate(db, &tracingUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := plugin.Migrator(db).AddColumn(&tracingUser{}, "Name"); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.FinishedSpans()
+	parents := map[string]*mocktracer.MockSpan{}
+	for _, span := range spans {
+		parents[span.OperationName] = span
+	}
+	auto, add := parents["migrate.auto_migrate"], parents["migrate.add_column"]
+	if auto == nil || add == nil {
+		t.Fatalf("spans = %v", spans)
+	}
+	if auto.Tag(_tagMigrationTable) != "tracing_users" {
+		t.Errorf("auto_migrate tags = %v", auto.Tags())
+	}
+	if add.Tag(_tagMigrationTable) != "tracing_users" || add.Tag(_tagMigrationTarget) != "Name" {
+		t.Errorf("add_column tags = %v", add.Tags())
+	}
+	// DDL 作为迁移 span 的子 span
+	children := 0
+	for _, span := range spans {
+		if span.ParentID == auto.SpanContext.SpanID {
+			children++
+		}
+	}
+	if children == 0 {
+		t.Error("auto_migrate span has no child SQL spans")
+	}
+}
@@ -0,0 +1,55 @@
+package istiogormtracing
+
+import (
+	"reflect"
+
+	"github.com/opentracing/opentracing-go"
+	"gorm.io/gorm"
+)
+
+// Go 模型的名称和对应的表名，可以按业务实体搜索 span
+const (
+	_tagModel      = "db.model"
+	_tagModelTable = "db.model.table"
+	// 插入单条数据时生成的主键
+	_tagInsertID = "db.insert_id"
+	// 插入或更新的行数，可以区分批量操作和单行操作
+	_tagBatchSize = "db.batch.size"
+)
+
+// 记录模型信息，使用 Table 或 Raw 时没有模型，不记录
+func setModelTags(span opentracing.Span, db *gorm.DB) {
+	s := db.Statement.Schema
+	if s == nil {
+		return
+	}
+	span.SetTag(_tagModel, s.Name)
+	span.SetTag(_tagModelTable, s.Table)
+}
+
+// 插入单条数据后记录主键的值，可以通过主键找到对应的数据；批量插入和使用 map 插入时不记录
+func setInsertIDTag(span opentracing.Span, db *gorm.DB) {
+	s := db.Statement.Schema
+	if s == nil || s.PrioritizedPrimaryField == nil || db.Statement.ReflectValue.Kind() != reflect.Struct {
+		return
+	}
+	if id, zero := s.PrioritizedPrimaryField.ValueOf(db.Statement.Context, db.Statement.ReflectValue); !zero {
+		span.SetTag(_tagInsertID, id)
+	}
+}
+
+// 插入时为传入的数据条数，CreateInBatches 的每一批单独记录；更新时为影响的行数
+func setBatchSizeTag(span opentracing.Span, db *gorm.DB, op string) {
+	switch op {
+	case _opCreate:
+		v := db.Statement.ReflectValue
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array:
+			span.SetTag(_tagBatchSize, v.Len())
+		case reflect.Struct, reflect.Map:
+			span.SetTag(_tagBatchSize, 1)
+		}
+	case _opUpdate:
+		span.SetTag(_tagBatchSize, db.RowsAffected)
+	}
+}
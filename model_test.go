@@ -0,0 +1,85 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type tracingUser struct {
+	ID   int
+	Name string
+}
+
+func TestModelTags(t *testing.T) {
+	tracer := mocktracer.New()
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	var users []tracingUser
+	db.Where("name = ?", "xiaoming").Find(&users)
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+
+	spans := tracer.FinishedSpans()
+	if spans[0].Tag(_tagModel) != "tracingUser" || spans[0].Tag(_tagModelTable) != "tracing_users" {
+		t.Errorf("model tags = %v", spans[0].Tags())
+	}
+	if _, ok := spans[1].Tags()[_tagModel]; ok {
+		t.Error("query without model should not record db.model")
+	}
+}
+
+func TestInsertIDTag(t *testing.T) {
+	tracer := mocktracer.New()
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&tracingUser{ID: 7, Name: "xiaoming"})
+	db.Create(&[]tracingUser{{ID: 8}, {ID: 9}})
+	db.Create(&tracingUser{Name: "xiaohong"})
+
+	spans := tracer.FinishedSpans()
+	if got := spans[0].Tag(_tagInsertID); got != 7 {
+		t.Errorf("db.insert_id = %v", got)
+	}
+	for _, span := range spans[1:] {
+		if _, ok := span.Tags()[_tagInsertID]; ok {
+			t.Errorf("unexpected db.insert_id: %v", span.Tags())
+		}
+	}
+}
+
+func TestBatchSizeTag(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	users := []tracingUser{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}}
+	db.CreateInBatches(&users, 2)
+	db.Create(&tracingUser{ID: 6})
+	db.Table("tracing_users").Create(map[string]interface{}{"id": 7})
+	db.Model(&tracingUser{}).Where("id > ?", 0).Update("name", "xiaoming")
+
+	want := []interface{}{2, 2, 1, 1, 1, int64(1)}
+	spans := tracer.FinishedSpans()
+	if len(spans) != len(want) {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	for n, span := range spans {
+		if got := span.Tag(_tagBatchSize); got != want[n] {
+			t.Errorf("span %d: db.batch.size = %v (%T), want %v", n, got, got, want[n])
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package istiogormtracing
+
+import (
+	"fmt"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+// 同时上报到多个后端，如 jaeger + 控制台、OTLP + 文件，迁移追踪系统时可以新旧两套同时上报
+// 与 jaeger.NewCompositeReporter 不同，每个后端独立处理失败，某个后端 panic 只会记录日志，不影响其他后端
+func NewMultiReporter(reporters ...jaeger.Reporter) jaeger.Reporter {
+	return newMultiReporter(jaeger.StdLogger, reporters...)
+}
+
+func newMultiReporter(logger jaeger.Logger, reporters ...jaeger.Reporter) *multiReporter {
+	return &multiReporter{reporters: reporters, logger: newSyncLogger(logger)}
+}
+
+type multiReporter struct {
+	reporters []jaeger.Reporter
+	logger    *syncLogger
+}
+
+func (r *multiReporter) Report(span *jaeger.Span) {
+	for _, reporter := range r.reporters {
+		r.safe(reporter, func() { reporter.Report(span) })
+	}
+}
+
+func (r *multiReporter) Close() {
+	for _, reporter := range r.reporters {
+		r.safe(reporter, reporter.Close)
+	}
+}
+
+// 同时替换各个后端的日志组件
+func (r *multiReporter) setLogger(logger jaeger.Logger) {
+	r.logger.set(logger)
+	for _, reporter := range r.reporters {
+		if s, ok := reporter.(loggerSetter); ok {
+			s.setLogger(logger)
+		}
+	}
+}
+
+func (r *multiReporter) safe(reporter jaeger.Reporter, fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			r.logger.Error(fmt.Sprintf("%T 上报失败, 错误原因: %v", reporter, err))
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,26 @@
+package istiogormtracing
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+type panicReporter struct{}
+
+func (panicReporter) Report(*jaeger.Span) { panic("boom") }
+func (panicReporter) Close()              { panic("boom") }
+
+func TestMultiReporterIsolation(t *testing.T) {
+	var buf bytes.Buffer
+	recorder := jaeger.NewInMemoryReporter()
+	reporter := newMultiReporter(jaeger.NullLogger, panicReporter{}, NewConsoleReporter(&buf), recorder)
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), reporter)
+	defer closer.Close()
+	tracer.StartSpan(_opQuery).Finish()
+
+	if buf.Len() == 0 || recorder.SpansSubmitted() != 1 {
+		t.Errorf("console = %q, recorder = %d", buf.String(), recorder.SpansSubmitted())
+	}
+}
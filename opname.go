@@ -0,0 +1,54 @@
+package istiogormtracing
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"gorm.io/gorm"
+)
+
+// 操作名称模板中可以使用的数据
+type OperationNameData struct {
+	// SQL 的操作类型，如 SELECT、INSERT
+	Op string
+	// 表名，Raw 和 Exec 执行的 SQL 从 SQL 中解析，解析不出时为空
+	Table string
+	// gorm 的回调类型，即默认的操作名称，如 query、create
+	Callback string
+	// 库名，见 WithDBName
+	DB string
+}
+
+// 设置 span 操作名称的模板，如 "{{.Op}} {{.Table}}" 生成的名称为 SELECT users，可用的字段见 OperationNameData
+// 默认使用 query、create 等回调类型作为操作名称；SetOperationName 设置的名称优先；模板错误时注册插件会失败
+func WithOperationNameTemplate(text string) Option {
+	return func(i *IstioGormTracing) {
+		tmpl, err := template.New("operation").Parse(text)
+		if err != nil {
+			i.optionErr = fmt.Errorf("操作名称模板解析失败, 错误原因: %w", err)
+			return
+		}
+		i.opNameTemplate = tmpl
+	}
+}
+
+// 按模板生成操作名称，SQL 执行后才能确定表名和操作类型，因此在后置事件中修改名称
+func (i *IstioGormTracing) renameOperation(db *gorm.DB, op string) (string, bool) {
+	if i.opNameTemplate == nil || customOperationName(db) != "" {
+		return "", false
+	}
+	var b strings.Builder
+	err := i.opNameTemplate.Execute(&b, OperationNameData{
+		Op:       dbOperation(op, db.Statement.SQL.String()),
+		Table:    statementTable(db),
+		Callback: op,
+		DB:       i.dbInstance(db),
+	})
+	if err != nil {
+		i.getLogger().Error("操作名称生成失败, 错误原因: " + err.Error())
+		return "", false
+	}
+	name := strings.Join(strings.Fields(b.String()), " ")
+	return name, name != ""
+}
@@ -0,0 +1,46 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestWithOperationNameTemplate(t *testing.T) {
+	tracer := mocktracer.New()
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewWithTracer(tracer, WithOperationNameTemplate("{{.Op}} {{.Table}}"), WithDBName("shop"))); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	db.Table("orders").Create(map[string]interface{}{"id": 1})
+	SetOperationName(db, "load-users").Table("users").Find(&list)
+	db.Exec("TRUNCATE logs")
+
+	want := []string{"SELECT users", "INSERT orders", "load-users", "TRUNCATE logs"}
+	spans := tracer.FinishedSpans()
+	if len(spans) != len(want) {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	for n, span := range spans {
+		if span.OperationName != want[n] {
+			t.Errorf("span %d: operation = %q, want %q", n, span.OperationName, want[n])
+		}
+	}
+}
+
+func TestWithOperationNameTemplateInvalid(t *testing.T) {
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewWithTracer(mocktracer.New(), WithOperationNameTemplate("{{.Op"))); err == nil {
+		t.Error("expected error for invalid template")
+	}
+}
@@ -0,0 +1,340 @@
+package istiogormtracing
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/config"
+)
+
+// 插件的可选配置项
+type Option func(*IstioGormTracing)
+
+// 设置此项目的微服务名称
+func WithServiceName(svcName string) Option {
+	return func(i *IstioGormTracing) {
+		i.ServiceName = svcName
+	}
+}
+
+// 设置 jaeger 收集器的地址(如:http://127.0.0.1:14268/api/traces)
+func WithCollectorEndpoint(collectorEndpoint string) Option {
+	return func(i *IstioGormTracing) {
+		i.CollectorEndpoint = collectorEndpoint
+	}
+}
+
+// 使用 TLS 连接 jaeger 收集器，需要自定义 CA 或 mTLS 时使用，可以通过 LoadTLSConfig 从文件中加载证书
+func WithCollectorTLS(tlsConfig *tls.Config) Option {
+	return func(i *IstioGormTracing) {
+		i.collectorTLS = tlsConfig
+	}
+}
+
+// 上报到 jaeger 收集器时使用 basic auth 认证
+func WithCollectorBasicAuth(username, password string) Option {
+	return func(i *IstioGormTracing) {
+		i.collectorUser = username
+		i.collectorPassword = password
+	}
+}
+
+// 上报到 jaeger 收集器时携带 Authorization: Bearer {token}
+func WithCollectorBearerToken(token string) Option {
+	return func(i *IstioGormTracing) {
+		i.collectorToken = token
+	}
+}
+
+// 注册插件(db.Use)时检查 jaeger 收集器是否可以访问，不能访问时返回具体原因(域名解析、证书、认证等)，避免之后静默丢弃所有 span
+func WithValidateEndpoint() Option {
+	return func(i *IstioGormTracing) {
+		i.validateEndpoint = true
+	}
+}
+
+// 设置 span 的上报组件，如 NewZipkinReporter，可以设置多个，每个后端独立上报
+// 设置后不再上报到 jaeger 收集器，除非同时通过 WithCollectorEndpoint 指定了收集器地址
+func WithReporter(reporter jaeger.Reporter) Option {
+	return func(i *IstioGormTracing) {
+		i.reporters = append(i.reporters, reporter)
+	}
+}
+
+// 使用自定义的 SpanExporter 输出 span，与 WithReporter 相同，设置后不再上报到 jaeger 收集器
+func WithExporter(exporter SpanExporter) Option {
+	return WithReporter(NewExporterReporter(exporter))
+}
+
+// 本地开发模式，将 span 以 json 格式输出到标准输出，不再上报到 jaeger 收集器
+func WithConsole() Option {
+	return WithReporter(NewConsoleReporter(nil))
+}
+
+// 通过 UDP 上报到本地的 jaeger agent(如: 127.0.0.1:6831)，sidecar 部署 agent 时使用，设置后不再上报到 jaeger 收集器
+func WithAgentHostPort(hostPort string) Option {
+	return func(i *IstioGormTracing) {
+		i.agentHostPort = hostPort
+	}
+}
+
+// 设置上报到 jaeger agent 时 UDP 包的最大长度，默认为 65000，需要与 agent 的 --processor.jaeger-compact.server-max-packet-size 一致
+func WithMaxPacketSize(size int) Option {
+	return func(i *IstioGormTracing) {
+		i.maxPacketSize = size
+	}
+}
+
+// 没有父 span 时生成 128 位的 trace id，与 Istio/Envoy 生成的 trace id 长度一致，默认为 64 位
+func WithGen128Bit() Option {
+	return func(i *IstioGormTracing) {
+		i.gen128Bit = true
+	}
+}
+
+// 设置采样器，默认为 const/1，即全部采样
+func WithSampler(sampler *config.SamplerConfig) Option {
+	return func(i *IstioGormTracing) {
+		i.sampler = sampler
+	}
+}
+
+// 按比例采样，rate 为 0 到 1 之间的小数，如 0.1 表示采样 10% 的查询
+func WithProbabilisticSampler(rate float64) Option {
+	return WithSampler(&config.SamplerConfig{Type: jaeger.SamplerTypeProbabilistic, Param: rate})
+}
+
+// 限速采样，每秒最多采样 perSecond 个 span
+func WithRateLimitingSampler(perSecond float64) Option {
+	return WithSampler(&config.SamplerConfig{Type: jaeger.SamplerTypeRateLimiting, Param: perSecond})
+}
+
+// 由 jaeger 的采样服务(如: http://jaeger-agent:5778/sampling)控制采样策略，每隔 refreshInterval 拉取一次
+// initialRate 为拉取到策略之前使用的采样比例
+func WithRemoteSampler(samplingServerURL string, refreshInterval time.Duration, initialRate float64) Option {
+	return WithSampler(&config.SamplerConfig{
+		Type:                    jaeger.SamplerTypeRemote,
+		Param:                   initialRate,
+		SamplingServerURL:       samplingServerURL,
+		SamplingRefreshInterval: refreshInterval,
+	})
+}
+
+// 远程采样时按操作名称(create、query、update、delete、row、raw)分别采样，收集器可以在运行时单独调整 SQL 的采样比例
+// maxOperations 为最多单独采样的操作数量，超过后使用默认的比例，jaeger 的默认值为 2000
+func WithSamplingMaxOperations(maxOperations int) Option {
+	return func(i *IstioGormTracing) {
+		i.samplingMaxOperations = maxOperations
+	}
+}
+
+// 设置上报队列的长度，队列满了之后新产生的 span 会被丢弃
+func WithReporterQueueSize(size int) Option {
+	return func(i *IstioGormTracing) {
+		i.reporterQueueSize = size
+	}
+}
+
+// 设置定时上报的间隔，默认为 1s，高 QPS 的服务可以适当调大，配合 WithReporterQueueSize 避免丢弃 span
+func WithReporterFlushInterval(interval time.Duration) Option {
+	return func(i *IstioGormTracing) {
+		i.reporterFlushInterval = interval
+	}
+}
+
+// 设置通过 http 上报到 jaeger 收集器时每次上报的 span 数量，默认为 100
+func WithReporterBatchSize(size int) Option {
+	return func(i *IstioGormTracing) {
+		i.reporterBatchSize = size
+	}
+}
+
+// 是否在日志中打印每个上报的 span，默认只在上报到 jaeger 收集器时打印，高 QPS 的服务建议关闭
+func WithLogSpans(enabled bool) Option {
+	return func(i *IstioGormTracing) {
+		i.logSpans = &enabled
+	}
+}
+
+// 设置插件内部使用的日志组件，包括 jaeger tracer、WithReporter 传入的内置 reporter 以及追踪信息解析失败等日志
+// 默认为 jaegerlog.StdLogger，其他日志组件可以通过 LoggerFunc 适配
+func WithLogger(logger jaeger.Logger) Option {
+	return func(i *IstioGormTracing) {
+		i.logger = logger
+	}
+}
+
+// 设置 tracer 级别的 tag，会附加到此服务上报的所有 span 中
+func WithTags(tags map[string]interface{}) Option {
+	return func(i *IstioGormTracing) {
+		for k, v := range tags {
+			i.tags = append(i.tags, opentracing.Tag{Key: k, Value: v})
+		}
+	}
+}
+
+// 设置固定的 span 级别的 tag，如环境、地区、团队、成本中心，会记录在插件创建的每个 span 中
+// 与 WithTags 不同，不依赖后端对进程 tag 的支持，使用 WithTracer 传入的 tracer 时也会生效
+func WithSpanTags(tags map[string]interface{}) Option {
+	return func(i *IstioGormTracing) {
+		for k, v := range tags {
+			i.spanTags = append(i.spanTags, opentracing.Tag{Key: k, Value: v})
+		}
+		sort.Slice(i.spanTags, func(a, b int) bool { return i.spanTags[a].Key < i.spanTags[b].Key })
+	}
+}
+
+// 设置数据库名称，记录在每个 span 的 db.instance tag 中，同一服务连接多个数据库时用于区分
+func WithDBName(name string) Option {
+	return func(i *IstioGormTracing) {
+		i.dbName = name
+	}
+}
+
+// 在 tracer 级别的 tag 中记录部署信息：应用版本，以及通过 downward API 注入的 POD_NAME、POD_NAMESPACE、NODE_NAME
+// 主机名和 IP 由 jaeger 自动记录；version 为空时不记录版本
+func WithProcessTags(version string) Option {
+	return WithTags(processTags(version))
+}
+
+// 设置数据库的 DSN，用于在 span 中记录 peer.address、db.instance、db.user，密码不会被记录
+// 默认从 gorm 官方驱动的 dialector 中读取，使用其他驱动或通过已有连接创建 gorm.DB 时需要设置
+func WithDSN(dsn string) Option {
+	return func(i *IstioGormTracing) {
+		i.dsn = dsn
+	}
+}
+
+// SQL 信息(sql、table、query、bindings)的记录方式
+type SQLRecordMode string
+
+const (
+	// 记录在 span 的日志中，默认的方式
+	SQLAsLogs SQLRecordMode = "logs"
+	// 记录为 span 的 tag，jaeger 中可以按 table=users 等条件搜索
+	SQLAsTags SQLRecordMode = "tags"
+	// 同时记录在日志和 tag 中
+	SQLAsLogsAndTags SQLRecordMode = "both"
+)
+
+// 设置 SQL 信息的记录方式，默认记录在 span 的日志中
+func WithSQLRecordMode(mode SQLRecordMode) Option {
+	return func(i *IstioGormTracing) {
+		i.sqlRecordMode = mode
+	}
+}
+
+// 设置记录哪些 SQL 信息，如只记录模板和参数: WithSQLFields(SQLFieldTemplate, SQLFieldVars)，默认全部记录
+func WithSQLFields(fields ...SQLField) Option {
+	return func(i *IstioGormTracing) {
+		i.sqlFieldSet = 0
+		for _, f := range fields {
+			i.sqlFieldSet |= f
+		}
+	}
+}
+
+// 设置记录的 SQL 的最大长度(字节)，超过时截断并在 span 中标记 truncated=true，避免批量插入的 SQL 过大被收集器丢弃
+// 默认不限制
+func WithMaxSQLLength(length int) Option {
+	return func(i *IstioGormTracing) {
+		i.maxSQLLength = length
+	}
+}
+
+// 隐私模式，SQL 中的参数可能包含邮箱、token、密码等敏感信息，开启后只记录带占位符(?、$1)的 SQL，不记录参数
+func WithRedactParams() Option {
+	return func(i *IstioGormTracing) {
+		i.redactParams = true
+	}
+}
+
+// 设置敏感字段，如 password、ssn、card_number，这些字段的参数在记录的 SQL 和参数中会被替换为 ***，不区分大小写
+// 根据 SQL 中的条件(如 password = ?)和 INSERT 的字段列表确定参数对应的字段
+func WithMaskColumns(columns ...string) Option {
+	return func(i *IstioGormTracing) {
+		if i.maskColumns == nil {
+			i.maskColumns = map[string]bool{}
+		}
+		for _, column := range columns {
+			i.maskColumns[strings.ToLower(column)] = true
+		}
+	}
+}
+
+// 设置记录 SQL 前的处理方法，依次作用于完整 SQL、模板和参数，可以使用内置的 SanitizeEmails、SanitizePhones、SanitizeBearerTokens
+// 或通过 RegexpSanitizer 自定义规则，多次调用时追加
+func WithSQLSanitizer(sanitizers ...SQLSanitizer) Option {
+	return func(i *IstioGormTracing) {
+		i.sqlSanitizers = append(i.sqlSanitizers, sanitizers...)
+	}
+}
+
+// 在 db.statement.fingerprint 中记录 SQL 指纹，字符串、数字等参数替换为 ?，合并 IN 列表和空白，相同结构的 SQL 指纹相同
+// hashed 为 true 时记录指纹的 sha256 值(16 位)，避免 tag 过长
+func WithFingerprint(hashed bool) Option {
+	return func(i *IstioGormTracing) {
+		i.fingerprintEnabled = true
+		i.fingerprintHashed = hashed
+	}
+}
+
+// 按 OpenTelemetry 数据库语义约定记录 SQL 信息，以 db.statement、db.operation、db.sql.table、server.address 等 tag
+// 代替默认的 sql、table、query、bindings 日志字段，便于依赖语义约定的后端做 SQL 分析
+func WithSemanticConventions() Option {
+	return func(i *IstioGormTracing) {
+		i.semconv = true
+	}
+}
+
+// 设置在 gorm.Statement 中保存 span 使用的 key(db.InstanceSet)，默认为 istio-gorm-tracing
+// 其他插件使用了相同的 key 时可以修改，避免互相覆盖
+func WithSpanKey(key string) Option {
+	return func(i *IstioGormTracing) {
+		i.spanKey = key
+	}
+}
+
+// 使用外部创建好的 tracer，设置后插件不再自行初始化 jaeger tracer
+func WithTracer(tracer opentracing.Tracer) Option {
+	return func(i *IstioGormTracing) {
+		i.tracer = tracer
+	}
+}
+
+// 设置插件 Close 时需要一并关闭的资源，如外部创建的 tracer 的上报组件
+func WithCloser(closer io.Closer) Option {
+	return func(i *IstioGormTracing) {
+		i.closer = closer
+	}
+}
+
+// 设置解析和注入追踪信息使用的格式，默认依次尝试 B3、B3 单 header、W3C、jaeger 格式
+// 只对 jaeger tracer 生效，其他 tracer 使用 tracer 自己注册的格式
+func WithPropagator(propagator Propagator) Option {
+	return func(i *IstioGormTracing) {
+		i.propagator = propagator
+	}
+}
+
+// 将 baggage 中指定的 key 记录为 span 的 tag，key 为 baggage 的名称，value 为 tag 的名称
+// 如: WithBaggageTags(map[string]string{"tenant": "tenant.id"})
+func WithBaggageTags(mapping map[string]string) Option {
+	return func(i *IstioGormTracing) {
+		i.baggageTags = mapping
+	}
+}
+
+// 设置从 context 中获取其他追踪 API 的父 span 的方法，context 中没有 opentracing 的 span 时使用
+// 如使用 OpenTelemetry 时，otelhttp 等创建的 span 只保存在 OpenTelemetry 的 context 中，见 oteltracing 子包
+func WithParentFromContext(fn func(ctx context.Context) opentracing.SpanContext) Option {
+	return func(i *IstioGormTracing) {
+		i.parentFromContext = fn
+	}
+}
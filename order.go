@@ -0,0 +1,105 @@
+package istiogormtracing
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 插件的回调事件名称前缀，通过 WithCallbackNamespace 修改
+const _eventPrefix = "istio-gorm-tracing-event:"
+
+// 插件的 SQL span 与其他插件(如 gorm-opentelemetry、gorm-prometheus)回调的先后顺序
+type CallbackOrder int
+
+const (
+	// 默认，只保证在 gorm 的回调前后执行，与其他插件的顺序不确定
+	CallbackOrderDefault CallbackOrder = iota
+	// 插件的前置回调在其他插件的前置回调之前执行，后置回调在其他插件的后置回调之后执行，插件的 span 包含其他插件的耗时
+	CallbackOrderOuter
+	// 插件的前置回调在其他插件的前置回调之后执行，后置回调在其他插件的后置回调之前执行，插件的 span 只包含 SQL 的耗时
+	CallbackOrderInner
+)
+
+// 设置回调事件名称和 gorm.Statement 中 key 的命名空间，默认为 istio-gorm-tracing
+// 同一个 gorm.DB 上注册多个插件实例(如同时上报到两套追踪系统)或与使用相同名称的插件共存时，每个实例使用不同的命名空间
+// WithSpanKey 设置的 key 优先
+func WithCallbackNamespace(namespace string) Option {
+	return func(i *IstioGormTracing) {
+		i.callbackNamespace = namespace
+	}
+}
+
+// 设置插件回调与其他插件回调的先后顺序，before 和 after 为其他插件的前置和后置回调名称，其中的 %s 会替换为
+// create、query、update、delete、row、raw，如 WithCallbackOrder(CallbackOrderInner, "otel:before_%s", "otel:after_%s")
+// 其他插件需要先注册，注册插件时找不到对应的回调则使用默认顺序
+func WithCallbackOrder(order CallbackOrder, before, after string) Option {
+	return func(i *IstioGormTracing) {
+		if order != CallbackOrderDefault && (before == "" || after == "") {
+			i.optionErr = fmt.Errorf("回调顺序需要设置其他插件的前置和后置回调名称")
+			return
+		}
+		i.callbackOrder = order
+		i.orderBefore = before
+		i.orderAfter = after
+	}
+}
+
+// 加上命名空间的回调事件名称
+func (i *IstioGormTracing) eventName(name string) string {
+	if i.callbackNamespace == "" {
+		return name
+	}
+	return i.callbackNamespace + "-event:" + strings.TrimPrefix(name, _eventPrefix)
+}
+
+// 插件前置回调和后置回调的位置，空字符串表示不限制
+type hookAnchors struct {
+	beforeHookBefore, beforeHookAfter string
+	afterHookBefore, afterHookAfter   string
+}
+
+// op 对应的 gorm 回调前后的位置，按 WithCallbackOrder 的设置放在其他插件的回调之前或之后
+func (i *IstioGormTracing) hookAnchors(db *gorm.DB, op string) hookAnchors {
+	gormName := "gorm:" + op
+	anchors := hookAnchors{beforeHookBefore: gormName, afterHookAfter: gormName}
+	if i.callbackOrder == CallbackOrderDefault {
+		return anchors
+	}
+	before, after := strings.Replace(i.orderBefore, "%s", op, -1), strings.Replace(i.orderAfter, "%s", op, -1)
+	p := processorOf(db, op)
+	if p == nil || p.Get(before) == nil || p.Get(after) == nil {
+		return anchors
+	}
+	switch i.callbackOrder {
+	case CallbackOrderOuter:
+		// 其他插件的前置回调在 gorm 回调之前，因此插件的前置回调也在 gorm 回调之前
+		anchors.beforeHookBefore = before
+		anchors.afterHookAfter = after
+	case CallbackOrderInner:
+		anchors.beforeHookAfter = before
+		anchors.afterHookBefore = after
+	}
+	return anchors
+}
+
+// op 对应的 gorm 回调处理器
+func processorOf(db *gorm.DB, op string) callbackProcessor {
+	cb := db.Callback()
+	switch op {
+	case _opCreate:
+		return cb.Create()
+	case _opUpdate:
+		return cb.Update()
+	case _opQuery:
+		return cb.Query()
+	case _opDelete:
+		return cb.Delete()
+	case _opRow:
+		return cb.Row()
+	case _opRaw:
+		return cb.Raw()
+	}
+	return nil
+}
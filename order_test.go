@@ -0,0 +1,74 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+)
+
+// 模拟其他插件，记录回调执行时插件的 span 是否已经创建
+func registerOtherPlugin(t *testing.T, db *gorm.DB, key string, seen map[string]bool) {
+	t.Helper()
+	q := db.Callback().Query()
+	if err := q.Before("gorm:query").Register("other:before_query", func(db *gorm.DB) {
+		_, seen["before"] = db.InstanceGet(key)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.After("gorm:query").Register("other:after_query", func(db *gorm.DB) {
+		v, _ := db.InstanceGet(key)
+		span, ok := v.(*mocktracer.MockSpan)
+		seen["after"] = ok && span.FinishTime.IsZero()
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithCallbackOrder(t *testing.T) {
+	for _, c := range []struct {
+		order         CallbackOrder
+		before, after bool
+	}{
+		// 外层: 其他插件的前置回调执行时 span 已创建，后置回调执行时 span 还没有结束
+		{CallbackOrderOuter, true, true},
+		{CallbackOrderInner, false, false},
+	} {
+		db := openDB(t)
+		seen := map[string]bool{}
+		registerOtherPlugin(t, db, spankey, seen)
+		if err := db.Use(NewWithTracer(mocktracer.New(), WithCallbackOrder(c.order, "other:before_%s", "other:after_%s"))); err != nil {
+			t.Fatal(err)
+		}
+		var list []map[string]interface{}
+		db.Table("users").Find(&list)
+		if seen["before"] != c.before || seen["after"] != c.after {
+			t.Errorf("order %d: seen = %v", c.order, seen)
+		}
+	}
+
+	if err := openDB(t).Use(NewWithTracer(mocktracer.New(), WithCallbackOrder(CallbackOrderInner, "", ""))); err == nil {
+		t.Error("expected error without callback names")
+	}
+}
+
+func TestWithCallbackNamespace(t *testing.T) {
+	first, second := mocktracer.New(), mocktracer.New()
+	db := openDB(t)
+	if err := NewWithTracer(first).Initialize(db); err != nil {
+		t.Fatal(err)
+	}
+	// 不同命名空间的实例可以注册在同一个 gorm.DB 上，各自创建 span
+	i := NewWithTracer(second, WithCallbackNamespace("audit-tracing"))
+	if err := i.Initialize(db); err != nil {
+		t.Fatal(err)
+	}
+	if i.getSpanKey() != "audit-tracing" || db.Callback().Query().Get("audit-tracing-event:before_query") == nil {
+		t.Errorf("span key = %q", i.getSpanKey())
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	if len(first.FinishedSpans()) != 1 || len(second.FinishedSpans()) != 1 {
+		t.Errorf("spans = %d, %d", len(first.FinishedSpans()), len(second.FinishedSpans()))
+	}
+}
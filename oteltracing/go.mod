@@ -0,0 +1,17 @@
+module github.com/liamhao/istio-gorm-tracing/oteltracing
+
+go 1.16
+
+require (
+	github.com/liamhao/istio-gorm-tracing v0.0.0-20261016074853-841c9bfd9ff4
+	github.com/opentracing/opentracing-go v1.2.0
+	go.opentelemetry.io/contrib/propagators/b3 v1.7.0
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/bridge/opentracing v1.7.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc v1.7.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
+	google.golang.org/grpc v1.46.0
+	gorm.io/gorm v1.23.6
+)
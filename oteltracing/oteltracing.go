@@ -0,0 +1,63 @@
+// 基于 OpenTelemetry 的实现，jaeger-client-go 已经停止维护，迁移到 OpenTelemetry 时使用
+// SQL 的 span 通过 OpenTelemetry 的 TracerProvider 创建，gorm 回调与 istiogormtracing 完全相同
+package oteltracing
+
+import (
+	"context"
+
+	istiogormtracing "github.com/liamhao/istio-gorm-tracing"
+	"github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	otbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 创建 tracer 时使用的 instrumentation 名称
+const instrumentationName = "github.com/liamhao/istio-gorm-tracing"
+
+// 使用 OpenTelemetry 的 TracerProvider 创建插件，TracerProvider 的关闭由调用方负责
+// 使用方式: gormDb.Use(oteltracing.New(tp))
+func New(tp trace.TracerProvider, opts ...istiogormtracing.Option) *istiogormtracing.IstioGormTracing {
+	bt := NewTracer(tp)
+	opts = append([]istiogormtracing.Option{istiogormtracing.WithParentFromContext(parentFromContext(bt))}, opts...)
+	return istiogormtracing.NewWithTracer(bt, opts...)
+}
+
+// 安装官方的 OpenTracing 桥接，已经接入 OpenTelemetry SDK 的项目使用，gorm 的 span 会合并到现有的链路中
+// 使用全局的 TracerProvider(otel.SetTracerProvider 在之后调用也可以)，并将桥接的 tracer 设为 opentracing 的全局 tracer，
+// 项目中其他使用 opentracing 的组件创建的 span 也会交给 OpenTelemetry 处理，不会再出现两个全局 tracer
+// 全局 tracer 已经是桥接的 tracer 时直接复用，多次调用不会重复安装
+func NewGlobal(opts ...istiogormtracing.Option) *istiogormtracing.IstioGormTracing {
+	bt, ok := opentracing.GlobalTracer().(*otbridge.BridgeTracer)
+	if !ok {
+		bt = NewTracer(otel.GetTracerProvider())
+		opentracing.SetGlobalTracer(bt)
+	}
+	opts = append([]istiogormtracing.Option{istiogormtracing.WithParentFromContext(parentFromContext(bt))}, opts...)
+	return istiogormtracing.NewWithTracer(bt, opts...)
+}
+
+// 将 OpenTelemetry 的 TracerProvider 包装为 opentracing.Tracer
+// 解析和注入 header 时支持 W3C trace context、B3 多 header 和 W3C baggage
+func NewTracer(tp trace.TracerProvider) *otbridge.BridgeTracer {
+	bt, _ := otbridge.NewTracerPair(tp.Tracer(instrumentationName, trace.WithInstrumentationVersion(istiogormtracing.Version())))
+	bt.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)),
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	return bt
+}
+
+// otelhttp 等创建的 span 只保存在 OpenTelemetry 的 context 中，需要转换为 opentracing 的 span 才能作为父 span
+func parentFromContext(bt *otbridge.BridgeTracer) func(ctx context.Context) opentracing.SpanContext {
+	return func(ctx context.Context) opentracing.SpanContext {
+		span := trace.SpanFromContext(ctx)
+		if !span.SpanContext().IsValid() {
+			return nil
+		}
+		return opentracing.SpanFromContext(bt.ContextWithBridgeSpan(ctx, span)).Context()
+	}
+}
@@ -0,0 +1,289 @@
+package oteltracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	istiogormtracing "github.com/liamhao/istio-gorm-tracing"
+	"github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel"
+	otbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// 测试用的 database/sql 驱动，执行 SQL 时不访问数据库，查询没有返回数据
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error                                    { return nil }
+func (fakeStmt) NumInput() int                                   { return -1 }
+func (fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return driver.ResultNoRows, nil }
+func (fakeStmt) Query(args []driver.Value) (driver.Rows, error)  { return fakeRows{}, nil }
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string              { return nil }
+func (fakeRows) Close() error                   { return nil }
+func (fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+func init() {
+	sql.Register("oteltracing-fake", fakeDriver{})
+}
+
+// 不连接数据库的 dialector，SQL 由测试驱动 fakeDriver 执行
+type fakeDialector struct{}
+
+func (fakeDialector) Name() string { return "fake" }
+func (fakeDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	sqlDB, err := sql.Open("oteltracing-fake", "")
+	if err != nil {
+		return err
+	}
+	db.ConnPool = sqlDB
+	return nil
+}
+func (fakeDialector) Migrator(db *gorm.DB) gorm.Migrator                          { return nil }
+func (fakeDialector) DataTypeOf(*schema.Field) string                             { return "" }
+func (fakeDialector) DefaultValueOf(*schema.Field) clause.Expression              { return nil }
+func (fakeDialector) BindVarTo(w clause.Writer, _ *gorm.Statement, _ interface{}) { w.WriteByte('?') }
+func (fakeDialector) QuoteTo(w clause.Writer, s string)                           { w.WriteString(s) }
+func (fakeDialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, nil, `'`, vars...)
+}
+
+func openDB(t *testing.T, sr *tracetest.SpanRecorder) (*gorm.DB, *sdktrace.TracerProvider) {
+	t.Helper()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(New(tp)); err != nil {
+		t.Fatal(err)
+	}
+	return db, tp
+}
+
+func TestParentFromOTelContext(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	db, tp := openDB(t, sr)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "http")
+	var list []map[string]interface{}
+	db.WithContext(ctx).Table("users").Find(&list)
+	parent.End()
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "query" {
+		t.Errorf("name = %s", span.Name())
+	}
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() || span.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Errorf("db span parent = %s, want %s", span.Parent().SpanID(), parent.SpanContext().SpanID())
+	}
+}
+
+func TestParentFromHeaders(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	db, _ := openDB(t, sr)
+
+	h := http.Header{}
+	h.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	var list []map[string]interface{}
+	db.WithContext(istiogormtracing.WithHeaders(context.Background(), h)).Table("users").Find(&list)
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("spans = %d, want 1", len(spans))
+	}
+	if got := spans[0].SpanContext().TraceID().String(); got != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("trace id = %s", got)
+	}
+	if got := spans[0].Parent().SpanID().String(); got != "b7ad6b7169203331" {
+		t.Errorf("parent span id = %s", got)
+	}
+}
+
+func TestNewGlobal(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	otel.SetTracerProvider(tp)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewGlobal()); err != nil {
+		t.Fatal(err)
+	}
+	bt, ok := opentracing.GlobalTracer().(*otbridge.BridgeTracer)
+	if !ok {
+		t.Fatalf("global tracer = %T", opentracing.GlobalTracer())
+	}
+	NewGlobal()
+	if opentracing.GlobalTracer() != bt {
+		t.Error("bridge installed twice")
+	}
+
+	// 其他组件通过 opentracing 创建的 span 与 gorm 的 span 在同一条链路中
+	parent := opentracing.StartSpan("http")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+	var list []map[string]interface{}
+	db.WithContext(ctx).Table("users").Find(&list)
+	parent.Finish()
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(spans))
+	}
+	if spans[0].Name() != "query" || spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Errorf("db span = %s, parent = %s", spans[0].Name(), spans[0].Parent().SpanID())
+	}
+}
+
+func TestNewOTLPGRPC(t *testing.T) {
+	i, err := NewOTLPGRPC(context.Background(), "test", OTLPConfig{
+		Endpoint: "127.0.0.1:4317",
+		Insecure: true,
+		Headers:  map[string]string{"authorization": "Bearer token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+}
+
+func TestNewOTLPHTTP(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	i, err := NewOTLPHTTP(context.Background(), "test", OTLPConfig{
+		Endpoint:    strings.TrimPrefix(server.URL, "http://"),
+		Insecure:    true,
+		URLPath:     "/otlp/v1/traces",
+		Compression: true,
+		Headers:     map[string]string{"authorization": "Bearer token"},
+		Retry:       &RetryConfig{Enabled: true, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, MaxElapsedTime: time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(i); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	if err := i.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(requests))
+	}
+	r := requests[0]
+	if r.URL.Path != "/otlp/v1/traces" || r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("request = %s %v", r.URL.Path, r.Header)
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	env := map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": server.URL,
+		"OTEL_EXPORTER_OTLP_HEADERS":  "authorization=Bearer token",
+		"OTEL_SERVICE_NAME":           "test",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	i, err := NewFromEnv(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(i); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	if err := i.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 1 || requests[0].URL.Path != "/v1/traces" || requests[0].Header.Get("Authorization") != "Bearer token" {
+		t.Fatalf("requests = %v", requests)
+	}
+
+	os.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	if _, err := NewFromEnv(context.Background(), ""); err == nil {
+		t.Error("unsupported protocol accepted")
+	}
+}
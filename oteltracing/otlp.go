@@ -0,0 +1,157 @@
+package oteltracing
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"time"
+
+	istiogormtracing "github.com/liamhao/istio-gorm-tracing"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"google.golang.org/grpc/credentials"
+)
+
+// OTLP 导出器的配置
+type OTLPConfig struct {
+	// 收集器地址，如 otel-collector:4317，为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT 或默认的 localhost
+	Endpoint string
+	// 不使用 TLS，集群内直连 OpenTelemetry Collector 时一般需要设置
+	Insecure bool
+	// TLS 配置，为空且 Insecure 为 false 时使用系统的根证书
+	TLSConfig *tls.Config
+	// 每次上报时携带的 header，如认证使用的 token: {"authorization": "Bearer xxx"}
+	Headers map[string]string
+	// 上报使用的路径，只对 OTLP/HTTP 生效，默认为 /v1/traces
+	URLPath string
+	// 是否使用 gzip 压缩上报的内容
+	Compression bool
+	// 上报失败时的重试配置，为空时使用 OpenTelemetry 的默认配置
+	Retry *RetryConfig
+}
+
+// 上报失败时的重试配置，每次重试的间隔按指数增长
+type RetryConfig struct {
+	// 是否重试
+	Enabled bool
+	// 第一次重试前等待的时间
+	InitialInterval time.Duration
+	// 重试间隔的上限
+	MaxInterval time.Duration
+	// 包含重试在内的最长上报时间，超过后丢弃这批 span
+	MaxElapsedTime time.Duration
+}
+
+// 通过 OTLP/gRPC 将 span 上报到 OpenTelemetry Collector、Grafana Tempo 等
+// 插件 Close 时会将缓冲中的 span 全部上报并关闭 TracerProvider
+func NewOTLPGRPC(ctx context.Context, serviceName string, cfg OTLPConfig, opts ...istiogormtracing.Option) (*istiogormtracing.IstioGormTracing, error) {
+	var exporterOpts []otlptracegrpc.Option
+	if cfg.Endpoint != "" {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	} else if cfg.TLSConfig != nil {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(cfg.TLSConfig)))
+	}
+	if len(cfg.Headers) > 0 {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithHeaders(cfg.Headers))
+	}
+	if cfg.Compression {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithCompressor("gzip"))
+	}
+	if cfg.Retry != nil {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig(*cfg.Retry)))
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("otlp grpc exporter 初始化失败, 错误原因: %w", err)
+	}
+	return newWithExporter(serviceName, exporter, opts...), nil
+}
+
+// 通过 OTLP/HTTP 上报，只允许访问外部 HTTPS 的环境使用，Endpoint 的格式为 host:port，如 otel-collector:4318
+func NewOTLPHTTP(ctx context.Context, serviceName string, cfg OTLPConfig, opts ...istiogormtracing.Option) (*istiogormtracing.IstioGormTracing, error) {
+	var exporterOpts []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.URLPath != "" {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithURLPath(cfg.URLPath))
+	}
+	if cfg.Insecure {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithInsecure())
+	} else if cfg.TLSConfig != nil {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithTLSClientConfig(cfg.TLSConfig))
+	}
+	if len(cfg.Headers) > 0 {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+	if cfg.Compression {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
+	if cfg.Retry != nil {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithRetry(otlptracehttp.RetryConfig(*cfg.Retry)))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("otlp http exporter 初始化失败, 错误原因: %w", err)
+	}
+	return newWithExporter(serviceName, exporter, opts...), nil
+}
+
+// 通过 OpenTelemetry 标准的 OTEL_* 环境变量创建插件，如 OTEL_EXPORTER_OTLP_ENDPOINT、OTEL_EXPORTER_OTLP_HEADERS、OTEL_TRACES_SAMPLER
+// OTEL_EXPORTER_OTLP_PROTOCOL 为 grpc 时使用 OTLP/gRPC，默认为 http/protobuf；serviceName 为空时使用 OTEL_SERVICE_NAME
+func NewFromEnv(ctx context.Context, serviceName string, opts ...istiogormtracing.Option) (*istiogormtracing.IstioGormTracing, error) {
+	if serviceName == "" {
+		serviceName = os.Getenv("OTEL_SERVICE_NAME")
+	}
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	// 地址、header、压缩、超时等配置由 OTLP exporter 自己从环境变量中读取
+	switch protocol {
+	case "grpc":
+		return NewOTLPGRPC(ctx, serviceName, OTLPConfig{}, opts...)
+	case "", "http/protobuf":
+		return NewOTLPHTTP(ctx, serviceName, OTLPConfig{}, opts...)
+	default:
+		return nil, fmt.Errorf("不支持的 OTLP 协议: %s", protocol)
+	}
+}
+
+// 使用 exporter 创建 TracerProvider，并在插件 Close 时关闭
+func newWithExporter(serviceName string, exporter sdktrace.SpanExporter, opts ...istiogormtracing.Option) *istiogormtracing.IstioGormTracing {
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(newResource(serviceName)),
+	)
+	opts = append(opts, istiogormtracing.WithCloser(shutdownCloser{tp}))
+	return New(tp, opts...)
+}
+
+// 合并 OTEL_RESOURCE_ATTRIBUTES 中的属性，服务名以参数为准
+func newResource(serviceName string) *resource.Resource {
+	service := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))
+	res, err := resource.Merge(resource.Environment(), service)
+	if err != nil {
+		return service
+	}
+	return res
+}
+
+// 将 TracerProvider.Shutdown 包装为 io.Closer
+type shutdownCloser struct {
+	tp *sdktrace.TracerProvider
+}
+
+func (c shutdownCloser) Close() error {
+	return c.tp.Shutdown(context.Background())
+}
@@ -0,0 +1,99 @@
+package istiogormtracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 预加载的关联名称，如 Orders
+const _tagPreload = "db.preload"
+
+// 注册在 gorm:preload 前后的事件
+const (
+	_eventBeforePreload = "istio-gorm-tracing-event:before_preload"
+	_eventAfterPreload  = "istio-gorm-tracing-event:after_preload"
+)
+
+// 在 context 中保存预加载的表名到关联名称的映射
+type preloadCtxKey struct{}
+
+// 在 gorm.Statement 中保存预加载前的 context 的 key
+func (i *IstioGormTracing) preloadCtxKey() string {
+	return i.getSpanKey() + ":preload"
+}
+
+// 预加载前将主查询的 span 放入 context，预加载的查询会作为它的子 span
+func (i *IstioGormTracing) beforePreload(db *gorm.DB) {
+	releaseConnPool(db)
+	if db.Error != nil || db.Statement == nil || db.Statement.Context == nil || db.Statement.Schema == nil || len(db.Statement.Preloads) == 0 {
+		return
+	}
+	v, ok := db.InstanceGet(i.getSpanKey())
+	if !ok {
+		return
+	}
+	span, ok := v.(opentracing.Span)
+	if !ok || span == nil {
+		return
+	}
+	db.InstanceSet(i.preloadCtxKey(), db.Statement.Context)
+	ctx := opentracing.ContextWithSpan(db.Statement.Context, span)
+	db.Statement.Context = context.WithValue(ctx, preloadCtxKey{}, preloadAssociations(db))
+}
+
+// 预加载后恢复原来的 context
+func (i *IstioGormTracing) afterPreload(db *gorm.DB) {
+	if db.Statement == nil {
+		return
+	}
+	if v, ok := db.InstanceGet(i.preloadCtxKey()); ok {
+		if ctx, ok := v.(context.Context); ok {
+			db.Statement.Context = ctx
+		}
+	}
+}
+
+// 预加载的表名到关联名称的映射，多对多关联还包括中间表
+func preloadAssociations(db *gorm.DB) map[string]string {
+	relations := db.Statement.Schema.Relationships.Relations
+	associations := map[string]string{}
+	add := func(name string) {
+		rel, ok := relations[name]
+		if !ok {
+			return
+		}
+		associations[rel.FieldSchema.Table] = name
+		if rel.JoinTable != nil {
+			associations[rel.JoinTable.Table] = name
+		}
+	}
+	for name := range db.Statement.Preloads {
+		// 嵌套的预加载(如 Orders.Items)由 Orders 的查询处理
+		name = strings.SplitN(name, ".", 2)[0]
+		if name == clause.Associations {
+			for n, rel := range relations {
+				if rel.Schema == db.Statement.Schema {
+					add(n)
+				}
+			}
+			continue
+		}
+		add(name)
+	}
+	return associations
+}
+
+// 预加载的查询记录关联名称
+func setPreloadTag(span opentracing.Span, db *gorm.DB) {
+	associations, ok := db.Statement.Context.Value(preloadCtxKey{}).(map[string]string)
+	if !ok {
+		return
+	}
+	if name := associations[db.Statement.Table]; name != "" {
+		span.SetTag(_tagPreload, name)
+	}
+}
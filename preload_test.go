@@ -0,0 +1,77 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+type preloadOrder struct {
+	ID     int
+	UserID int
+}
+
+type preloadRole struct {
+	ID int
+}
+
+type preloadUser struct {
+	ID     int
+	Orders []preloadOrder `gorm:"foreignKey:UserID"`
+	Roles  []preloadRole  `gorm:"many2many:preload_user_roles"`
+}
+
+func TestPreloadSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	// 测试驱动不返回数据，结构体中已有的主键用于预加载
+	user := preloadUser{ID: 1}
+	if err := db.Preload("Orders").Preload("Roles").Find(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.FinishedSpans()
+	var parent *mocktracer.MockSpan
+	preloads := map[string]string{}
+	for _, span := range spans {
+		if _, ok := span.Tags()[_tagPreload]; !ok {
+			parent = span
+		}
+	}
+	if parent == nil || len(spans) != 3 {
+		t.Fatalf("spans = %v", spans)
+	}
+	for _, span := range spans {
+		if span == parent {
+			continue
+		}
+		if span.ParentID != parent.SpanContext.SpanID {
+			t.Errorf("preload span %v is not a child of the primary query", span.Tags())
+		}
+		preloads[span.Tag(_tagModelTable).(string)] = span.Tag(_tagPreload).(string)
+	}
+	if preloads["preload_orders"] != "Orders" || preloads["preload_user_roles"] != "Roles" {
+		t.Errorf("db.preload = %v", preloads)
+	}
+}
+
+func TestPreloadAssociations(t *testing.T) {
+	db := openDB(t)
+	tx := db.Preload("Orders.Items").Preload("Roles").Model(&preloadUser{})
+	if err := tx.Statement.Parse(&preloadUser{}); err != nil {
+		t.Fatal(err)
+	}
+	got := preloadAssociations(tx)
+	want := map[string]string{"preload_orders": "Orders", "preload_roles": "Roles", "preload_user_roles": "Roles"}
+	if len(got) != len(want) {
+		t.Fatalf("associations = %v", got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("associations[%q] = %q, want %q", k, got[k], v)
+		}
+	}
+}
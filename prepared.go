@@ -0,0 +1,232 @@
+package istiogormtracing
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"gorm.io/gorm"
+)
+
+// 预编译模式(PrepareStmt)的信息，db.prepared.new 为 true 时本次执行包含了预编译的耗时
+const (
+	_tagPrepared    = "db.prepared"
+	_tagPreparedNew = "db.prepared.new"
+)
+
+// 预编译模式下的 PreparedStmtDB，事务中为 PreparedStmtTX 中的 PreparedStmtDB
+func preparedStmtDB(db *gorm.DB) *gorm.PreparedStmtDB {
+	var p *gorm.PreparedStmtDB
+	switch pool := db.Statement.ConnPool.(type) {
+	case *gorm.PreparedStmtDB:
+		p = pool
+	case *gorm.PreparedStmtTX:
+		p = pool.PreparedStmtDB
+	default:
+		return nil
+	}
+	p, _ = unwrapPreparedStmtDB(p)
+	return p
+}
+
+// 在 gorm.Statement 中保存执行前已预编译的 SQL 数量的 key
+func (i *IstioGormTracing) preparedKey() string {
+	return i.getSpanKey() + ":prepared"
+}
+
+// 记录执行前已预编译的 SQL 数量，执行后新增的 SQL 中包含本次的 SQL 时，说明本次执行进行了预编译
+func (i *IstioGormTracing) markPrepared(db *gorm.DB) {
+	p := preparedStmtDB(db)
+	if p == nil || p.Mux == nil {
+		return
+	}
+	p.Mux.RLock()
+	n := len(p.PreparedSQL)
+	p.Mux.RUnlock()
+	db.InstanceSet(i.preparedKey(), n)
+}
+
+// 预编译模式下标记 db.prepared=true，并记录本次执行是否进行了预编译
+func (i *IstioGormTracing) setPreparedTags(span opentracing.Span, db *gorm.DB) {
+	p := preparedStmtDB(db)
+	if p == nil {
+		return
+	}
+	span.SetTag(_tagPrepared, true)
+	v, ok := db.InstanceGet(i.preparedKey())
+	if !ok || p.Mux == nil {
+		return
+	}
+	before, _ := v.(int)
+	sql := db.Statement.SQL.String()
+	prepared := false
+	p.Mux.RLock()
+	if before <= len(p.PreparedSQL) {
+		for _, s := range p.PreparedSQL[before:] {
+			if s == sql {
+				prepared = true
+				break
+			}
+		}
+	}
+	p.Mux.RUnlock()
+	span.SetTag(_tagPreparedNew, prepared)
+}
+
+// 预编译 SQL 的 span，作为执行 SQL 的 span 的子 span
+const _opPrepare = "prepare"
+
+// 预编译模式(PrepareStmt)下，SQL 第一次执行时为预编译单独创建 prepare span，区分预编译和执行的耗时
+// 只记录 gorm 的预编译，database/sql 在其他连接上重新预编译时不会记录
+func WithPrepareSpans() Option {
+	return func(i *IstioGormTracing) {
+		i.prepareSpans = true
+	}
+}
+
+// 在一条 SQL 执行期间替换 gorm 预编译使用的连接，预编译时创建 prepare span
+type prepareTracer struct {
+	plugin *IstioGormTracing
+	parent opentracing.Span
+	// 原来的 PreparedStmtDB，预编译的 SQL 记录到它的 PreparedSQL 中
+	origin *gorm.PreparedStmtDB
+	// 替换前后 db.Statement.ConnPool 的值
+	previous gorm.ConnPool
+	current  gorm.ConnPool
+}
+
+// 预编译 SQL，gorm 调用时已持有 origin.Mux 的写锁
+func (t *prepareTracer) prepare(ctx context.Context, query string, prepare func(ctx context.Context, query string) (*sql.Stmt, error)) (*sql.Stmt, error) {
+	opts := []opentracing.StartSpanOption{
+		opentracing.ChildOf(t.parent.Context()),
+		ext.SpanKindRPCClient,
+		opentracing.Tag{Key: string(ext.Component), Value: _component},
+	}
+	for _, tag := range t.plugin.spanTags {
+		opts = append(opts, tag)
+	}
+	// WithMinDuration 开启时与 SQL 的 span 一起上报或丢弃
+	span := pendingChildSpan(t.plugin.getTracer().StartSpan(_opPrepare, opts...), t.parent)
+	span.LogFields(opentracinglog.String(_fieldSQL, t.plugin.sanitize(query)))
+	stmt, err := prepare(ctx, query)
+	failed := err != nil && t.plugin.isError(err)
+	if failed {
+		setSpanError(span, err)
+	}
+	t.plugin.endSpan(span, failed)
+	if err != nil {
+		return stmt, err
+	}
+	t.origin.PreparedSQL = append(t.origin.PreparedSQL, query)
+	return stmt, nil
+}
+
+// PreparedStmtDB 预编译时使用的连接池
+type preparePool struct {
+	gorm.ConnPool
+	tracer *prepareTracer
+}
+
+func (p *preparePool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.tracer.prepare(ctx, query, p.ConnPool.PrepareContext)
+}
+
+func (p *preparePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if beginner, ok := p.ConnPool.(gorm.TxBeginner); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return nil, gorm.ErrInvalidTransaction
+}
+
+// 实现 gorm.GetDBConnector，使 db.DB() 返回原来的 *sql.DB
+func (p *preparePool) GetDBConn() (*sql.DB, error) {
+	if connector, ok := p.ConnPool.(gorm.GetDBConnector); ok {
+		return connector.GetDBConn()
+	}
+	if sqlDB, ok := p.ConnPool.(*sql.DB); ok {
+		return sqlDB, nil
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// PreparedStmtTX 预编译时使用的事务
+type prepareTx struct {
+	gorm.Tx
+	tracer *prepareTracer
+}
+
+func (t *prepareTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.tracer.prepare(ctx, query, t.Tx.PrepareContext)
+}
+
+// 原来的 PreparedStmtDB 和它的连接池，会话复制了上一条 SQL 替换后的 PreparedStmtDB 时取出原来的
+func unwrapPreparedStmtDB(p *gorm.PreparedStmtDB) (*gorm.PreparedStmtDB, gorm.ConnPool) {
+	if pool, ok := p.ConnPool.(*preparePool); ok {
+		return pool.tracer.origin, pool.ConnPool
+	}
+	return p, p.ConnPool
+}
+
+// 将 db.Statement.ConnPool 替换为共用预编译 SQL 的 PreparedStmtDB(与 gorm 的 Session 相同)，预编译时创建 prepare span
+func (i *IstioGormTracing) wrapPreparedStmt(span opentracing.Span, db *gorm.DB) {
+	t := &prepareTracer{plugin: i, parent: span, previous: originalConnPool(db.Statement.ConnPool)}
+	var p *gorm.PreparedStmtDB
+	switch pool := db.Statement.ConnPool.(type) {
+	case *gorm.PreparedStmtDB:
+		p = pool
+	case *gorm.PreparedStmtTX:
+		p = pool.PreparedStmtDB
+	default:
+		return
+	}
+	origin, conn := unwrapPreparedStmtDB(p)
+	if origin.Mux == nil || origin.Stmts == nil {
+		return
+	}
+	t.origin = origin
+	wrapped := &gorm.PreparedStmtDB{ConnPool: &preparePool{ConnPool: conn, tracer: t}, Stmts: origin.Stmts, Mux: origin.Mux}
+	t.current = wrapped
+	if pool, ok := db.Statement.ConnPool.(*gorm.PreparedStmtTX); ok {
+		tx := pool.Tx
+		if w, ok := tx.(*prepareTx); ok {
+			tx = w.Tx
+		}
+		t.current = &gorm.PreparedStmtTX{Tx: &prepareTx{Tx: tx, tracer: t}, PreparedStmtDB: wrapped}
+	}
+	db.Statement.ConnPool = t.current
+	db.InstanceSet(i.prepareTracerKey(), t)
+}
+
+// 替换前的 PreparedStmtTX，同一事务的 SQL 使用相同的事务 id
+func originalConnPool(pool gorm.ConnPool) gorm.ConnPool {
+	for {
+		tx, ok := pool.(*gorm.PreparedStmtTX)
+		if !ok {
+			return pool
+		}
+		w, ok := tx.Tx.(*prepareTx)
+		if !ok {
+			return pool
+		}
+		pool = w.tracer.previous
+	}
+}
+
+// 在 gorm.Statement 中保存 prepareTracer 的 key
+func (i *IstioGormTracing) prepareTracerKey() string {
+	return i.getSpanKey() + ":prepare"
+}
+
+// 恢复 db.Statement.ConnPool，gorm 提交默认事务时已经修改过的不再恢复
+func (i *IstioGormTracing) unwrapPreparedStmt(db *gorm.DB) {
+	v, ok := db.InstanceGet(i.prepareTracerKey())
+	if !ok {
+		return
+	}
+	t, _ := v.(*prepareTracer)
+	if t != nil && db.Statement.ConnPool == t.current {
+		db.Statement.ConnPool = t.previous
+	}
+}
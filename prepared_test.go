@@ -0,0 +1,85 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+)
+
+func TestPreparedTags(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	prepared := db.Session(&gorm.Session{PrepareStmt: true})
+	prepared.Table("users").Where("id = ?", 1).Find(&list)
+	prepared.Table("users").Where("id = ?", 2).Find(&list)
+	prepared.Transaction(func(tx *gorm.DB) error {
+		return tx.Table("orders").Find(&list).Error
+	})
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 4 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	if _, ok := spans[0].Tags()[_tagPrepared]; ok {
+		t.Error("db.prepared should not be recorded without PrepareStmt")
+	}
+	for n, want := range []bool{true, false, true} {
+		span := spans[n+1]
+		if span.Tag(_tagPrepared) != true || span.Tag(_tagPreparedNew) != want {
+			t.Errorf("span %d: tags = %v", n+1, span.Tags())
+		}
+	}
+}
+
+func TestWithPrepareSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithPrepareSpans())); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	prepared := db.Session(&gorm.Session{PrepareStmt: true})
+	prepared.Table("users").Where("id = ?", 1).Find(&list)
+	prepared.Table("users").Where("id = ?", 2).Find(&list)
+	prepared.Table("orders").Create(map[string]interface{}{"id": 1})
+	prepared.Table("orders").Where("id = ?", 1).Find(&list)
+
+	spans := tracer.FinishedSpans()
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.OperationName)
+	}
+	want := []string{"prepare", "query", "query", "prepare", "create", "prepare", "query"}
+	if len(names) != len(want) {
+		t.Fatalf("spans = %v", names)
+	}
+	for n := range want {
+		if names[n] != want[n] {
+			t.Fatalf("spans = %v, want %v", names, want)
+		}
+	}
+	for _, n := range []int{0, 3, 5} {
+		if spans[n].ParentID != spans[n+1].SpanContext.SpanID {
+			t.Errorf("span %d: prepare span should be a child of the SQL span", n)
+		}
+	}
+	if spans[0].Logs()[0].Fields[0].ValueString != "SELECT * FROM users WHERE id = ?" {
+		t.Errorf("prepare logs = %v", spans[0].Logs())
+	}
+	// 默认事务中预编译的 SQL 与插入的 span 有相同的事务 id
+	if spans[4].Tag(_tagTransactionID) == nil {
+		t.Errorf("create: tags = %v", spans[4].Tags())
+	}
+	if spans[4].Tag(_tagPreparedNew) != true || spans[2].Tag(_tagPreparedNew) != false {
+		t.Errorf("db.prepared.new = %v, %v", spans[4].Tag(_tagPreparedNew), spans[2].Tag(_tagPreparedNew))
+	}
+	if _, ok := prepared.Statement.ConnPool.(*gorm.PreparedStmtDB); !ok {
+		t.Errorf("ConnPool = %T", prepared.Statement.ConnPool)
+	}
+}
@@ -0,0 +1,36 @@
+package istiogormtracing
+
+import "os"
+
+// 通过 k8s downward API 注入的环境变量，分别对应 metadata.name、metadata.namespace、spec.nodeName
+const (
+	_envPodName      = "POD_NAME"
+	_envPodNamespace = "POD_NAMESPACE"
+	_envNodeName     = "NODE_NAME"
+)
+
+// 进程级别的 tag，名称与 OpenTelemetry 的资源属性保持一致
+const (
+	_tagPodName        = "k8s.pod.name"
+	_tagPodNamespace   = "k8s.namespace.name"
+	_tagNodeName       = "k8s.node.name"
+	_tagServiceVersion = "service.version"
+)
+
+// 从环境变量中读取部署信息，没有设置的跳过
+func processTags(version string) map[string]interface{} {
+	tags := map[string]interface{}{}
+	for env, key := range map[string]string{
+		_envPodName:      _tagPodName,
+		_envPodNamespace: _tagPodNamespace,
+		_envNodeName:     _tagNodeName,
+	} {
+		if v := os.Getenv(env); v != "" {
+			tags[key] = v
+		}
+	}
+	if version != "" {
+		tags[_tagServiceVersion] = version
+	}
+	return tags
+}
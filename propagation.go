@@ -0,0 +1,359 @@
+package istiogormtracing
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/zipkin"
+)
+
+const (
+	// B3 单个 header 格式使用的 header
+	_headerB3Single = "b3"
+	// W3C trace context 使用的 header
+	_headerTraceparent = "traceparent"
+	_headerTracestate  = "tracestate"
+
+	// tracestate 保存在 baggage 中使用的 key
+	_baggageTracestate = "tracestate"
+
+	// jaeger span context 的采样标记位
+	_flagSampled = 0x01
+	_flagDebug   = 0x02
+)
+
+// 追踪信息在 header 中的传递格式，可以通过 WithPropagator 替换为自定义的实现
+// carrier 一般为 opentracing.HTTPHeadersCarrier，也可以是任意的 opentracing.TextMapReader/TextMapWriter
+type Propagator interface {
+	jaeger.Injector
+	jaeger.Extractor
+}
+
+// 内置格式的名称，用于 NewCompositePropagator 指定解析顺序
+const (
+	FormatB3       = "b3"
+	FormatB3Single = "b3-single"
+	FormatW3C      = "w3c"
+	FormatJaeger   = "jaeger"
+	FormatDatadog  = "datadog"
+	FormatXRay     = "xray"
+	FormatSW8      = "sw8"
+)
+
+// 解析父 span，jaeger tracer 使用插件配置的 Propagator，其他 tracer 只能交给 tracer 自己解析
+// 不同 tracer 的 SpanContext 不能混用，否则创建 span 时会 panic
+// 使用 CompositePropagator 时会同时返回匹配到的格式名称
+func (i *IstioGormTracing) extractParent(h http.Header) (opentracing.SpanContext, string, error) {
+	tracer := i.getTracer()
+	if _, ok := tracer.(*jaeger.Tracer); !ok {
+		spanCtx, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h))
+		return spanCtx, "", err
+	}
+
+	var (
+		spanCtx jaeger.SpanContext
+		format  string
+		err     error
+	)
+	if c, ok := i.getPropagator().(*CompositePropagator); ok {
+		spanCtx, format, err = c.ExtractFormat(opentracing.HTTPHeadersCarrier(h))
+	} else {
+		spanCtx, err = i.getPropagator().Extract(opentracing.HTTPHeadersCarrier(h))
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return spanCtx, format, nil
+}
+
+// 获取插件使用的 Propagator，未设置时依次按 B3 多 header、B3 单 header、W3C trace context、jaeger uber-trace-id 格式解析
+func (i *IstioGormTracing) getPropagator() Propagator {
+	if i.propagator != nil {
+		return i.propagator
+	}
+	return defaultPropagator
+}
+
+var defaultPropagator, _ = NewCompositePropagator(FormatB3, FormatB3Single, FormatW3C, FormatJaeger)
+
+// 组合多种格式，解析时按顺序依次尝试，使用第一个解析成功的结果，注入时每种格式都会写入
+type CompositePropagator struct {
+	names       []string
+	propagators []Propagator
+}
+
+// 按指定的顺序组合内置的格式，格式名称为 FormatB3、FormatB3Single、FormatW3C、FormatJaeger、FormatDatadog、FormatXRay、FormatSW8
+func NewCompositePropagator(formats ...string) (*CompositePropagator, error) {
+	c := &CompositePropagator{}
+	for _, format := range formats {
+		var p Propagator
+		switch format {
+		case FormatB3:
+			p = B3Propagator()
+		case FormatB3Single:
+			p = B3SinglePropagator()
+		case FormatW3C:
+			p = W3CPropagator()
+		case FormatJaeger:
+			p = JaegerPropagator()
+		case FormatDatadog:
+			p = DatadogPropagator()
+		case FormatXRay:
+			p = XRayPropagator()
+		case FormatSW8:
+			p = SkyWalkingPropagator("")
+		default:
+			return nil, fmt.Errorf("不支持的追踪信息格式: %s", format)
+		}
+		c.Add(format, p)
+	}
+	return c, nil
+}
+
+// 在末尾追加一种格式，可以是自定义的实现
+func (c *CompositePropagator) Add(name string, p Propagator) *CompositePropagator {
+	c.names = append(c.names, name)
+	c.propagators = append(c.propagators, p)
+	return c
+}
+
+func (c *CompositePropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	spanCtx, _, err := c.ExtractFormat(carrier)
+	return spanCtx, err
+}
+
+// 与 Extract 相同，同时返回匹配到的格式名称
+// 某种格式的 header 有误时继续尝试后面的格式，都没有解析成功时返回第一个错误
+func (c *CompositePropagator) ExtractFormat(carrier interface{}) (jaeger.SpanContext, string, error) {
+	var firstErr error
+	var firstName string
+	for idx, p := range c.propagators {
+		spanCtx, err := p.Extract(carrier)
+		if err == nil {
+			return spanCtx, c.names[idx], nil
+		}
+		if err != opentracing.ErrSpanContextNotFound && firstErr == nil {
+			firstErr, firstName = err, c.names[idx]
+		}
+	}
+	if firstErr != nil {
+		return jaeger.SpanContext{}, firstName, firstErr
+	}
+	return jaeger.SpanContext{}, "", opentracing.ErrSpanContextNotFound
+}
+
+func (c *CompositePropagator) Inject(spanCtx jaeger.SpanContext, carrier interface{}) error {
+	for _, p := range c.propagators {
+		if err := p.Inject(spanCtx, carrier); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipkin B3 多 header 格式: x-b3-traceid、x-b3-spanid、x-b3-parentspanid、x-b3-sampled
+func B3Propagator() Propagator {
+	return zipkin.NewZipkinB3HTTPHeaderPropagator()
+}
+
+// zipkin B3 单 header 格式: b3
+func B3SinglePropagator() Propagator {
+	return b3SinglePropagator{}
+}
+
+// W3C trace context 格式: traceparent、tracestate
+func W3CPropagator() Propagator {
+	return w3cPropagator{}
+}
+
+// jaeger 原生格式: uber-trace-id: {trace-id}:{span-id}:{parent-span-id}:{flags}
+func JaegerPropagator() Propagator {
+	return jaeger.NewHTTPHeaderPropagator(new(jaeger.HeadersConfig).ApplyDefaults(), *jaeger.NewNullMetrics())
+}
+
+type b3SinglePropagator struct{}
+
+func (b3SinglePropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	h, err := carrierToHeader(carrier)
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+	return extractB3Single(h)
+}
+
+func (b3SinglePropagator) Inject(spanCtx jaeger.SpanContext, carrier interface{}) error {
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	b3 := spanCtx.TraceID().String() + "-" + spanCtx.SpanID().String()
+	switch {
+	case spanCtx.IsDebug():
+		b3 += "-d"
+	case spanCtx.IsSampled():
+		b3 += "-1"
+	default:
+		b3 += "-0"
+	}
+	if spanCtx.ParentID() != 0 {
+		b3 += "-" + spanCtx.ParentID().String()
+	}
+	w.Set(_headerB3Single, b3)
+	return nil
+}
+
+type w3cPropagator struct{}
+
+func (w3cPropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	h, err := carrierToHeader(carrier)
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+	return extractW3C(h)
+}
+
+func (w3cPropagator) Inject(spanCtx jaeger.SpanContext, carrier interface{}) error {
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	traceID := spanCtx.TraceID()
+	flags := "00"
+	if spanCtx.IsSampled() {
+		flags = "01"
+	}
+	w.Set(_headerTraceparent, fmt.Sprintf("00-%016x%016x-%016x-%s", traceID.High, traceID.Low, uint64(spanCtx.SpanID()), flags))
+	spanCtx.ForeachBaggageItem(func(k, v string) bool {
+		if k == _baggageTracestate {
+			w.Set(_headerTracestate, v)
+			return false
+		}
+		return true
+	})
+	return nil
+}
+
+// 将 carrier 转换为 http.Header，方便按 header 名称读取
+func carrierToHeader(carrier interface{}) (http.Header, error) {
+	switch c := carrier.(type) {
+	case opentracing.HTTPHeadersCarrier:
+		return http.Header(c), nil
+	case http.Header:
+		return c, nil
+	case opentracing.TextMapReader:
+		h := http.Header{}
+		err := c.ForeachKey(func(k, v string) error {
+			h.Add(k, v)
+			return nil
+		})
+		return h, err
+	}
+	return nil, opentracing.ErrInvalidCarrier
+}
+
+// 按 B3 单 header 格式解析，格式为: b3: {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}
+// 后两段可省略，只有采样状态(如 b3: 0)时没有可用的父 span
+// 省略采样状态表示上游推迟了采样决定，此时不设置采样标记，交给本地的采样器决定
+func extractB3Single(h http.Header) (jaeger.SpanContext, error) {
+	b3 := strings.TrimSpace(h.Get(_headerB3Single))
+	if b3 == "" {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	parts := strings.Split(b3, "-")
+	if len(parts) == 1 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	if len(parts) > 4 || (len(parts[0]) != 16 && len(parts[0]) != 32) || len(parts[1]) != 16 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+
+	traceID, err := jaeger.TraceIDFromString(parts[0])
+	if err != nil || !traceID.IsValid() {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	spanID, err := jaeger.SpanIDFromString(parts[1])
+	if err != nil || spanID == 0 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+
+	var flags byte
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "1":
+			flags = _flagSampled
+		case "d":
+			flags = _flagSampled | _flagDebug
+		case "0":
+		default:
+			return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+		}
+	}
+
+	var parentID jaeger.SpanID
+	if len(parts) > 3 {
+		if parentID, err = jaeger.SpanIDFromString(parts[3]); err != nil {
+			return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+		}
+	}
+
+	// jaeger.NewSpanContext 只能设置是否采样，需要保留 debug 标记时通过字符串格式创建
+	return jaeger.ContextFromString(fmt.Sprintf("%s:%s:%s:%d", traceID, spanID, parentID, flags))
+}
+
+// 按 W3C trace context 格式解析 traceparent，格式为: {version}-{trace-id}-{parent-id}-{trace-flags}
+// tracestate 是各厂商自定义的内容，不做解析，原样保存在 baggage 中随 span 继续传递
+func extractW3C(h http.Header) (jaeger.SpanContext, error) {
+	traceparent := strings.TrimSpace(h.Get(_headerTraceparent))
+	if traceparent == "" {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	// 规范要求只能使用小写的十六进制字符
+	for _, part := range parts[:4] {
+		if !isLowerHex(part) {
+			return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+		}
+	}
+	// 00 版本必须严格为 4 段
+	if parts[0] == "00" && len(parts) != 4 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+
+	traceID, err := jaeger.TraceIDFromString(parts[1])
+	if err != nil || !traceID.IsValid() {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	spanID, err := jaeger.SpanIDFromString(parts[2])
+	if err != nil || spanID == 0 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+
+	var baggage map[string]string
+	if tracestate := strings.TrimSpace(strings.Join(h.Values(_headerTracestate), ",")); tracestate != "" {
+		baggage = map[string]string{_baggageTracestate: tracestate}
+	}
+
+	return jaeger.NewSpanContext(traceID, spanID, 0, flags&0x01 == 0x01, baggage), nil
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
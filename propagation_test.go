@@ -0,0 +1,220 @@
+package istiogormtracing
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestExtractW3C(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		tracestate  string
+		err         error
+		traceID     string
+		spanID      string
+		sampled     bool
+	}{
+		{name: "missing", err: opentracing.ErrSpanContextNotFound},
+		{name: "sampled", traceparent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", traceID: "0af7651916cd43dd8448eb211c80319c", spanID: "b7ad6b7169203331", sampled: true},
+		{name: "not sampled", traceparent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00", traceID: "0af7651916cd43dd8448eb211c80319c", spanID: "b7ad6b7169203331"},
+		{name: "other flag bits", traceparent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-02", traceID: "0af7651916cd43dd8448eb211c80319c", spanID: "b7ad6b7169203331"},
+		{name: "tracestate", traceparent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", tracestate: "congo=t61rcWkgMzE", traceID: "0af7651916cd43dd8448eb211c80319c", spanID: "b7ad6b7169203331", sampled: true},
+		{name: "future version extra segments", traceparent: "01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra", traceID: "0af7651916cd43dd8448eb211c80319c", spanID: "b7ad6b7169203331", sampled: true},
+		{name: "version ff", traceparent: "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", err: opentracing.ErrSpanContextCorrupted},
+		{name: "version 00 extra segments", traceparent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra", err: opentracing.ErrSpanContextCorrupted},
+		{name: "short trace id", traceparent: "00-0af7651916cd43dd-b7ad6b7169203331-01", err: opentracing.ErrSpanContextCorrupted},
+		{name: "short span id", traceparent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b71-01", err: opentracing.ErrSpanContextCorrupted},
+		{name: "long flags", traceparent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-001", err: opentracing.ErrSpanContextCorrupted},
+		{name: "too few segments", traceparent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331", err: opentracing.ErrSpanContextCorrupted},
+		{name: "zero trace id", traceparent: "00-00000000000000000000000000000000-b7ad6b7169203331-01", err: opentracing.ErrSpanContextCorrupted},
+		{name: "zero span id", traceparent: "00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01", err: opentracing.ErrSpanContextCorrupted},
+		{name: "uppercase hex", traceparent: "00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01", err: opentracing.ErrSpanContextCorrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.traceparent != "" {
+				h.Set("traceparent", tt.traceparent)
+			}
+			if tt.tracestate != "" {
+				h.Set("tracestate", tt.tracestate)
+			}
+			spanCtx, err := extractW3C(h)
+			if err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got := spanCtx.TraceID().String(); got != tt.traceID {
+				t.Errorf("trace id = %s, want %s", got, tt.traceID)
+			}
+			if got := spanCtx.SpanID().String(); got != tt.spanID {
+				t.Errorf("span id = %s, want %s", got, tt.spanID)
+			}
+			if spanCtx.IsSampled() != tt.sampled {
+				t.Errorf("sampled = %v, want %v", spanCtx.IsSampled(), tt.sampled)
+			}
+			var tracestate string
+			spanCtx.ForeachBaggageItem(func(k, v string) bool {
+				if k == "tracestate" {
+					tracestate = v
+				}
+				return true
+			})
+			if tracestate != tt.tracestate {
+				t.Errorf("tracestate = %q, want %q", tracestate, tt.tracestate)
+			}
+		})
+	}
+}
+
+func TestExtractB3Single(t *testing.T) {
+	tests := []struct {
+		name     string
+		b3       string
+		err      error
+		traceID  string
+		spanID   string
+		parentID string
+		sampled  bool
+		debug    bool
+	}{
+		{name: "missing", err: opentracing.ErrSpanContextNotFound},
+		{name: "deny only", b3: "0", err: opentracing.ErrSpanContextNotFound},
+		{name: "64 bit trace id", b3: "a3ce929d0e0e4736-00f067aa0ba902b7-1", traceID: "a3ce929d0e0e4736", spanID: "00f067aa0ba902b7", sampled: true},
+		{name: "128 bit trace id", b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90", traceID: "80f198ee56343ba864fe8b2a57d3eff7", spanID: "e457b5a2e4d86bd1", parentID: "05e3ac9a4f6e3b90", sampled: true},
+		{name: "not sampled", b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0", traceID: "80f198ee56343ba864fe8b2a57d3eff7", spanID: "e457b5a2e4d86bd1"},
+		{name: "debug", b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-d", traceID: "80f198ee56343ba864fe8b2a57d3eff7", spanID: "e457b5a2e4d86bd1", sampled: true, debug: true},
+		{name: "deferred", b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1", traceID: "80f198ee56343ba864fe8b2a57d3eff7", spanID: "e457b5a2e4d86bd1"},
+		{name: "bad sampling state", b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-x", err: opentracing.ErrSpanContextCorrupted},
+		{name: "too many segments", b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90-1", err: opentracing.ErrSpanContextCorrupted},
+		{name: "bad trace id length", b3: "80f198ee56343ba8-64fe8b2a57d3eff7e457b5a2e4d86bd1", err: opentracing.ErrSpanContextCorrupted},
+		{name: "bad span id length", b3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2-1", err: opentracing.ErrSpanContextCorrupted},
+		{name: "zero span id", b3: "80f198ee56343ba864fe8b2a57d3eff7-0000000000000000-1", err: opentracing.ErrSpanContextCorrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.b3 != "" {
+				h.Set("b3", tt.b3)
+			}
+			spanCtx, err := extractB3Single(h)
+			if err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got := spanCtx.TraceID().String(); got != tt.traceID {
+				t.Errorf("trace id = %s, want %s", got, tt.traceID)
+			}
+			if got := spanCtx.SpanID().String(); got != tt.spanID {
+				t.Errorf("span id = %s, want %s", got, tt.spanID)
+			}
+			if tt.parentID != "" {
+				if got := spanCtx.ParentID().String(); got != tt.parentID {
+					t.Errorf("parent id = %s, want %s", got, tt.parentID)
+				}
+			}
+			if spanCtx.IsSampled() != tt.sampled {
+				t.Errorf("sampled = %v, want %v", spanCtx.IsSampled(), tt.sampled)
+			}
+			if spanCtx.IsDebug() != tt.debug {
+				t.Errorf("debug = %v, want %v", spanCtx.IsDebug(), tt.debug)
+			}
+			// 采样决定不能在解析时就确定下来，未携带采样状态时由本地采样器决定
+			if spanCtx.IsSamplingFinalized() {
+				t.Error("sampling should not be finalized by extraction")
+			}
+		})
+	}
+}
+
+func TestPropagatorRoundTrip(t *testing.T) {
+	traceID, _ := jaeger.TraceIDFromString("0af7651916cd43dd8448eb211c80319c")
+	spanCtx := jaeger.NewSpanContext(traceID, 0xb7ad6b7169203331, 0, true, nil)
+
+	for name, p := range map[string]Propagator{
+		"b3":        B3Propagator(),
+		"b3 single": B3SinglePropagator(),
+		"w3c":       W3CPropagator(),
+		"jaeger":    JaegerPropagator(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := http.Header{}
+			if err := p.Inject(spanCtx, opentracing.HTTPHeadersCarrier(h)); err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Extract(opentracing.HTTPHeadersCarrier(h))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.TraceID() != spanCtx.TraceID() || got.SpanID() != spanCtx.SpanID() || got.IsSampled() != spanCtx.IsSampled() {
+				t.Errorf("got %s, want %s", got, spanCtx)
+			}
+		})
+	}
+}
+
+func TestCompositePropagatorOrder(t *testing.T) {
+	h := http.Header{}
+	h.Set("x-b3-traceid", "463ac35c9f6413ad48485a3953bb6124")
+	h.Set("x-b3-spanid", "a2fb4a1d1a96d312")
+	h.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	tests := []struct {
+		formats []string
+		format  string
+		traceID string
+	}{
+		{[]string{FormatB3, FormatW3C}, FormatB3, "463ac35c9f6413ad48485a3953bb6124"},
+		{[]string{FormatW3C, FormatB3}, FormatW3C, "0af7651916cd43dd8448eb211c80319c"},
+		{[]string{FormatJaeger, FormatB3Single, FormatW3C}, FormatW3C, "0af7651916cd43dd8448eb211c80319c"},
+	}
+	for _, tt := range tests {
+		c, err := NewCompositePropagator(tt.formats...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spanCtx, format, err := c.ExtractFormat(opentracing.HTTPHeadersCarrier(h))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != tt.format || spanCtx.TraceID().String() != tt.traceID {
+			t.Errorf("%v: got %s/%s, want %s/%s", tt.formats, format, spanCtx.TraceID(), tt.format, tt.traceID)
+		}
+	}
+
+	if _, err := NewCompositePropagator("unknown"); err == nil {
+		t.Error("unknown format should fail")
+	}
+}
+
+// 前面的格式 header 有误时，使用后面格式中正确的 header
+func TestCompositePropagatorCorruptedFallback(t *testing.T) {
+	c, err := NewCompositePropagator(FormatJaeger, FormatW3C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := http.Header{}
+	h.Set("uber-trace-id", "not-a-trace-id")
+	h.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	spanCtx, format, err := c.ExtractFormat(opentracing.HTTPHeadersCarrier(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != FormatW3C || spanCtx.TraceID().String() != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("got %s/%s", format, spanCtx.TraceID())
+	}
+
+	// 没有正确的 header 时返回解析错误
+	h.Del("traceparent")
+	if _, _, err := c.ExtractFormat(opentracing.HTTPHeadersCarrier(h)); err == nil || err == opentracing.ErrSpanContextNotFound {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package istiogormtracing
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 原生 SQL 中修改表结构的语句，span 统一命名为 ddl
+var _ddlVerbs = map[string]bool{
+	"CREATE":   true,
+	"ALTER":    true,
+	"DROP":     true,
+	"TRUNCATE": true,
+	"RENAME":   true,
+}
+
+// Raw 和 Exec 执行的 SQL 按操作类型命名的 span，其他语句(如 SET、CALL)仍命名为 raw
+var _rawOperationNames = map[string]string{
+	"SELECT":  "select",
+	"INSERT":  "insert",
+	"REPLACE": "insert",
+	"UPDATE":  "update",
+	"DELETE":  "delete",
+}
+
+// 从 SQL 中解析出操作类型(大写的第一个关键字，WITH 语句为主语句的关键字)和主表名，只做简单的词法分析，解析不出时为空
+// 如 /* comment */ SELECT * FROM `db`.`users` u JOIN orders o ... 解析为 SELECT 和 db.users
+func parseSQL(sql string) (verb, table string) {
+	s := &sqlScanner{sql: sql}
+	tok := s.next()
+	for tok == "(" {
+		tok = s.next()
+	}
+	verb = strings.ToUpper(tok)
+	if verb == "WITH" {
+		// 跳过公用表表达式，找到同一层级的主语句
+		depth := s.depth
+		for tok = s.next(); tok != ""; tok = s.next() {
+			if s.depth != depth {
+				continue
+			}
+			switch upper := strings.ToUpper(tok); upper {
+			case "SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE":
+				verb = upper
+			default:
+				continue
+			}
+			break
+		}
+		if verb == "WITH" {
+			return "", ""
+		}
+	}
+	if verb == "" || !isIdentStart(verb[0]) {
+		return "", ""
+	}
+	switch {
+	case verb == "SELECT" || verb == "DELETE":
+		table = s.tableAfter("FROM")
+	case verb == "INSERT" || verb == "REPLACE":
+		table = s.tableAfter("INTO")
+	case verb == "UPDATE":
+		table = s.tableAfter("")
+	case verb == "CREATE" || verb == "DROP":
+		// CREATE INDEX idx ON users 的表名在 ON 之后
+		table = s.tableAfter("TABLE", "ON", "VIEW")
+	case verb == "ALTER" || verb == "TRUNCATE" || verb == "RENAME":
+		table = s.tableAfter("TABLE")
+		if table == "" && verb == "TRUNCATE" {
+			// TRUNCATE users 省略了 TABLE
+			s = &sqlScanner{sql: sql}
+			s.next()
+			table = s.tableAfter("")
+		}
+	}
+	return verb, table
+}
+
+// Raw 和 Exec 执行的 SQL 的 span 名称，无法识别的语句返回空字符串
+func rawOperationName(sql string) string {
+	verb, _ := parseSQL(sql)
+	if _ddlVerbs[verb] {
+		return "ddl"
+	}
+	return _rawOperationNames[verb]
+}
+
+// SQL 操作的表名，Raw 和 Exec 等没有表名时从 SQL 中解析
+func statementTable(db *gorm.DB) string {
+	if db.Statement.Table != "" {
+		return db.Statement.Table
+	}
+	_, table := parseSQL(db.Statement.SQL.String())
+	return table
+}
+
+// 依次读取 SQL 中的关键字、标识符和符号，跳过注释、字符串和空白
+type sqlScanner struct {
+	sql   string
+	pos   int
+	depth int
+}
+
+// 读取下一个词，标识符中的引号会去掉，如 `db`.`users` 读取为 db.users；SQL 结束时返回空字符串
+func (s *sqlScanner) next() string {
+	for s.pos < len(s.sql) {
+		c := s.sql[s.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ';':
+			s.pos++
+		case c == '-' && strings.HasPrefix(s.sql[s.pos:], "--"), c == '#':
+			for s.pos < len(s.sql) && s.sql[s.pos] != '\n' {
+				s.pos++
+			}
+		case c == '/' && strings.HasPrefix(s.sql[s.pos:], "/*"):
+			if end := strings.Index(s.sql[s.pos+2:], "*/"); end >= 0 {
+				s.pos += end + 4
+			} else {
+				s.pos = len(s.sql)
+			}
+		case c == '\'':
+			s.skipString()
+			return "?"
+		case c == '(':
+			s.pos++
+			s.depth++
+			return "("
+		case c == ')':
+			s.pos++
+			s.depth--
+			return ")"
+		case isIdentStart(c) || c == '`' || c == '"' || c == '[':
+			return s.identifier()
+		default:
+			s.pos++
+			return string(c)
+		}
+	}
+	return ""
+}
+
+// 读取可能带库名的标识符
+func (s *sqlScanner) identifier() string {
+	var b strings.Builder
+	for s.pos < len(s.sql) {
+		switch c := s.sql[s.pos]; c {
+		case '`', '"', '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end := strings.IndexByte(s.sql[s.pos+1:], closing)
+			if end < 0 {
+				end = len(s.sql) - s.pos - 1
+			}
+			b.WriteString(s.sql[s.pos+1 : s.pos+1+end])
+			s.pos += end + 2
+		default:
+			start := s.pos
+			for s.pos < len(s.sql) && (isIdentStart(s.sql[s.pos]) || isDigit(s.sql[s.pos]) || s.sql[s.pos] == '$') {
+				s.pos++
+			}
+			b.WriteString(s.sql[start:s.pos])
+		}
+		if s.pos >= len(s.sql) || s.sql[s.pos] != '.' {
+			break
+		}
+		b.WriteByte('.')
+		s.pos++
+	}
+	return b.String()
+}
+
+// 跳过字符串，支持连续两个单引号和反斜杠转义
+func (s *sqlScanner) skipString() {
+	for s.pos++; s.pos < len(s.sql); s.pos++ {
+		switch s.sql[s.pos] {
+		case '\\':
+			s.pos++
+		case '\'':
+			if s.pos+1 < len(s.sql) && s.sql[s.pos+1] == '\'' {
+				s.pos++
+				continue
+			}
+			s.pos++
+			return
+		}
+	}
+}
+
+// 读取同一层级中任意一个关键字之后的表名，keywords 为空时读取下一个表名；表名为子查询时返回空字符串
+func (s *sqlScanner) tableAfter(keywords ...string) string {
+	depth := s.depth
+	found := len(keywords) == 0 || keywords[0] == ""
+	for tok := s.next(); tok != ""; tok = s.next() {
+		if s.depth < depth {
+			return ""
+		}
+		if s.depth > depth || tok == "(" {
+			if found {
+				return ""
+			}
+			continue
+		}
+		upper := strings.ToUpper(tok)
+		if !found {
+			for _, k := range keywords {
+				if upper == k {
+					found = true
+					break
+				}
+			}
+			continue
+		}
+		switch upper {
+		// 表名前的修饰词
+		case "IF", "NOT", "EXISTS", "ONLY", "IGNORE", "LOW_PRIORITY", "DELAYED", "HIGH_PRIORITY", "QUICK", "TEMPORARY", "TABLE", "INTO", "FROM":
+			continue
+		}
+		if !isIdentStart(tok[0]) {
+			return ""
+		}
+		return tok
+	}
+	return ""
+}
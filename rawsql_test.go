@@ -0,0 +1,67 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestParseSQL(t *testing.T) {
+	cases := []struct {
+		sql, verb, table string
+	}{
+		{"SELECT * FROM users WHERE id = 1", "SELECT", "users"},
+		{"/* load */ select count(*) from `shop`.`orders` o join users u on u.id = o.user_id", "SELECT", "shop.orders"},
+		{"SELECT (SELECT max(id) FROM logs) AS m FROM \"users\"", "SELECT", "users"},
+		{"SELECT * FROM (SELECT * FROM users) t", "SELECT", ""},
+		{"-- comment\nINSERT IGNORE INTO users (name) VALUES ('a''b')", "INSERT", "users"},
+		{"REPLACE INTO [dbo].[users] VALUES (1)", "REPLACE", "dbo.users"},
+		{"UPDATE LOW_PRIORITY users SET name = 'from x' WHERE id = ?", "UPDATE", "users"},
+		{"DELETE FROM orders WHERE created_at < $1", "DELETE", "orders"},
+		{"WITH recent AS (SELECT * FROM orders) SELECT * FROM recent", "SELECT", "recent"},
+		{"CREATE TABLE IF NOT EXISTS users (id int)", "CREATE", "users"},
+		{"CREATE UNIQUE INDEX idx_name ON users (name)", "CREATE", "users"},
+		{"ALTER TABLE users ADD COLUMN age int", "ALTER", "users"},
+		{"TRUNCATE logs", "TRUNCATE", "logs"},
+		{"SET NAMES utf8mb4", "SET", ""},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		if verb, table := parseSQL(c.sql); verb != c.verb || table != c.table {
+			t.Errorf("parseSQL(%q) = %q, %q, want %q, %q", c.sql, verb, table, c.verb, c.table)
+		}
+	}
+}
+
+func TestRawOperationName(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("UPDATE users SET name = ?", "xiaoming")
+	db.Exec("DROP TABLE IF EXISTS logs")
+	db.Exec("SET NAMES utf8mb4")
+
+	want := []struct{ op, table string }{{"update", "users"}, {"ddl", "logs"}, {_opRaw, ""}}
+	spans := tracer.FinishedSpans()
+	if len(spans) != len(want) {
+		t.Fatalf("spans = %v", spans)
+	}
+	for n, span := range spans {
+		if span.OperationName != want[n].op {
+			t.Errorf("span %d: operation = %q, want %q", n, span.OperationName, want[n].op)
+		}
+		var table interface{}
+		for _, record := range span.Logs() {
+			for _, field := range record.Fields {
+				if field.Key == _fieldTable {
+					table = field.ValueString
+				}
+			}
+		}
+		if table != want[n].table {
+			t.Errorf("span %d: table = %v, want %q", n, table, want[n].table)
+		}
+	}
+}
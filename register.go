@@ -0,0 +1,100 @@
+package istiogormtracing
+
+import (
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// 插件的回调事件名称已被其他代码注册，注册插件时返回
+var ErrCallbackConflict = errors.New("回调事件名称已被其他代码注册")
+
+// 当前注册回调的插件实例保存在 gorm.DB 的插件列表中，随 gorm.DB 一起释放，同一个 gorm.DB 的会话共用插件列表
+// 默认命名空间使用插件名称，与 db.Use 保存的一致，其他命名空间加上命名空间区分
+func (i *IstioGormTracing) ownerName() string {
+	if i.callbackNamespace == "" {
+		return i.Name()
+	}
+	return i.Name() + ":" + i.callbackNamespace
+}
+
+func (i *IstioGormTracing) callbackOwner(db *gorm.DB) *IstioGormTracing {
+	// 其他命名空间的实例通过 db.Use 注册时也保存在插件名称下
+	owner, ok := db.Plugins[i.ownerName()].(*IstioGormTracing)
+	if !ok || owner.callbackNamespace != i.callbackNamespace {
+		return nil
+	}
+	return owner
+}
+
+func (i *IstioGormTracing) setCallbackOwner(db *gorm.DB) {
+	db.Plugins[i.ownerName()] = i
+}
+
+// 注销后从插件列表中删除，之后可以再次 db.Use
+func (i *IstioGormTracing) removeCallbackOwner(db *gorm.DB) {
+	if i.callbackOwner(db) == i {
+		delete(db.Plugins, i.ownerName())
+	}
+}
+
+// 插件回调函数的代码地址，所有插件实例相同
+var _pluginHandlers = func() map[uintptr]bool {
+	i := &IstioGormTracing{}
+	handlers := map[uintptr]bool{}
+	for _, fn := range []func(*gorm.DB){
+		i.beforeCreate, i.afterCreate, i.beforeUpdate, i.afterUpdate, i.beforeQuery, i.afterQuery,
+		i.beforePreload, i.afterPreload, i.beforeDelete, i.afterDelete, i.beforeRow, i.afterRow, i.beforeRaw, i.afterRaw,
+		i.beforeSaveAssociations(true, true), i.afterSaveAssociations,
+	} {
+		handlers[reflect.ValueOf(fn).Pointer()] = true
+	}
+	return handlers
+}()
+
+// gorm 的回调处理器，如 db.Callback().Create()
+type callbackProcessor interface {
+	Get(name string) func(*gorm.DB)
+	Remove(name string) error
+}
+
+type callbackEvent struct {
+	processor callbackProcessor
+	name      string
+}
+
+// 插件注册的所有回调事件
+func (i *IstioGormTracing) callbackEvents(db *gorm.DB) []callbackEvent {
+	cb := db.Callback()
+	var events []callbackEvent
+	for _, p := range []struct {
+		processor callbackProcessor
+		names     []string
+	}{
+		{cb.Create(), []string{_eventBeforeCreate, _eventAfterCreate,
+			_eventBeforeSaveBeforeAssociations, _eventAfterSaveBeforeAssociations, _eventBeforeSaveAfterAssociations, _eventAfterSaveAfterAssociations}},
+		{cb.Update(), []string{_eventBeforeUpdate, _eventAfterUpdate,
+			_eventBeforeSaveBeforeAssociations, _eventAfterSaveBeforeAssociations, _eventBeforeSaveAfterAssociations, _eventAfterSaveAfterAssociations}},
+		{cb.Query(), []string{_eventBeforeQuery, _eventAfterQuery, _eventBeforePreload, _eventAfterPreload}},
+		{cb.Delete(), []string{_eventBeforeDelete, _eventAfterDelete}},
+		{cb.Row(), []string{_eventBeforeRow, _eventAfterRow}},
+		{cb.Raw(), []string{_eventBeforeRaw, _eventAfterRaw}},
+	} {
+		for _, name := range p.names {
+			events = append(events, callbackEvent{processor: p.processor, name: i.eventName(name)})
+		}
+	}
+	return events
+}
+
+// 返回第一个被其他代码注册的回调事件名称，都没有注册时返回空字符串
+// gorm 注销回调后仍能通过 Get 获取，插件自己注册后注销的回调不算冲突
+func (i *IstioGormTracing) registeredEvent(db *gorm.DB) string {
+	for _, e := range i.callbackEvents(db) {
+		if fn := e.processor.Get(e.name); fn != nil && !_pluginHandlers[reflect.ValueOf(fn).Pointer()] {
+			return e.name
+		}
+	}
+	return ""
+}
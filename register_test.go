@@ -0,0 +1,90 @@
+package istiogormtracing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+)
+
+func TestInitializeTwice(t *testing.T) {
+	tracer := mocktracer.New()
+	i := NewWithTracer(tracer)
+	db := openDB(t)
+	if err := db.Use(i); err != nil {
+		t.Fatal(err)
+	}
+	// 直接再次注册或在会话上注册时跳过
+	if err := i.Initialize(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Initialize(db.Session(&gorm.Session{NewDB: true})); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	if len(tracer.FinishedSpans()) != 1 {
+		t.Errorf("spans = %d, want 1", len(tracer.FinishedSpans()))
+	}
+}
+
+func TestInitializeReplacesOtherInstance(t *testing.T) {
+	oldTracer, newTracer := mocktracer.New(), mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(oldTracer)); err != nil {
+		t.Fatal(err)
+	}
+	i := NewWithTracer(newTracer)
+	if err := i.Initialize(db); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	if len(oldTracer.FinishedSpans()) != 0 || len(newTracer.FinishedSpans()) != 1 {
+		t.Errorf("old spans = %d, new spans = %d", len(oldTracer.FinishedSpans()), len(newTracer.FinishedSpans()))
+	}
+}
+
+func TestInitializeConflict(t *testing.T) {
+	db := openDB(t)
+	if err := db.Callback().Query().Register(_eventBeforeQuery, func(*gorm.DB) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewWithTracer(mocktracer.New())); !errors.Is(err, ErrCallbackConflict) {
+		t.Errorf("err = %v, want ErrCallbackConflict", err)
+	}
+}
+
+func TestRemoveLeavesNoOwner(t *testing.T) {
+	db := openDB(t)
+	for _, opts := range [][]Option{nil, {WithCallbackNamespace("audit-tracing")}} {
+		i := NewWithTracer(mocktracer.New(), opts...)
+		if err := i.Initialize(db); err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Remove(db); err != nil {
+			t.Fatal(err)
+		}
+		if i.callbackOwner(db) != nil || len(db.Plugins) != 0 {
+			t.Errorf("plugins = %v after remove", db.Plugins)
+		}
+		// 注销后其他实例可以重新注册，不会把注销的回调当成冲突
+		tracer := mocktracer.New()
+		other := NewWithTracer(tracer, opts...)
+		if err := db.Use(other); err != nil {
+			t.Fatal(err)
+		}
+		var list []map[string]interface{}
+		db.Table("users").Find(&list)
+		if len(tracer.FinishedSpans()) != 1 {
+			t.Errorf("spans = %d after re-register", len(tracer.FinishedSpans()))
+		}
+		if err := other.Remove(db); err != nil {
+			t.Fatal(err)
+		}
+		if len(db.Plugins) != 0 {
+			t.Errorf("plugins = %v after remove", db.Plugins)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package istiogormtracing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/config"
+)
+
+// 使用外部传入的 tracer 时不能在运行时修改采样配置
+var ErrExternalTracer = errors.New("插件使用的是外部传入的 tracer, 不能修改采样配置")
+
+// 运行时修改配置，不需要重新发布服务就能调整追踪
+// 目前会重新加载采样配置、慢查询阈值、上报的最短执行时间、不追踪的表和操作，为空时恢复为创建插件时的配置；其他配置(如收集器地址)只在创建时生效
+// 使用外部传入的 tracer 时，除采样配置外的配置仍会生效，并返回 ErrExternalTracer
+func (i *IstioGormTracing) Reconfigure(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("配置校验失败, 错误原因: %w", err)
+	}
+	sampler := i.samplerConfig()
+	if cfg.Sampler != nil {
+		opts, err := cfg.Options()
+		if err != nil {
+			return err
+		}
+		reloaded := &IstioGormTracing{}
+		for _, opt := range opts {
+			opt(reloaded)
+		}
+		sampler = reloaded.sampler
+		if sampler.MaxOperations == 0 {
+			sampler.MaxOperations = i.samplingMaxOperations
+		}
+	}
+	i.mu.RLock()
+	dynamic := i.dynamicSampler
+	i.mu.RUnlock()
+	// 先创建采样器，创建失败时不修改任何配置
+	var s jaeger.Sampler
+	if dynamic != nil {
+		var err error
+		if s, err = sampler.NewSampler(i.ServiceName, jaeger.NewNullMetrics()); err != nil {
+			return fmt.Errorf("采样器创建失败, 错误原因: %w", err)
+		}
+	}
+
+	slowQuery := i.slowQuery
+	if cfg.SlowQueryThreshold != "" {
+		slowQuery, _ = time.ParseDuration(cfg.SlowQueryThreshold)
+	}
+	atomic.StoreInt64(&i.slowQueryThreshold, int64(slowQuery))
+
+	minDuration := i.minDuration
+	if cfg.MinDuration != "" {
+		minDuration, _ = time.ParseDuration(cfg.MinDuration)
+	}
+	atomic.StoreInt64(&i.minDurationThreshold, int64(minDuration))
+
+	excludeTables := i.excludeTables
+	if len(cfg.ExcludeTables) > 0 {
+		excludeTables = lowerSet(nil, cfg.ExcludeTables)
+	}
+	i.excludedTables.Store(excludeTables)
+
+	excludeOperations := i.excludeOperations
+	if len(cfg.ExcludeOperations) > 0 {
+		excludeOperations = lowerSet(nil, cfg.ExcludeOperations)
+	}
+	i.excludedOperations.Store(excludeOperations)
+
+	// 阈值和过滤列表不依赖采样器，使用外部 tracer 时也会生效
+	if dynamic == nil {
+		return ErrExternalTracer
+	}
+	dynamic.swap(s)
+	return nil
+}
+
+// 收到信号(默认为 SIGHUP)时重新读取配置文件并调用 Reconfigure，读取失败时记录日志并保留原有配置
+// 返回的方法用于停止监听
+func (i *IstioGormTracing) ReloadOnSignal(path string, sig ...os.Signal) (stop func()) {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+	logger := i.getLogger()
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sig...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				cfg, err := LoadConfigFile(path)
+				if err == nil {
+					err = i.Reconfigure(cfg)
+				}
+				if err != nil {
+					logger.Error("追踪配置重新加载失败, 错误原因: " + err.Error())
+					continue
+				}
+				logger.Infof("追踪配置已重新加载: %s", path)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// 创建插件时的采样配置，未设置时全部采样
+func (i *IstioGormTracing) samplerConfig() *config.SamplerConfig {
+	sampler := &config.SamplerConfig{
+		Type:  jaeger.SamplerTypeConst,
+		Param: 1,
+	}
+	if i.sampler != nil {
+		copied := *i.sampler
+		sampler = &copied
+	}
+	if i.samplingMaxOperations > 0 {
+		sampler.MaxOperations = i.samplingMaxOperations
+	}
+	return sampler
+}
+
+// 可以在运行时替换的采样器，jaeger 的 tracer 创建后不能修改采样器，由它转发给当前的采样器
+type reloadableSampler struct {
+	mu      sync.RWMutex
+	sampler jaeger.Sampler
+}
+
+func newReloadableSampler(s jaeger.Sampler) *reloadableSampler {
+	return &reloadableSampler{sampler: s}
+}
+
+// 替换采样器并关闭原有的采样器，远程采样器会停止拉取
+func (r *reloadableSampler) swap(s jaeger.Sampler) {
+	r.mu.Lock()
+	old := r.sampler
+	r.sampler = s
+	r.mu.Unlock()
+	old.Close()
+}
+
+func (r *reloadableSampler) current() jaeger.Sampler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sampler
+}
+
+// jaeger 内置的采样器都实现了 SamplerV2，否则按 V1 接口转换
+func (r *reloadableSampler) currentV2() jaeger.SamplerV2 {
+	s := r.current()
+	if v2, ok := s.(jaeger.SamplerV2); ok {
+		return v2
+	}
+	return samplerV1toV2{Sampler: s}
+}
+
+func (r *reloadableSampler) IsSampled(id jaeger.TraceID, operation string) (bool, []jaeger.Tag) {
+	return r.current().IsSampled(id, operation)
+}
+
+func (r *reloadableSampler) Equal(other jaeger.Sampler) bool {
+	return r == other
+}
+
+func (r *reloadableSampler) Close() {
+	r.current().Close()
+}
+
+func (r *reloadableSampler) OnCreateSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	return r.currentV2().OnCreateSpan(span)
+}
+
+func (r *reloadableSampler) OnSetOperationName(span *jaeger.Span, operationName string) jaeger.SamplingDecision {
+	return r.currentV2().OnSetOperationName(span, operationName)
+}
+
+func (r *reloadableSampler) OnSetTag(span *jaeger.Span, key string, value interface{}) jaeger.SamplingDecision {
+	return r.currentV2().OnSetTag(span, key, value)
+}
+
+func (r *reloadableSampler) OnFinishSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	return r.currentV2().OnFinishSpan(span)
+}
+
+// 与 jaeger 内部的适配相同，只在创建 span 时采样一次
+type samplerV1toV2 struct {
+	jaeger.Sampler
+}
+
+func (s samplerV1toV2) OnCreateSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	sampled, tags := s.IsSampled(span.SpanContext().TraceID(), span.OperationName())
+	return jaeger.SamplingDecision{Sample: sampled, Retryable: false, Tags: tags}
+}
+
+func (s samplerV1toV2) OnSetOperationName(span *jaeger.Span, operationName string) jaeger.SamplingDecision {
+	sampled, tags := s.IsSampled(span.SpanContext().TraceID(), operationName)
+	return jaeger.SamplingDecision{Sample: sampled, Retryable: false, Tags: tags}
+}
+
+func (s samplerV1toV2) OnSetTag(span *jaeger.Span, key string, value interface{}) jaeger.SamplingDecision {
+	return jaeger.SamplingDecision{Sample: false, Retryable: true}
+}
+
+func (s samplerV1toV2) OnFinishSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	return jaeger.SamplingDecision{Sample: false, Retryable: true}
+}
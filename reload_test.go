@@ -0,0 +1,52 @@
+package istiogormtracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestReconfigure(t *testing.T) {
+	i, err := New(WithServiceName("istio-gorm-tracing-test"), WithReporter(jaeger.NewNullReporter()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	sampled := func() bool {
+		span := i.getTracer().StartSpan(_opQuery)
+		defer span.Finish()
+		return span.Context().(jaeger.SpanContext).IsSampled()
+	}
+
+	if err := i.Reconfigure(&Config{Sampler: &SamplerFileConfig{Type: "probabilistic", Param: 0}}); err != nil {
+		t.Fatal(err)
+	}
+	if sampled() {
+		t.Error("sampled after reconfigure to probabilistic 0")
+	}
+	if err := i.Reconfigure(&Config{Sampler: &SamplerFileConfig{Type: "probabilistic", Param: 2}}); err == nil || sampled() {
+		t.Error("invalid config should be rejected and keep the current sampler")
+	}
+	// 去掉采样配置后恢复为创建时的全部采样
+	if err := i.Reconfigure(&Config{}); err != nil || !sampled() {
+		t.Errorf("reset sampler: %v", err)
+	}
+
+	if err := NewWithTracer(mocktracer.New()).Reconfigure(&Config{}); err != ErrExternalTracer {
+		t.Errorf("external tracer err = %v", err)
+	}
+}
+
+// 使用外部 tracer 时不能修改采样配置，但阈值仍会生效
+func TestReconfigureExternalTracer(t *testing.T) {
+	i := NewWithTracer(mocktracer.New())
+	err := i.Reconfigure(&Config{SlowQueryThreshold: "10ms", MinDuration: "5ms"})
+	if err != ErrExternalTracer {
+		t.Errorf("err = %v", err)
+	}
+	if i.slowQueryThreshold != int64(10*time.Millisecond) || i.minDurationThreshold != int64(5*time.Millisecond) {
+		t.Errorf("thresholds = %v, %v", time.Duration(i.slowQueryThreshold), time.Duration(i.minDurationThreshold))
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package istiogormtracing
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestReloadOnSignal(t *testing.T) {
+	path := writeConfig(t, "tracing.yaml", "sampler:\n  type: const\n  param: 0\n")
+	i, err := New(WithServiceName("istio-gorm-tracing-test"), WithReporter(jaeger.NewNullReporter()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	stop := i.ReloadOnSignal(path, syscall.SIGUSR1)
+	defer stop()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		span := i.getTracer().StartSpan(_opQuery)
+		span.Finish()
+		if !span.Context().(jaeger.SpanContext).IsSampled() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("config not reloaded on signal")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,231 @@
+package istiogormtracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	// 上报队列的默认长度，队列满了之后新产生的 span 会被丢弃
+	_defaultReporterQueueSize = 1000
+	// 每批最多上报的 span 数量
+	_defaultReporterBatchSize = 100
+	// 不满一批时定时上报的间隔
+	_defaultReporterFlushInterval = time.Second
+	// 每次上报的超时时间
+	_defaultReporterTimeout = 10 * time.Second
+)
+
+// 上报前从 jaeger span 中取出的数据，jaeger span 上报后会被回收复用，异步上报时不能直接保存
+type spanData struct {
+	TraceID   jaeger.TraceID
+	SpanID    jaeger.SpanID
+	ParentID  jaeger.SpanID
+	Operation string
+	Start     time.Time
+	Duration  time.Duration
+	Tags      map[string]interface{}
+	// 日志中记录的字段，如 sql、table、error 等，同名字段以最后一次为准
+	Fields  map[string]string
+	Baggage map[string]string
+}
+
+func newSpanData(span *jaeger.Span) *spanData {
+	spanCtx := span.SpanContext()
+	d := &spanData{
+		TraceID:   spanCtx.TraceID(),
+		SpanID:    spanCtx.SpanID(),
+		ParentID:  spanCtx.ParentID(),
+		Operation: span.OperationName(),
+		Start:     span.StartTime(),
+		Duration:  span.Duration(),
+		Tags:      span.Tags(),
+		Fields:    map[string]string{},
+		Baggage:   map[string]string{},
+	}
+	spanCtx.ForeachBaggageItem(func(k, v string) bool {
+		d.Baggage[k] = v
+		return true
+	})
+	for _, record := range span.Logs() {
+		for _, field := range record.Fields {
+			d.Fields[field.Key()] = fmt.Sprint(field.Value())
+		}
+	}
+	return d
+}
+
+// 替换了参数的完整 SQL，记录为 tag 时名称相同，使用语义约定时记录在 db.statement 中
+func (d *spanData) sql() string {
+	return d.fieldOrTag(_fieldSQL, _fieldSQL, _tagDBStatement)
+}
+
+// SQL 模板，没有参数或使用语义约定时没有记录模板，使用完整 SQL
+func (d *spanData) query() string {
+	if query := d.fieldOrTag(_fieldQuery, _fieldQuery); query != "" {
+		return query
+	}
+	return d.sql()
+}
+
+func (d *spanData) table() string {
+	return d.fieldOrTag(_fieldTable, _fieldTable, _tagDBSQLTable)
+}
+
+// 优先从日志字段中取，没有时依次从 tag 中取
+func (d *spanData) fieldOrTag(field string, tags ...string) string {
+	if v, ok := d.Fields[field]; ok {
+		return v
+	}
+	for _, tag := range tags {
+		if v, ok := d.Tags[tag]; ok {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// 是否为出错的 span
+func (d *spanData) isError() bool {
+	if v, ok := d.Tags[string(ext.Error)]; ok && v == true {
+		return true
+	}
+	_, ok := d.Fields["error.object"]
+	return ok
+}
+
+// 异步批量上报的 reporter，各个后端只需要实现 flush，flush 返回的错误只记录日志
+type batchReporter struct {
+	queue  chan *spanData
+	flush  func(spans []*spanData) error
+	logger *syncLogger
+
+	batchSize     int
+	flushInterval time.Duration
+
+	closeOnce sync.Once
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func newBatchReporter(flush func(spans []*spanData) error, logger jaeger.Logger) *batchReporter {
+	r := &batchReporter{
+		queue:         make(chan *spanData, _defaultReporterQueueSize),
+		flush:         flush,
+		logger:        newSyncLogger(logger),
+		batchSize:     _defaultReporterBatchSize,
+		flushInterval: _defaultReporterFlushInterval,
+		done:          make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.loop()
+	return r
+}
+
+func (r *batchReporter) Report(span *jaeger.Span) {
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	select {
+	case r.queue <- newSpanData(span):
+	default:
+		r.logger.Error("span 上报队列已满, 丢弃 span: " + span.OperationName())
+	}
+}
+
+func (r *batchReporter) setLogger(logger jaeger.Logger) {
+	r.logger.set(logger)
+}
+
+// 关闭前将队列中的 span 全部上报
+func (r *batchReporter) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.wg.Wait()
+	})
+}
+
+func (r *batchReporter) loop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*spanData, 0, r.batchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.flush(batch); err != nil {
+			r.logger.Error("span 上报失败, 错误原因: " + err.Error())
+		}
+		batch = make([]*spanData, 0, r.batchSize)
+	}
+
+	for {
+		select {
+		case d := <-r.queue:
+			batch = append(batch, d)
+			if len(batch) >= r.batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case <-r.done:
+			for {
+				select {
+				case d := <-r.queue:
+					batch = append(batch, d)
+					if len(batch) >= r.batchSize {
+						send()
+					}
+				default:
+					send()
+					return
+				}
+			}
+		}
+	}
+}
+
+func newReporterClient() *http.Client {
+	return &http.Client{Timeout: _defaultReporterTimeout}
+}
+
+// 将 v 编码为 json 发送到 url
+func sendJSON(client *http.Client, method, url string, header http.Header, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return send(client, method, url, header, "application/json", body)
+}
+
+// 发送上报的内容，返回非 2xx 状态码时视为失败
+func send(client *http.Client, method, url string, header http.Header, contentType string, body []byte) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s 返回状态码 %d", url, resp.StatusCode)
+	}
+	return nil
+}
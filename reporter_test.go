@@ -0,0 +1,54 @@
+package istiogormtracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReporterTuning(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	i, err := New(
+		WithServiceName("istio-gorm-tracing-test"),
+		WithCollectorEndpoint(server.URL+"/api/traces"),
+		WithReporterQueueSize(10),
+		WithReporterFlushInterval(time.Hour),
+		WithReporterBatchSize(2),
+		WithLogSpans(false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	for n := 0; n < 4; n++ {
+		i.getTracer().StartSpan(_opQuery).Finish()
+	}
+
+	// 定时上报的间隔为 1 小时，只有每批满 2 个 span 时才会上报
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		got := requests
+		mu.Unlock()
+		if got == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("requests = %d, want 2", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
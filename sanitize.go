@@ -0,0 +1,38 @@
+package istiogormtracing
+
+import "regexp"
+
+// 在 SQL 记录到 span 之前对其进行处理，如去掉其中的敏感信息
+type SQLSanitizer func(sql string) string
+
+// 将 re 匹配的内容替换为 repl，repl 的格式与 regexp.ReplaceAllString 相同
+func RegexpSanitizer(re *regexp.Regexp, repl string) SQLSanitizer {
+	return func(sql string) string {
+		return re.ReplaceAllString(sql, repl)
+	}
+}
+
+// 内置的处理规则
+var (
+	// 将邮箱替换为 ***
+	SanitizeEmails = RegexpSanitizer(regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), _maskedValue)
+	// 将手机号(如 13800138000)和带分隔符的电话号码(如 +1 415-555-0100)替换为 ***
+	SanitizePhones = RegexpSanitizer(regexp.MustCompile(`(?:\+\d{1,3}[- ]?)?\(?\d{3}\)?[- ]\d{3,4}[- ]\d{4}\b|\b1[3-9]\d{9}\b`), _maskedValue)
+	// 将 Bearer token 替换为 Bearer ***
+	SanitizeBearerTokens = RegexpSanitizer(regexp.MustCompile(`(?i)\b(bearer)\s+[A-Za-z0-9\-._~+/]+=*`), "${1} "+_maskedValue)
+)
+
+// 配置文件中使用的名称
+var _sqlSanitizerNames = map[string]SQLSanitizer{
+	"email":        SanitizeEmails,
+	"phone":        SanitizePhones,
+	"bearer_token": SanitizeBearerTokens,
+}
+
+// 依次执行 WithSQLSanitizer 设置的处理方法
+func (i *IstioGormTracing) sanitize(sql string) string {
+	for _, s := range i.sqlSanitizers {
+		sql = s(sql)
+	}
+	return sql
+}
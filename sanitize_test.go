@@ -0,0 +1,54 @@
+package istiogormtracing
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSQLSanitizers(t *testing.T) {
+	cases := []struct {
+		sanitizer SQLSanitizer
+		in, want  string
+	}{
+		{SanitizeEmails, "SELECT * FROM users WHERE email = 'xiao.ming+1@example.com'", "SELECT * FROM users WHERE email = '***'"},
+		{SanitizePhones, "SELECT * FROM users WHERE phone = '13800138000' AND id = 12345678901", "SELECT * FROM users WHERE phone = '***' AND id = 12345678901"},
+		{SanitizePhones, "UPDATE users SET phone = '+1 415-555-0100'", "UPDATE users SET phone = '***'"},
+		{SanitizeBearerTokens, "INSERT INTO logs (header) VALUES ('Bearer eyJhbGciOi.J9.abc_-=')", "INSERT INTO logs (header) VALUES ('Bearer ***')"},
+		{RegexpSanitizer(regexp.MustCompile(`\d{6}`), "######"), "WHERE code = '123456'", "WHERE code = '######'"},
+	}
+	for _, c := range cases {
+		if got := c.sanitizer(c.in); got != c.want {
+			t.Errorf("sanitize(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestWithSQLSanitizer(t *testing.T) {
+	tracer := mocktracer.New()
+	db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewWithTracer(tracer, WithSQLSanitizer(SanitizeEmails))); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Where("email = ?", "xiaoming@example.com").Find(&list)
+
+	got := map[string]string{}
+	for _, record := range tracer.FinishedSpans()[0].Logs() {
+		for _, field := range record.Fields {
+			got[field.Key] = field.ValueString
+		}
+	}
+	if got[_fieldSQL] != "SELECT * FROM users WHERE email = '***'" {
+		t.Errorf("sql = %s", got[_fieldSQL])
+	}
+	if got[_fieldBindings] != `["***"]` {
+		t.Errorf("bindings = %s", got[_fieldBindings])
+	}
+}
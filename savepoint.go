@@ -0,0 +1,56 @@
+package istiogormtracing
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// 嵌套事务使用的保存点，gorm 通过 Exec 执行，记录为 raw span
+const (
+	_tagSavepoint       = "db.savepoint"
+	_tagSavepointAction = "db.savepoint.action"
+)
+
+// 保存点操作，同时作为 span 的操作名称
+const (
+	_savepointCreate     = "savepoint"
+	_savepointRollbackTo = "rollback_to_savepoint"
+	_savepointRelease    = "release_savepoint"
+)
+
+// 支持 mysql、postgres、sqlite 的 SAVEPOINT 和 sqlserver 的 SAVE TRANSACTION
+var _savepointRe = regexp.MustCompile(`(?i)^\s*(SAVEPOINT|SAVE\s+TRAN(?:SACTION)?|ROLLBACK\s+TO(?:\s+SAVEPOINT)?|ROLLBACK\s+TRAN(?:SACTION)?|RELEASE(?:\s+SAVEPOINT)?)\s+([^\s;]+)\s*;?\s*$`)
+
+// 解析保存点操作和保存点名称，不是保存点操作时 action 为空
+func parseSavepoint(sql string) (action, name string) {
+	m := _savepointRe.FindStringSubmatch(sql)
+	if m == nil {
+		return "", ""
+	}
+	keyword := strings.ToUpper(strings.Fields(m[1])[0])
+	switch keyword {
+	case "SAVEPOINT", "SAVE":
+		action = _savepointCreate
+	case "ROLLBACK":
+		action = _savepointRollbackTo
+	case "RELEASE":
+		action = _savepointRelease
+	}
+	return action, strings.Trim(m[2], "`\"[]")
+}
+
+// 保存点操作的 span 使用保存点操作作为名称，部分回滚可以在 jaeger 中直接看到；SetOperationName 设置的名称优先
+func setSavepointTags(span opentracing.Span, sql string, named bool) bool {
+	action, name := parseSavepoint(sql)
+	if action == "" {
+		return false
+	}
+	span.SetTag(_tagSavepointAction, action)
+	span.SetTag(_tagSavepoint, name)
+	if !named {
+		span.SetOperationName(action)
+	}
+	return true
+}
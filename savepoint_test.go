@@ -0,0 +1,75 @@
+package istiogormtracing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+)
+
+func TestParseSavepoint(t *testing.T) {
+	cases := []struct {
+		sql, action, name string
+	}{
+		{"SAVEPOINT sp0xc000010", _savepointCreate, "sp0xc000010"},
+		{"ROLLBACK TO SAVEPOINT sp1", _savepointRollbackTo, "sp1"},
+		{"rollback to sp1;", _savepointRollbackTo, "sp1"},
+		{`RELEASE SAVEPOINT "sp1"`, _savepointRelease, "sp1"},
+		{"SAVE TRANSACTION sp2", _savepointCreate, "sp2"},
+		{"ROLLBACK TRANSACTION sp2", _savepointRollbackTo, "sp2"},
+		{"ROLLBACK", "", ""},
+		{"SELECT * FROM savepoints WHERE id = 1", "", ""},
+	}
+	for _, c := range cases {
+		if action, name := parseSavepoint(c.sql); action != c.action || name != c.name {
+			t.Errorf("parseSavepoint(%q) = %q, %q", c.sql, action, name)
+		}
+	}
+}
+
+func TestSavepointSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	plugin := NewWithTracer(tracer)
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	partial := errors.New("partial rollback")
+	err := plugin.Transaction(db, func(tx *gorm.DB) error {
+		tx.Table("users").Find(&list)
+		if err := plugin.Transaction(tx, func(tx *gorm.DB) error { return partial }); err != partial {
+			t.Errorf("nested err = %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ops []string
+	var nested *mocktracer.MockSpan
+	for _, span := range tracer.FinishedSpans() {
+		ops = append(ops, span.OperationName)
+		if span.Tag(_tagTransactionNested) == true {
+			nested = span
+		}
+	}
+	want := []string{"query", _savepointCreate, _savepointRollbackTo, _opTransaction, _opTransaction}
+	if len(ops) != len(want) {
+		t.Fatalf("ops = %v", ops)
+	}
+	for n := range want {
+		if ops[n] != want[n] {
+			t.Errorf("ops = %v, want %v", ops, want)
+			break
+		}
+	}
+	if nested == nil || nested.Tag(_tagTransactionOutcome) != _outcomeRollback {
+		t.Errorf("nested transaction span = %v", nested)
+	}
+	if sp := tracer.FinishedSpans()[1]; sp.Tag(_tagSavepoint) == "" || sp.Tag(_tagSavepointAction) != _savepointCreate {
+		t.Errorf("savepoint tags = %v", sp.Tags())
+	}
+}
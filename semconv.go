@@ -0,0 +1,55 @@
+package istiogormtracing
+
+import (
+	"net"
+
+	"github.com/opentracing/opentracing-go"
+	"gorm.io/gorm"
+)
+
+// OpenTelemetry 数据库语义约定中的属性名称，db.system 见 _tagDBSystem
+const (
+	_tagDBStatement = "db.statement"
+	_tagDBOperation = "db.operation"
+	_tagDBSQLTable  = "db.sql.table"
+	_tagServerAddr  = "server.address"
+	_tagServerPort  = "server.port"
+)
+
+// 各操作对应的 SQL 关键字，row 和 raw 从 SQL 中取
+var _dbOperations = map[string]string{
+	_opCreate: "INSERT",
+	_opUpdate: "UPDATE",
+	_opQuery:  "SELECT",
+	_opDelete: "DELETE",
+}
+
+// 按语义约定记录 SQL 信息，代替 sql、table、query、bindings 日志字段
+func (i *IstioGormTracing) setSemconvTags(span opentracing.Span, db *gorm.DB, op, sql string) {
+	span.SetTag(_tagDBStatement, i.truncate(span, sql))
+	if operation := dbOperation(op, db.Statement.SQL.String()); operation != "" {
+		span.SetTag(_tagDBOperation, operation)
+	}
+	if table := statementTable(db); table != "" {
+		span.SetTag(_tagDBSQLTable, table)
+	}
+	if info, ok := i.dsnInfoOf(db); ok && info.Address != "" {
+		host, port, err := net.SplitHostPort(info.Address)
+		if err != nil {
+			host, port = info.Address, ""
+		}
+		span.SetTag(_tagServerAddr, host)
+		if port != "" {
+			span.SetTag(_tagServerPort, port)
+		}
+	}
+}
+
+// SQL 的操作类型，如 SELECT、INSERT
+func dbOperation(op, sql string) string {
+	if operation, ok := _dbOperations[op]; ok {
+		return operation
+	}
+	verb, _ := parseSQL(sql)
+	return verb
+}
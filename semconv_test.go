@@ -0,0 +1,86 @@
+package istiogormtracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestWithSemanticConventions(t *testing.T) {
+	exporter := &recordExporter{}
+	i, err := New(WithServiceName("istio-gorm-tracing-test"), WithExporter(exporter), WithSemanticConventions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialector := dsnDialector{Config: &dsnConfig{DSN: "gorm:secret@tcp(mysql.prod:3306)/orders"}}
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(i); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Where("id = ?", 1).Find(&list)
+	db.Exec("TRUNCATE TABLE users")
+	if err := i.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("spans = %d", len(exporter.spans))
+	}
+	query := exporter.spans[0]
+	for k, want := range map[string]interface{}{
+		_tagDBSystem:    "mysql",
+		_tagDBStatement: "SELECT * FROM users WHERE id = 1",
+		_tagDBOperation: "SELECT",
+		_tagDBSQLTable:  "users",
+		_tagServerAddr:  "mysql.prod",
+		_tagServerPort:  "3306",
+	} {
+		if query.Tags[k] != want {
+			t.Errorf("%s = %v, want %v", k, query.Tags[k], want)
+		}
+	}
+	if _, ok := query.Fields["sql"]; ok {
+		t.Error("sql log field should not be recorded")
+	}
+	// 上报组件从 tag 中读取 SQL 和表名
+	if query.SQL != "SELECT * FROM users WHERE id = 1" || query.Table != "users" {
+		t.Errorf("sql = %s, table = %s", query.SQL, query.Table)
+	}
+	if op := exporter.spans[1].Tags[_tagDBOperation]; op != "TRUNCATE" {
+		t.Errorf("raw operation = %v", op)
+	}
+}
+
+// 会话和事务中的 SQL 同样记录 server.address 和 server.port
+func TestSemanticConventionsInSession(t *testing.T) {
+	tracer := mocktracer.New()
+	db, err := gorm.Open(dsnDialector{Config: &dsnConfig{DSN: "gorm:secret@tcp(mysql.prod:3306)/orders"}}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewWithTracer(tracer, WithSemanticConventions())); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.WithContext(context.Background()).Table("users").Find(&list)
+	db.Transaction(func(tx *gorm.DB) error {
+		return tx.Table("users").Find(&list).Error
+	})
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	for n, span := range spans {
+		if span.Tag(_tagServerAddr) != "mysql.prod" || span.Tag(_tagServerPort) != "3306" {
+			t.Errorf("span %d: tags = %v", n, span.Tags())
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package istiogormtracing
+
+import "gorm.io/gorm"
+
+// 通过 db.Set 为单次查询设置的追踪选项
+const (
+	// 值为 true 时不创建 span
+	_settingSkip = "istio-gorm-tracing:skip"
+	// span 的操作名称，代替默认的 query、create 等
+	_settingOperation = "istio-gorm-tracing:op"
+)
+
+// 跳过追踪，用于高频查询、定时任务或健康检查等不需要追踪的场景，与 db.Set("istio-gorm-tracing:skip", true) 相同
+// 使用方式: istiogormtracing.SkipTracing(db).Find(&users)
+func SkipTracing(db *gorm.DB) *gorm.DB {
+	return db.Set(_settingSkip, true)
+}
+
+// 是否设置了跳过追踪
+func skipTracing(db *gorm.DB) bool {
+	v, ok := db.Get(_settingSkip)
+	if !ok {
+		return false
+	}
+	skip, _ := v.(bool)
+	return skip
+}
+
+// 为重要的查询设置 span 的操作名称，便于在 jaeger 中查找，与 db.Set("istio-gorm-tracing:op", name) 相同
+// 使用方式: istiogormtracing.SetOperationName(db, "load-user-profile").First(&user)
+func SetOperationName(db *gorm.DB, name string) *gorm.DB {
+	return db.Set(_settingOperation, name)
+}
+
+// 设置了操作名称时使用设置的名称，否则使用 op
+func operationName(db *gorm.DB, op string) string {
+	if name := customOperationName(db); name != "" {
+		return name
+	}
+	return op
+}
+
+// SetOperationName 设置的名称，没有设置时为空
+func customOperationName(db *gorm.DB) string {
+	v, ok := db.Get(_settingOperation)
+	if !ok {
+		return ""
+	}
+	name, _ := v.(string)
+	return name
+}
@@ -0,0 +1,68 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+)
+
+func TestSkipTracing(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	SkipTracing(db).Table("users").Find(&list)
+	db.Set("istio-gorm-tracing:skip", true).Table("users").Find(&list)
+	if len(tracer.FinishedSpans()) != 0 {
+		t.Fatalf("spans = %d while skipped", len(tracer.FinishedSpans()))
+	}
+
+	// 只影响设置了的会话
+	db.Table("users").Find(&list)
+	if len(tracer.FinishedSpans()) != 1 {
+		t.Errorf("spans = %d, want 1", len(tracer.FinishedSpans()))
+	}
+}
+
+func TestSetOperationName(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	SetOperationName(db, "load-user-profile").Table("users").Find(&list)
+	db.Set("istio-gorm-tracing:op", "list-orders").Table("orders").Find(&list)
+	db.Table("users").Find(&list)
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 3 {
+		t.Fatalf("spans = %d", len(spans))
+	}
+	for n, want := range []string{"load-user-profile", "list-orders", _opQuery} {
+		if spans[n].OperationName != want {
+			t.Errorf("span %d operation = %s, want %s", n, spans[n].OperationName, want)
+		}
+	}
+}
+
+func TestSkipDryRun(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Session(&gorm.Session{DryRun: true}).Table("users").Find(&list)
+	db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Table("users").Find(&list)
+	})
+	db.Table("users").Find(&list)
+
+	if n := len(tracer.FinishedSpans()); n != 1 {
+		t.Errorf("spans = %d, want 1", n)
+	}
+}
@@ -0,0 +1,317 @@
+package istiogormtracing
+
+import (
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	// SkyWalking 使用的 header，格式为: sw8: {sample}-{trace id}-{segment id}-{span id}-{service}-{instance}-{endpoint}-{address}
+	// 除 sample 和 span id 外都是 base64 编码的字符串
+	_headerSW8 = "sw8"
+	// 解析到的 sw8 header 原样保存在 baggage 中，上报时用于还原 SkyWalking 的 trace id 和父 segment
+	_baggageSW8 = "sw8"
+
+	// OAP 接收 segment 的 http 接口，默认端口为 12800
+	_skyWalkingSegmentsPath = "/v3/segments"
+	// component-libraries.yml 中 GORM 的 id
+	_skyWalkingComponentGORM = 5008
+)
+
+// SkyWalking 格式: sw8，使用 SkyWalking 的网格或上游服务接入了 SkyWalking agent 时使用
+// serviceName 为注入时写入的 parent service，为空时使用 "-"
+// SkyWalking 的 trace id 和 segment id 是任意字符串，不是十六进制时通过哈希转换为 jaeger 的 id，原始值保存在 baggage 中
+func SkyWalkingPropagator(serviceName string) Propagator {
+	if serviceName == "" {
+		serviceName = "-"
+	}
+	return skyWalkingPropagator{serviceName: serviceName}
+}
+
+type skyWalkingPropagator struct {
+	serviceName string
+}
+
+func (skyWalkingPropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	h, err := carrierToHeader(carrier)
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+	return extractSW8(h)
+}
+
+// 每个 jaeger span 对应一个只有一个 span 的 segment，segment id 为 {trace id}.{span id}
+func (p skyWalkingPropagator) Inject(spanCtx jaeger.SpanContext, carrier interface{}) error {
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	sampled := "0"
+	if spanCtx.IsSampled() {
+		sampled = "1"
+	}
+	var baggage string
+	spanCtx.ForeachBaggageItem(func(k, v string) bool {
+		if k == _baggageSW8 {
+			baggage = v
+		}
+		return true
+	})
+	instance, _ := os.Hostname()
+	w.Set(_headerSW8, strings.Join([]string{
+		sampled,
+		encodeSW8(skyWalkingTraceID(spanCtx.TraceID(), baggage)),
+		encodeSW8(skyWalkingSegmentID(spanCtx.TraceID(), spanCtx.SpanID())),
+		"0",
+		encodeSW8(p.serviceName),
+		encodeSW8(instance),
+		encodeSW8("gorm"),
+		encodeSW8("-"),
+	}, "-"))
+	return nil
+}
+
+// 解析后的 sw8 header
+type sw8Header struct {
+	sampled   bool
+	traceID   string
+	segmentID string
+	spanID    int
+	service   string
+	instance  string
+	endpoint  string
+	address   string
+}
+
+func parseSW8(header string) (sw8Header, error) {
+	parts := strings.Split(header, "-")
+	if len(parts) != 8 {
+		return sw8Header{}, opentracing.ErrSpanContextCorrupted
+	}
+	var decoded [8]string
+	for idx, part := range parts {
+		if idx == 0 || idx == 3 {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return sw8Header{}, opentracing.ErrSpanContextCorrupted
+		}
+		decoded[idx] = string(b)
+	}
+	spanID, err := strconv.Atoi(parts[3])
+	if err != nil || decoded[1] == "" || decoded[2] == "" {
+		return sw8Header{}, opentracing.ErrSpanContextCorrupted
+	}
+	return sw8Header{
+		sampled:   parts[0] == "1",
+		traceID:   decoded[1],
+		segmentID: decoded[2],
+		spanID:    spanID,
+		service:   decoded[4],
+		instance:  decoded[5],
+		endpoint:  decoded[6],
+		address:   decoded[7],
+	}, nil
+}
+
+func extractSW8(h http.Header) (jaeger.SpanContext, error) {
+	header := strings.TrimSpace(h.Get(_headerSW8))
+	if header == "" {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	sw8, err := parseSW8(header)
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+	return jaeger.NewSpanContext(
+		jaegerTraceID(sw8.traceID),
+		jaegerSpanID(sw8.segmentID, sw8.spanID),
+		0,
+		sw8.sampled,
+		map[string]string{_baggageSW8: header},
+	), nil
+}
+
+// 十六进制的 trace id(如 B3、W3C 传过来的)直接使用，否则取哈希
+func jaegerTraceID(traceID string) jaeger.TraceID {
+	if len(traceID) <= 32 {
+		if id, err := jaeger.TraceIDFromString(traceID); err == nil && id.IsValid() {
+			return id
+		}
+	}
+	h := fnv.New128a()
+	h.Write([]byte(traceID))
+	sum := h.Sum(nil)
+	var id jaeger.TraceID
+	for _, b := range sum[:8] {
+		id.High = id.High<<8 | uint64(b)
+	}
+	for _, b := range sum[8:] {
+		id.Low = id.Low<<8 | uint64(b)
+	}
+	return id
+}
+
+// 插件自己注入的 segment 直接取出 span id，其他 agent 生成的 segment 取 segment id 和 span id 的哈希
+func jaegerSpanID(segmentID string, spanID int) jaeger.SpanID {
+	if idx := strings.LastIndex(segmentID, "."); idx >= 0 && spanID == 0 {
+		if id, err := jaeger.SpanIDFromString(segmentID[idx+1:]); err == nil && id != 0 {
+			return id
+		}
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s-%d", segmentID, spanID)
+	return jaeger.SpanID(h.Sum64())
+}
+
+// 链路是从 SkyWalking 传过来的时候沿用原始的 trace id
+func skyWalkingTraceID(traceID jaeger.TraceID, sw8 string) string {
+	if sw8 != "" {
+		if parsed, err := parseSW8(sw8); err == nil {
+			return parsed.traceID
+		}
+	}
+	return traceID.String()
+}
+
+func skyWalkingSegmentID(traceID jaeger.TraceID, spanID jaeger.SpanID) string {
+	return traceID.String() + "." + spanID.String()
+}
+
+func encodeSW8(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// SkyWalking 的 segment 格式，见 https://github.com/apache/skywalking-data-collect-protocol/blob/master/language-agent/Tracing.proto
+type skyWalkingSegment struct {
+	TraceID         string           `json:"traceId"`
+	TraceSegmentID  string           `json:"traceSegmentId"`
+	Service         string           `json:"service"`
+	ServiceInstance string           `json:"serviceInstance"`
+	Spans           []skyWalkingSpan `json:"spans"`
+}
+
+type skyWalkingSpan struct {
+	SpanID        int             `json:"spanId"`
+	ParentSpanID  int             `json:"parentSpanId"`
+	StartTime     int64           `json:"startTime"`
+	EndTime       int64           `json:"endTime"`
+	Refs          []skyWalkingRef `json:"refs,omitempty"`
+	OperationName string          `json:"operationName"`
+	Peer          string          `json:"peer,omitempty"`
+	SpanType      string          `json:"spanType"`
+	SpanLayer     string          `json:"spanLayer"`
+	ComponentID   int             `json:"componentId"`
+	IsError       bool            `json:"isError"`
+	Tags          []skyWalkingTag `json:"tags,omitempty"`
+}
+
+type skyWalkingRef struct {
+	RefType                  string `json:"refType"`
+	TraceID                  string `json:"traceId"`
+	ParentTraceSegmentID     string `json:"parentTraceSegmentId"`
+	ParentSpanID             int    `json:"parentSpanId"`
+	ParentService            string `json:"parentService"`
+	ParentServiceInstance    string `json:"parentServiceInstance"`
+	ParentEndpoint           string `json:"parentEndpoint"`
+	NetworkAddressUsedAtPeer string `json:"networkAddressUsedAtPeer"`
+}
+
+type skyWalkingTag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// 上报到 SkyWalking OAP 的 http 接口，oapURL 如 http://skywalking-oap.istio-system:12800，instance 为空时使用主机名
+// 每个 gorm 的操作上报为一个 Database 类型的 Exit span，SQL 记录在 db.statement 中
+func NewSkyWalkingReporter(serviceName, instance, oapURL string) jaeger.Reporter {
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	client := newReporterClient()
+	url := strings.TrimSuffix(oapURL, "/") + _skyWalkingSegmentsPath
+	return newBatchReporter(func(spans []*spanData) error {
+		return sendJSON(client, http.MethodPost, url, nil, toSkyWalkingSegments(serviceName, instance, spans))
+	}, nil)
+}
+
+func toSkyWalkingSegments(serviceName, instance string, spans []*spanData) []skyWalkingSegment {
+	out := make([]skyWalkingSegment, 0, len(spans))
+	for _, d := range spans {
+		traceID := skyWalkingTraceID(d.TraceID, d.Baggage[_baggageSW8])
+		dbType, _ := d.Tags["db.type"].(string)
+		if dbType == "" {
+			dbType = "sql"
+		}
+		span := skyWalkingSpan{
+			SpanID:        0,
+			ParentSpanID:  -1,
+			StartTime:     d.Start.UnixNano() / 1e6,
+			EndTime:       d.Start.Add(d.Duration).UnixNano() / 1e6,
+			OperationName: "gorm/" + d.Operation,
+			SpanType:      "Exit",
+			SpanLayer:     "Database",
+			ComponentID:   _skyWalkingComponentGORM,
+			IsError:       d.isError(),
+			Tags: []skyWalkingTag{
+				{Key: "db.type", Value: dbType},
+				{Key: "db.statement", Value: d.sql()},
+			},
+		}
+		if peer, ok := d.Tags["peer.address"]; ok {
+			span.Peer = fmt.Sprint(peer)
+		}
+		if table := d.table(); table != "" {
+			span.Tags = append(span.Tags, skyWalkingTag{Key: "table", Value: table})
+		}
+		if msg := d.Fields["error.object"]; msg != "" {
+			span.Tags = append(span.Tags, skyWalkingTag{Key: "error.message", Value: msg})
+		}
+		if d.ParentID != 0 {
+			span.Refs = []skyWalkingRef{skyWalkingParentRef(serviceName, instance, traceID, d)}
+		}
+		out = append(out, skyWalkingSegment{
+			TraceID:         traceID,
+			TraceSegmentID:  skyWalkingSegmentID(d.TraceID, d.SpanID),
+			Service:         serviceName,
+			ServiceInstance: instance,
+			Spans:           []skyWalkingSpan{span},
+		})
+	}
+	return out
+}
+
+// 父 span 是从 sw8 解析出来的时候引用原始的 segment，否则引用父 span 对应的 segment
+func skyWalkingParentRef(serviceName, instance, traceID string, d *spanData) skyWalkingRef {
+	if sw8, err := parseSW8(d.Baggage[_baggageSW8]); err == nil && jaegerSpanID(sw8.segmentID, sw8.spanID) == d.ParentID {
+		return skyWalkingRef{
+			RefType:                  "CrossProcess",
+			TraceID:                  traceID,
+			ParentTraceSegmentID:     sw8.segmentID,
+			ParentSpanID:             sw8.spanID,
+			ParentService:            sw8.service,
+			ParentServiceInstance:    sw8.instance,
+			ParentEndpoint:           sw8.endpoint,
+			NetworkAddressUsedAtPeer: sw8.address,
+		}
+	}
+	return skyWalkingRef{
+		RefType:                  "CrossThread",
+		TraceID:                  traceID,
+		ParentTraceSegmentID:     skyWalkingSegmentID(d.TraceID, d.ParentID),
+		ParentSpanID:             0,
+		ParentService:            serviceName,
+		ParentServiceInstance:    instance,
+		ParentEndpoint:           "gorm",
+		NetworkAddressUsedAtPeer: "-",
+	}
+}
@@ -0,0 +1,61 @@
+package istiogormtracing
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestSkyWalkingFromAgent(t *testing.T) {
+	// SkyWalking agent 生成的 trace id 不是十六进制
+	header := "1-" + encodeSW8("a1b2c3.51.16788") + "-" + encodeSW8("a1b2c3.51.16789") + "-3-" +
+		encodeSW8("frontend") + "-" + encodeSW8("frontend@10.0.0.1") + "-" + encodeSW8("/users") + "-" + encodeSW8("users:8080")
+	h := http.Header{}
+	h.Set("sw8", header)
+	parent, err := SkyWalkingPropagator("").Extract(opentracing.HTTPHeadersCarrier(h))
+	if err != nil || !parent.IsSampled() {
+		t.Fatalf("extract = %v, %v", parent, err)
+	}
+
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+	span := tracer.StartSpan(_opQuery, opentracing.ChildOf(parent)).(*jaeger.Span)
+	span.Finish()
+
+	segments := toSkyWalkingSegments("users", "users-0", []*spanData{newSpanData(span)})
+	if len(segments) != 1 || segments[0].TraceID != "a1b2c3.51.16788" {
+		t.Fatalf("segments = %+v", segments)
+	}
+	refs := segments[0].Spans[0].Refs
+	if len(refs) != 1 || refs[0].ParentTraceSegmentID != "a1b2c3.51.16789" || refs[0].ParentSpanID != 3 ||
+		refs[0].ParentService != "frontend" || refs[0].RefType != "CrossProcess" {
+		t.Errorf("refs = %+v", refs)
+	}
+}
+
+func TestSkyWalkingRoundTrip(t *testing.T) {
+	traceID, _ := jaeger.TraceIDFromString("463ac35c9f6413ad48485a3953bb6124")
+	spanCtx := jaeger.NewSpanContext(traceID, 0x0020000000000001, 0, true, nil)
+	carrier := opentracing.TextMapCarrier{}
+	if err := SkyWalkingPropagator("users").Inject(spanCtx, carrier); err != nil {
+		t.Fatal(err)
+	}
+	sw8, err := parseSW8(carrier["sw8"])
+	if err != nil || sw8.traceID != traceID.String() || sw8.service != "users" {
+		t.Fatalf("sw8 = %+v, %v", sw8, err)
+	}
+
+	h := http.Header{}
+	h.Set("sw8", carrier["sw8"])
+	extracted, err := extractSW8(h)
+	if err != nil || extracted.TraceID() != traceID || extracted.SpanID() != spanCtx.SpanID() {
+		t.Errorf("extracted = %s, %v", extracted, err)
+	}
+
+	h.Set("sw8", "1-bad")
+	if _, err := extractSW8(h); err != opentracing.ErrSpanContextCorrupted {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package istiogormtracing
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"gorm.io/gorm"
+)
+
+// 执行时间超过阈值的 span 标记为 db.slow=true
+const _tagSlow = "db.slow"
+
+// 设置慢查询的阈值，执行时间超过阈值的 span 会标记 db.slow=true，在 jaeger 中搜索 db.slow=true 即可找到慢查询
+// logEvent 为 true 时同时在 span 中记录一条 slow query 日志，包含执行时间和阈值；可以通过 Reconfigure 在运行时修改阈值
+func WithSlowQueryThreshold(threshold time.Duration, logEvent bool) Option {
+	return func(i *IstioGormTracing) {
+		i.slowQuery = threshold
+		i.slowQueryLog = logEvent
+		atomic.StoreInt64(&i.slowQueryThreshold, int64(threshold))
+	}
+}
+
+// 在 gorm.Statement 中保存开始时间的 key
+func (i *IstioGormTracing) startTimeKey() string {
+	return i.getSpanKey() + ":start"
+}
+
+// 执行时间超过阈值时标记慢查询
+func (i *IstioGormTracing) markSlowQuery(span opentracing.Span, db *gorm.DB) {
+	threshold := time.Duration(atomic.LoadInt64(&i.slowQueryThreshold))
+	if threshold <= 0 {
+		return
+	}
+	v, ok := db.InstanceGet(i.startTimeKey())
+	if !ok {
+		return
+	}
+	start, _ := v.(time.Time)
+	if elapsed := time.Since(start); elapsed >= threshold {
+		span.SetTag(_tagSlow, true)
+		if i.slowQueryLog {
+			span.LogFields(
+				opentracinglog.String("event", "slow query"),
+				opentracinglog.String("duration", elapsed.String()),
+				opentracinglog.String("threshold", threshold.String()),
+			)
+		}
+	}
+}
+
+// 设置上报的最短执行时间，执行时间小于 d 的 SQL 的 span 在结束时丢弃(不调用 Finish，不会上报)，只保留慢 SQL，可以大幅减少追踪数据量
+// 出错的 SQL 总是上报；子 span(Preload 的查询、prepare)与父 span 一起上报或丢弃，子 span 需要上报时父 span 也会上报
+// 可以通过 Reconfigure 在运行时修改
+func WithMinDuration(d time.Duration) Option {
+	return func(i *IstioGormTracing) {
+		i.minDuration = d
+		atomic.StoreInt64(&i.minDurationThreshold, int64(d))
+	}
+}
+
+// 是否需要记录 SQL 的开始时间
+func (i *IstioGormTracing) timed() bool {
+	return atomic.LoadInt64(&i.slowQueryThreshold) > 0 || atomic.LoadInt64(&i.minDurationThreshold) > 0
+}
+
+// 结束 SQL 的 span，执行时间小于 WithMinDuration 设置的时间且没有出错时丢弃
+func (i *IstioGormTracing) finishSpan(span opentracing.Span, db *gorm.DB) {
+	i.endSpan(span, db.Error != nil && i.isError(db.Error))
+}
+
+// 结束 span，不是 pendingSpan 时直接结束
+func (i *IstioGormTracing) endSpan(span opentracing.Span, failed bool) {
+	p, ok := span.(*pendingSpan)
+	if !ok {
+		span.Finish()
+		return
+	}
+	now := time.Now()
+	min := time.Duration(atomic.LoadInt64(&i.minDurationThreshold))
+	p.end(failed || min <= 0 || now.Sub(p.start) >= min, now)
+}
+
+// WithMinDuration 开启时 SQL 的 span，结束时才决定是否上报
+// 子 span 比父 span 先结束，先保存在父 span 中，与父 span 一起上报或丢弃，避免上报找不到父 span 的子 span
+type pendingSpan struct {
+	opentracing.Span
+	parent *pendingSpan
+	start  time.Time
+
+	mu sync.Mutex
+	// 已结束、等待父 span 决定的子 span
+	children []pendingChild
+	// 有子 span 需要上报
+	keep bool
+	// 是否已经上报或丢弃
+	decided, kept bool
+}
+
+type pendingChild struct {
+	span   *pendingSpan
+	finish time.Time
+}
+
+// 包装 SQL 的 span，context 中的父 span 也是 pendingSpan 时作为它的子 span
+func newPendingSpan(span opentracing.Span, ctx context.Context) *pendingSpan {
+	parent, _ := opentracing.SpanFromContext(ctx).(*pendingSpan)
+	return &pendingSpan{Span: span, parent: parent, start: time.Now()}
+}
+
+// 父 span 是 pendingSpan 时包装子 span，否则返回原来的 span
+func pendingChildSpan(span, parent opentracing.Span) opentracing.Span {
+	p, ok := parent.(*pendingSpan)
+	if !ok {
+		return span
+	}
+	return &pendingSpan{Span: span, parent: p, start: time.Now()}
+}
+
+// span 结束，keep 为 span 本身是否需要上报；有父 span 且父 span 还没有结束时交给父 span 决定
+func (s *pendingSpan) end(keep bool, finish time.Time) {
+	s.mu.Lock()
+	keep = keep || s.keep
+	s.mu.Unlock()
+	if p := s.parent; p != nil {
+		p.mu.Lock()
+		if !p.decided {
+			p.children = append(p.children, pendingChild{span: s, finish: finish})
+			p.keep = p.keep || keep
+			p.mu.Unlock()
+			return
+		}
+		// 父 span 已经上报或丢弃，与父 span 保持一致
+		keep = p.kept
+		p.mu.Unlock()
+	}
+	s.settle(keep, finish)
+}
+
+// 上报或丢弃 span 和等待中的子 span，上报时使用原来的结束时间
+func (s *pendingSpan) settle(keep bool, finish time.Time) {
+	s.mu.Lock()
+	s.decided, s.kept = true, keep
+	children := s.children
+	s.children = nil
+	s.mu.Unlock()
+	if keep {
+		s.Span.FinishWithOptions(opentracing.FinishOptions{FinishTime: finish})
+	}
+	for _, child := range children {
+		child.span.settle(keep, child.finish)
+	}
+}
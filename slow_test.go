@@ -0,0 +1,192 @@
+package istiogormtracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/uber/jaeger-client-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestWithSlowQueryThreshold(t *testing.T) {
+	cases := []struct {
+		threshold time.Duration
+		logEvent  bool
+		slow      bool
+	}{
+		{0, false, false},
+		{time.Hour, true, false},
+		{time.Nanosecond, false, true},
+		{time.Nanosecond, true, true},
+	}
+	for _, c := range cases {
+		tracer := mocktracer.New()
+		db, err := gorm.Open(fakeDialector{}, &gorm.Config{Logger: logger.Discard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Use(NewWithTracer(tracer, WithSlowQueryThreshold(c.threshold, c.logEvent))); err != nil {
+			t.Fatal(err)
+		}
+		var list []map[string]interface{}
+		db.Table("users").Find(&list)
+
+		span := tracer.FinishedSpans()[0]
+		if got := span.Tag(_tagSlow) == true; got != c.slow {
+			t.Errorf("threshold %v: db.slow = %v", c.threshold, got)
+		}
+		logged := false
+		for _, record := range span.Logs() {
+			for _, field := range record.Fields {
+				if field.Key == "event" && field.ValueString == "slow query" {
+					logged = true
+				}
+			}
+		}
+		if logged != (c.slow && c.logEvent) {
+			t.Errorf("threshold %v: slow query log = %v", c.threshold, logged)
+		}
+	}
+}
+
+func TestReconfigureSlowQueryThreshold(t *testing.T) {
+	i, err := New(WithServiceName("istio-gorm-tracing-test"), WithReporter(jaeger.NewNullReporter()), WithSlowQueryThreshold(time.Second, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+
+	if err := i.Reconfigure(&Config{SlowQueryThreshold: "10ms"}); err != nil || i.slowQueryThreshold != int64(10*time.Millisecond) {
+		t.Errorf("reconfigure: %v, threshold = %v", err, time.Duration(i.slowQueryThreshold))
+	}
+	if err := i.Reconfigure(&Config{SlowQueryThreshold: "fast"}); err == nil || i.slowQueryThreshold != int64(10*time.Millisecond) {
+		t.Errorf("invalid threshold should be rejected, threshold = %v", time.Duration(i.slowQueryThreshold))
+	}
+	// 去掉配置后恢复为创建时的阈值
+	if err := i.Reconfigure(&Config{}); err != nil || i.slowQueryThreshold != int64(time.Second) {
+		t.Errorf("reset: %v, threshold = %v", err, time.Duration(i.slowQueryThreshold))
+	}
+}
+
+func TestWithMinDuration(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithMinDuration(20*time.Millisecond))); err != nil {
+		t.Fatal(err)
+	}
+	// 在插件的前置和后置回调之间执行，模拟慢查询
+	err := db.Callback().Query().After(_eventBeforeQuery).Before("gorm:query").Register("test:sleep", func(tx *gorm.DB) {
+		if _, ok := tx.Get("test:slow"); ok {
+			time.Sleep(30 * time.Millisecond)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	db.Set("test:slow", true).Table("orders").Find(&list)
+	db.Table("users").Create(map[string]interface{}{"id": 1})
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	if table := spans[0].Logs()[0].Fields[0]; table.Key != _fieldTable || table.ValueString != "orders" {
+		t.Errorf("logs = %v", spans[0].Logs())
+	}
+}
+
+func TestWithMinDurationReportsErrors(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithMinDuration(time.Hour), WithErrorFilter(nil))); err != nil {
+		t.Fatal(err)
+	}
+	var user map[string]interface{}
+	db.Table("users").Take(&user)
+	db.Table("users").Create(map[string]interface{}{"id": 1})
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 || spans[0].Tag("error") != true {
+		t.Fatalf("got %d spans", len(spans))
+	}
+}
+
+func TestReconfigureMinDuration(t *testing.T) {
+	i, err := New(WithServiceName("istio-gorm-tracing-test"), WithReporter(jaeger.NewNullReporter()), WithMinDuration(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+
+	if err := i.Reconfigure(&Config{MinDuration: "10ms"}); err != nil || i.minDurationThreshold != int64(10*time.Millisecond) {
+		t.Errorf("reconfigure: %v, min duration = %v", err, time.Duration(i.minDurationThreshold))
+	}
+	if err := i.Reconfigure(&Config{}); err != nil || i.minDurationThreshold != int64(time.Second) {
+		t.Errorf("reset: %v, min duration = %v", err, time.Duration(i.minDurationThreshold))
+	}
+}
+
+// Preload 的查询与主查询一起上报或丢弃，不会上报没有父 span 的子 span
+func TestMinDurationPreload(t *testing.T) {
+	for _, slowTable := range []string{"", "preload_orders", "preload_users"} {
+		tracer := mocktracer.New()
+		db := openDB(t)
+		if err := db.Use(NewWithTracer(tracer, WithMinDuration(20*time.Millisecond))); err != nil {
+			t.Fatal(err)
+		}
+		err := db.Callback().Query().After(_eventBeforeQuery).Before("gorm:query").Register("test:sleep", func(tx *gorm.DB) {
+			if tx.Statement.Table == slowTable {
+				time.Sleep(30 * time.Millisecond)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := preloadUser{ID: 1}
+		db.Preload("Orders").Find(&user)
+
+		spans := tracer.FinishedSpans()
+		if slowTable == "" {
+			if len(spans) != 0 {
+				t.Errorf("fast: got %d spans", len(spans))
+			}
+			continue
+		}
+		// 预加载的查询慢时主查询也会上报；主查询慢时预加载的查询与它一起上报
+		if len(spans) != 2 {
+			t.Fatalf("%s: got %d spans", slowTable, len(spans))
+		}
+		var parent, child *mocktracer.MockSpan
+		for _, span := range spans {
+			if span.Tag(_tagPreload) != nil {
+				child = span
+			} else {
+				parent = span
+			}
+		}
+		if parent == nil || child == nil || child.ParentID != parent.SpanContext.SpanID {
+			t.Errorf("%s: preload span should be a child of the reported query span", slowTable)
+		}
+		if child != nil && parent != nil && child.FinishTime.After(parent.FinishTime) {
+			t.Errorf("%s: preload span should keep its own finish time", slowTable)
+		}
+	}
+}
+
+// prepare span 与 SQL 的 span 一起丢弃
+func TestMinDurationPrepare(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithMinDuration(time.Hour), WithPrepareSpans())); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Session(&gorm.Session{PrepareStmt: true}).Table("users").Find(&list)
+	if spans := tracer.FinishedSpans(); len(spans) != 0 {
+		t.Errorf("got %d spans", len(spans))
+	}
+}
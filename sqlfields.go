@@ -0,0 +1,91 @@
+package istiogormtracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"gorm.io/gorm"
+)
+
+// span 中记录 SQL 信息的字段名称
+const (
+	_fieldSQL      = "sql"
+	_fieldTable    = "table"
+	_fieldQuery    = "query"
+	_fieldBindings = "bindings"
+)
+
+// 可以单独开关的 SQL 信息
+type SQLField int
+
+const (
+	// 替换了参数的完整 SQL，记录在 sql 字段中
+	SQLFieldStatement SQLField = 1 << iota
+	// 带占位符的 SQL 模板，记录在 query 字段中
+	SQLFieldTemplate
+	// json 格式的参数，记录在 bindings 字段中
+	SQLFieldVars
+
+	// 默认全部记录
+	SQLFieldAll = SQLFieldStatement | SQLFieldTemplate | SQLFieldVars
+)
+
+// 配置文件中使用的名称
+var _sqlFieldNames = map[string]SQLField{
+	_fieldSQL:      SQLFieldStatement,
+	_fieldQuery:    SQLFieldTemplate,
+	_fieldBindings: SQLFieldVars,
+}
+
+// 按 WithSQLFields 的设置生成 SQL 信息，每项只记录一次，vars 为处理过敏感字段的参数，sql 为已经过 WithSQLSanitizer 处理的完整 SQL
+// 没有参数时模板与完整 SQL 相同，此时不再重复记录模板和参数；WithRedactParams 时不记录参数
+func (i *IstioGormTracing) sqlFields(span opentracing.Span, db *gorm.DB, sql string, vars []interface{}) []opentracinglog.Field {
+	enabled := i.sqlFieldSet
+	if enabled == 0 {
+		enabled = SQLFieldAll
+	}
+	// 不记录参数时完整 SQL 就是模板
+	hasVars := len(vars) > 0 && !i.redactParams
+
+	var fields []opentracinglog.Field
+	if enabled&SQLFieldStatement != 0 {
+		fields = append(fields, opentracinglog.String(_fieldSQL, i.truncate(span, sql)))
+	}
+	if enabled&SQLFieldTemplate != 0 && (hasVars || enabled&SQLFieldStatement == 0) {
+		fields = append(fields, opentracinglog.String(_fieldQuery, i.truncate(span, i.sanitize(db.Statement.SQL.String()))))
+	}
+	if enabled&SQLFieldVars != 0 && hasVars {
+		fields = append(fields, opentracinglog.String(_fieldBindings, i.truncate(span, i.sanitize(encodeVars(vars)))))
+	}
+	return fields
+}
+
+// 参数不能转换为 json 时按默认格式输出
+func encodeVars(vars []interface{}) string {
+	b, err := json.Marshal(vars)
+	if err != nil {
+		return fmt.Sprint(vars)
+	}
+	return string(b)
+}
+
+// 超过 WithMaxSQLLength 设置的长度时截断，并在 span 中标记 truncated=true
+func (i *IstioGormTracing) truncate(span opentracing.Span, s string) string {
+	if i.maxSQLLength <= 0 || len(s) <= i.maxSQLLength {
+		return s
+	}
+	span.SetTag(_tagTruncated, true)
+	return truncateUTF8(s, i.maxSQLLength)
+}
+
+// 按字节截断，不会截断多字节字符
+func truncateUTF8(s string, max int) string {
+	n := max
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
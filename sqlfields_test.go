@@ -0,0 +1,135 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestWithSQLFields(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		fields []SQLField
+		where  bool
+		want   map[string]string
+	}{
+		{"default", nil, true, map[string]string{
+			_fieldSQL: "SELECT * FROM users WHERE id = 1", _fieldQuery: "SELECT * FROM users WHERE id = ?", _fieldBindings: "[1]",
+		}},
+		// 没有参数时不重复记录模板和参数
+		{"no vars", nil, false, map[string]string{_fieldSQL: "SELECT * FROM users"}},
+		{"template only", []SQLField{SQLFieldTemplate, SQLFieldVars}, true, map[string]string{
+			_fieldQuery: "SELECT * FROM users WHERE id = ?", _fieldBindings: "[1]",
+		}},
+		{"template without vars", []SQLField{SQLFieldTemplate}, false, map[string]string{_fieldQuery: "SELECT * FROM users"}},
+	} {
+		tracer := mocktracer.New()
+		db := openDB(t)
+		if err := db.Use(NewWithTracer(tracer, WithSQLFields(c.fields...))); err != nil {
+			t.Fatal(err)
+		}
+		var list []map[string]interface{}
+		tx := db.Table("users")
+		if c.where {
+			tx = tx.Where("id = ?", 1)
+		}
+		tx.Find(&list)
+
+		got := map[string]string{}
+		for _, record := range tracer.FinishedSpans()[0].Logs() {
+			for _, field := range record.Fields {
+				if field.Key != _fieldTable {
+					got[field.Key] = field.ValueString
+				}
+			}
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("%s: fields = %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for k, v := range c.want {
+			if got[k] != v {
+				t.Errorf("%s: %s = %q, want %q", c.name, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"SELECT 1", 6, "SELECT"},
+		// "小明" 每个字 3 个字节，不能截断在字符中间
+		{"name = '小明'", 10, "name = '"},
+		{"name = '小明'", 11, "name = '小"},
+	} {
+		if got := truncateUTF8(c.s, c.max); got != c.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", c.s, c.max, got, c.want)
+		}
+	}
+}
+
+func TestWithMaxSQLLength(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer, WithMaxSQLLength(20))); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	db.Table("users").Where("name = ?", "小明小明小明").Find(&list)
+
+	short, long := tracer.FinishedSpans()[0], tracer.FinishedSpans()[1]
+	if short.Tag(_tagTruncated) != nil {
+		t.Error("short SQL should not be truncated")
+	}
+	if long.Tag(_tagTruncated) != true {
+		t.Error("long SQL should be marked as truncated")
+	}
+	for _, record := range long.Logs() {
+		for _, field := range record.Fields {
+			if len(field.ValueString) > 20 {
+				t.Errorf("%s = %q", field.Key, field.ValueString)
+			}
+		}
+	}
+}
+
+// Explain 会被调用时直接失败
+type noExplainDialector struct {
+	fakeDialector
+	t *testing.T
+}
+
+func (d noExplainDialector) Explain(sql string, vars ...interface{}) string {
+	d.t.Error("Explain called in redact mode")
+	return sql
+}
+
+func TestWithRedactParams(t *testing.T) {
+	tracer := mocktracer.New()
+	db, err := gorm.Open(noExplainDialector{t: t}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewWithTracer(tracer, WithRedactParams())); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Where("email = ?", "xiaoming@example.com").Find(&list)
+
+	got := map[string]string{}
+	for _, record := range tracer.FinishedSpans()[0].Logs() {
+		for _, field := range record.Fields {
+			got[field.Key] = field.ValueString
+		}
+	}
+	if got[_fieldSQL] != "SELECT * FROM users WHERE email = ?" || len(got) != 2 {
+		t.Errorf("fields = %v", got)
+	}
+}
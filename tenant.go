@@ -0,0 +1,44 @@
+package istiogormtracing
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// 租户 id，可以按租户统计数据库的耗时
+const _tagTenantID = "tenant.id"
+
+// 从 context 中取出租户 id，没有时返回空字符串
+type TenantExtractor func(ctx context.Context) string
+
+// 设置获取租户 id 的方法，结果记录在每个 span 的 tenant.id 中
+// 如从业务的 context 中获取: WithTenantExtractor(func(ctx context.Context) string { return auth.TenantID(ctx) })
+func WithTenantExtractor(extractor TenantExtractor) Option {
+	return func(i *IstioGormTracing) {
+		i.tenantExtractor = extractor
+	}
+}
+
+// 从 baggage 中获取租户 id，依次查找 context 中保存的 header(W3C baggage 和 ot-baggage-*)和 context 中的 span
+func TenantFromBaggage(key string) TenantExtractor {
+	return func(ctx context.Context) string {
+		if v := extractBaggage(headersFromContext(ctx))[key]; v != "" {
+			return v
+		}
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			return span.BaggageItem(key)
+		}
+		return ""
+	}
+}
+
+// 记录租户 id
+func (i *IstioGormTracing) setTenantTag(span opentracing.Span, ctx context.Context) {
+	if i.tenantExtractor == nil {
+		return
+	}
+	if tenant := i.tenantExtractor(ctx); tenant != "" {
+		span.SetTag(_tagTenantID, tenant)
+	}
+}
@@ -0,0 +1,54 @@
+package istiogormtracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+type tenantCtxKey struct{}
+
+func TestWithTenantExtractor(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	extractor := func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantCtxKey{}).(string)
+		return tenant
+	}
+	if err := db.Use(NewWithTracer(tracer, WithTenantExtractor(extractor))); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.WithContext(context.WithValue(context.Background(), tenantCtxKey{}, "acme")).Table("users").Find(&list)
+	db.WithContext(context.Background()).Table("users").Find(&list)
+
+	spans := tracer.FinishedSpans()
+	if got := spans[0].Tag(_tagTenantID); got != "acme" {
+		t.Errorf("tenant.id = %v", got)
+	}
+	if _, ok := spans[1].Tags()[_tagTenantID]; ok {
+		t.Error("empty tenant should not be recorded")
+	}
+}
+
+func TestTenantFromBaggage(t *testing.T) {
+	extractor := TenantFromBaggage("tenant")
+
+	h := http.Header{}
+	h.Set("baggage", "tenant=acme,user=1")
+	if got := extractor(WithHeaders(context.Background(), h)); got != "acme" {
+		t.Errorf("from header = %q", got)
+	}
+
+	span := mocktracer.New().StartSpan("parent")
+	span.SetBaggageItem("tenant", "globex")
+	if got := extractor(opentracing.ContextWithSpan(WithHeaders(context.Background(), http.Header{}), span)); got != "globex" {
+		t.Errorf("from span = %q", got)
+	}
+	if got := extractor(WithHeaders(context.Background(), http.Header{})); got != "" {
+		t.Errorf("no tenant = %q", got)
+	}
+}
@@ -0,0 +1,87 @@
+package istiogormtracing
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCollectorTLSAndAuth(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers []http.Header
+	)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := LoadTLSConfig(caFile, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opt  Option
+		want func(h http.Header) bool
+	}{
+		{
+			name: "bearer",
+			opt:  WithCollectorBearerToken("token"),
+			want: func(h http.Header) bool { return h.Get("Authorization") == "Bearer token" },
+		},
+		{
+			name: "basic",
+			opt:  WithCollectorBasicAuth("user", "password"),
+			want: func(h http.Header) bool {
+				r := &http.Request{Header: h}
+				user, password, ok := r.BasicAuth()
+				return ok && user == "user" && password == "password"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			headers = nil
+			mu.Unlock()
+
+			i, err := New(
+				WithServiceName("istio-gorm-tracing-test"),
+				WithCollectorEndpoint(server.URL+"/api/traces"),
+				WithCollectorTLS(tlsConfig),
+				tt.opt,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			i.getTracer().StartSpan(_opQuery).Finish()
+			if err := i.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(headers) != 1 || !tt.want(headers[0]) {
+				t.Errorf("headers = %v", headers)
+			}
+		})
+	}
+
+	if _, err := LoadTLSConfig(filepath.Join(t.TempDir(), "missing.pem"), "", ""); err == nil {
+		t.Error("missing CA file accepted")
+	}
+}
@@ -0,0 +1,59 @@
+package istiogormtracing
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	"gorm.io/gorm"
+)
+
+// 同一事务中的 SQL 有相同的事务 id，可以按事务对 span 分组
+const _tagTransactionID = "db.transaction.id"
+
+// 事务对象的地址到事务 id 的映射，事务对象被回收时删除；所有插件实例共用，每个事务对象只设置一次 finalizer
+var _transactionIDs sync.Map
+
+// 在事务中执行的 SQL 记录事务 id
+func setTransactionTag(span opentracing.Span, db *gorm.DB) {
+	if id := transactionID(db.Statement.ConnPool); id != "" {
+		span.SetTag(_tagTransactionID, id)
+	}
+}
+
+// 第一次遇到 Begin 创建的事务对象时生成 id，不在事务中时返回空字符串
+// 只处理 database/sql 和 gorm 预编译模式的事务，不会为其他类型的对象设置 finalizer
+func transactionID(pool gorm.ConnPool) string {
+	pool = originalConnPool(pool)
+	switch pool.(type) {
+	case *sql.Tx, *gorm.PreparedStmtTX:
+	default:
+		return ""
+	}
+	key := reflect.ValueOf(pool).Pointer()
+	if key == 0 {
+		return ""
+	}
+	if id, ok := _transactionIDs.Load(key); ok {
+		return id.(string)
+	}
+	id, loaded := _transactionIDs.LoadOrStore(key, newTransactionID())
+	if !loaded {
+		// 只保存地址，不影响事务对象的回收；回收后地址可能被新的事务使用，因此需要删除
+		runtime.SetFinalizer(pool, func(interface{}) {
+			_transactionIDs.Delete(key)
+		})
+	}
+	return id.(string)
+}
+
+// 随机生成 16 位的 id
+func newTransactionID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,50 @@
+package istiogormtracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+)
+
+func TestTransactionTag(t *testing.T) {
+	for _, prepare := range []bool{false, true} {
+		testTransactionTag(t, prepare)
+	}
+}
+
+func testTransactionTag(t *testing.T, prepare bool) {
+	tracer := mocktracer.New()
+	db := openDB(t).Session(&gorm.Session{PrepareStmt: prepare})
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		tx.Table("users").Create(map[string]interface{}{"id": 1})
+		tx.Table("users").Where("id = ?", 1).Find(&list)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Transaction(func(tx *gorm.DB) error {
+		return tx.Table("users").Find(&list).Error
+	})
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 4 {
+		t.Fatalf("prepare=%v: got %d spans", prepare, len(spans))
+	}
+	if _, ok := spans[0].Tags()[_tagTransactionID]; ok {
+		t.Errorf("prepare=%v: query outside transaction should not record db.transaction.id", prepare)
+	}
+	first, second, other := spans[1].Tag(_tagTransactionID), spans[2].Tag(_tagTransactionID), spans[3].Tag(_tagTransactionID)
+	if first == nil || first != second {
+		t.Errorf("prepare=%v: same transaction: %v, %v", prepare, first, second)
+	}
+	if other == nil || other == first {
+		t.Errorf("prepare=%v: different transactions: %v, %v", prepare, first, other)
+	}
+}
@@ -0,0 +1,150 @@
+package istiogormtracing
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"gorm.io/gorm"
+)
+
+// 事务 span 的操作名称和事务的结果
+const (
+	_opTransaction = "transaction"
+	// commit 或 rollback
+	_tagTransactionOutcome = "db.transaction.outcome"
+	// 嵌套事务，提交和回滚的是保存点
+	_tagTransactionNested = "db.transaction.nested"
+)
+
+const (
+	_outcomeCommit   = "commit"
+	_outcomeRollback = "rollback"
+)
+
+// 在 context 中保存事务 span 的 key，Commit 和 Rollback 时取出
+type txSpanCtxKey struct{}
+
+// 事务 span 只结束一次，先 Commit 再 defer Rollback 时以 Commit 的结果为准
+type txSpanHolder struct {
+	once sync.Once
+	span opentracing.Span
+}
+
+// 与 db.Transaction 相同，同时创建一个事务 span 作为事务中 SQL 的父 span，可以看到包括业务代码在内的事务总耗时
+// 事务的结果记录在 db.transaction.outcome 中，为 commit 或 rollback
+// 使用方式: err := plugin.Transaction(gormDb.WithContext(ctx), func(tx *gorm.DB) error { ... })
+func (i *IstioGormTracing) Transaction(db *gorm.DB, fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
+	span, ctx := i.startParentSpan(db, _opTransaction)
+	if span == nil {
+		return db.Transaction(fc, opts...)
+	}
+	// 已经在事务中时 gorm 使用保存点实现嵌套事务
+	if committer, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok && committer != nil && !db.DisableNestedTransaction {
+		span.SetTag(_tagTransactionNested, true)
+	}
+	committed := false
+	// fc 中 panic 时 gorm 会回滚事务并继续 panic
+	defer func() {
+		if r := recover(); r != nil {
+			i.finishTransactionSpan(span, _outcomeRollback, fmt.Errorf("事务中发生 panic: %v", r))
+			panic(r)
+		}
+	}()
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		setTransactionTag(span, tx)
+		if err := fc(tx); err != nil {
+			return err
+		}
+		committed = true
+		return nil
+	}, opts...)
+	outcome := _outcomeRollback
+	if committed && err == nil {
+		outcome = _outcomeCommit
+	}
+	i.finishTransactionSpan(span, outcome, err)
+	return err
+}
+
+// 与 db.Begin 相同，同时创建事务 span，需要通过插件的 Commit 或 Rollback 结束事务
+// 使用方式: tx := plugin.Begin(gormDb.WithContext(ctx)); ...; plugin.Commit(tx)
+func (i *IstioGormTracing) Begin(db *gorm.DB, opts ...*sql.TxOptions) *gorm.DB {
+	span, ctx := i.startParentSpan(db, _opTransaction)
+	if span == nil {
+		return db.Begin(opts...)
+	}
+	holder := &txSpanHolder{span: span}
+	tx := db.WithContext(context.WithValue(ctx, txSpanCtxKey{}, holder)).Begin(opts...)
+	if tx.Error != nil {
+		i.finishTransactionSpan(span, _outcomeRollback, tx.Error)
+		return tx
+	}
+	setTransactionTag(span, tx)
+	return tx
+}
+
+// 提交 Begin 创建的事务并结束事务 span
+func (i *IstioGormTracing) Commit(tx *gorm.DB) *gorm.DB {
+	tx = tx.Commit()
+	i.endTransaction(tx, _outcomeCommit)
+	return tx
+}
+
+// 回滚 Begin 创建的事务并结束事务 span
+func (i *IstioGormTracing) Rollback(tx *gorm.DB) *gorm.DB {
+	tx = tx.Rollback()
+	i.endTransaction(tx, _outcomeRollback)
+	return tx
+}
+
+// 结束 Begin 创建的事务 span，已经结束时不做处理
+func (i *IstioGormTracing) endTransaction(tx *gorm.DB, outcome string) {
+	if tx == nil || tx.Statement == nil || tx.Statement.Context == nil {
+		return
+	}
+	holder, ok := tx.Statement.Context.Value(txSpanCtxKey{}).(*txSpanHolder)
+	if !ok {
+		return
+	}
+	holder.once.Do(func() {
+		i.finishTransactionSpan(holder.span, outcome, tx.Error)
+	})
+}
+
+// 创建事务、关联保存等包含多条 SQL 的 span 并放入 context，不追踪时返回 nil
+func (i *IstioGormTracing) startParentSpan(db *gorm.DB, op string) (opentracing.Span, context.Context) {
+	if db == nil || db.Statement == nil || !i.Enabled() || db.DryRun || skipTracing(db) {
+		return nil, nil
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	h := headersFromContext(ctx)
+	opts := append(i.parentOptions(ctx, h), opentracing.Tag{Key: string(ext.Component), Value: _component})
+	for _, tag := range i.spanTags {
+		opts = append(opts, tag)
+	}
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, i.getTracer(), op, opts...)
+	i.applyBaggage(span, h)
+	span.SetTag(_tagDBType, "sql")
+	if system := dbSystemOf(db); system != "" {
+		span.SetTag(_tagDBSystem, system)
+	}
+	if dbName := i.dbInstance(db); dbName != "" {
+		span.SetTag(_tagDBInstance, dbName)
+	}
+	return span, ctx
+}
+
+func (i *IstioGormTracing) finishTransactionSpan(span opentracing.Span, outcome string, err error) {
+	span.SetTag(_tagTransactionOutcome, outcome)
+	if err != nil && i.isError(err) {
+		setSpanError(span, err)
+	}
+	span.Finish()
+}
@@ -0,0 +1,98 @@
+package istiogormtracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+)
+
+func TestTransactionSpan(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	plugin := NewWithTracer(tracer)
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	err := plugin.Transaction(db.WithContext(context.Background()), func(tx *gorm.DB) error {
+		tx.Table("users").Find(&list)
+		tx.Table("orders").Find(&list)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollback := errors.New("rollback")
+	if err := plugin.Transaction(db, func(tx *gorm.DB) error { return rollback }); err != rollback {
+		t.Fatalf("err = %v", err)
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 4 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	txSpan := spans[2]
+	if txSpan.OperationName != _opTransaction || txSpan.Tag(_tagTransactionOutcome) != _outcomeCommit {
+		t.Errorf("transaction span = %s %v", txSpan.OperationName, txSpan.Tags())
+	}
+	for _, span := range spans[:2] {
+		if span.ParentID != txSpan.SpanContext.SpanID || span.Tag(_tagTransactionID) != txSpan.Tag(_tagTransactionID) {
+			t.Errorf("statement span %s: parent = %d, want %d", span.OperationName, span.ParentID, txSpan.SpanContext.SpanID)
+		}
+	}
+	if spans[3].Tag(_tagTransactionOutcome) != _outcomeRollback || spans[3].Tag("error") != true {
+		t.Errorf("rollback span = %v", spans[3].Tags())
+	}
+}
+
+func TestBeginCommitRollbackSpan(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	plugin := NewWithTracer(tracer)
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	tx := plugin.Begin(db)
+	tx.Table("users").Find(&list)
+	plugin.Commit(tx)
+	// 提交后 defer 的 Rollback 不会再次结束 span
+	plugin.Rollback(tx)
+
+	tx = plugin.Begin(db)
+	plugin.Rollback(tx)
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	if spans[0].ParentID != spans[1].SpanContext.SpanID {
+		t.Error("statement span should be a child of the transaction span")
+	}
+	if spans[1].Tag(_tagTransactionOutcome) != _outcomeCommit || spans[1].Tag("error") != nil {
+		t.Errorf("commit span = %v", spans[1].Tags())
+	}
+	if spans[2].Tag(_tagTransactionOutcome) != _outcomeRollback {
+		t.Errorf("rollback span = %v", spans[2].Tags())
+	}
+}
+
+func TestTransactionSpanPanic(t *testing.T) {
+	tracer := mocktracer.New()
+	db := openDB(t)
+	plugin := NewWithTracer(tracer)
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() { recover() }()
+		plugin.Transaction(db, func(tx *gorm.DB) error { panic("boom") })
+	}()
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 || spans[0].Tag(_tagTransactionOutcome) != _outcomeRollback {
+		t.Errorf("spans = %v", spans)
+	}
+}
@@ -0,0 +1,78 @@
+package istiogormtracing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// 检查收集器地址时的超时时间
+const _validateEndpointTimeout = 5 * time.Second
+
+// 检查 jaeger 收集器是否可以访问，失败时返回具体原因，如域名解析失败、证书错误、认证失败
+// 收集器只接受 POST 请求，这里用 GET 请求，返回 405 等状态码说明地址和认证都没有问题
+func (i *IstioGormTracing) checkEndpoint() error {
+	req, err := http.NewRequest(http.MethodGet, i.CollectorEndpoint, nil)
+	if err != nil {
+		return fmt.Errorf("jaeger 收集器地址 %s 格式错误, 错误原因: %w", i.CollectorEndpoint, err)
+	}
+	if i.collectorUser != "" {
+		req.SetBasicAuth(i.collectorUser, i.collectorPassword)
+	}
+	if i.collectorToken != "" {
+		req.Header.Set("Authorization", "Bearer "+i.collectorToken)
+	}
+	client := &http.Client{
+		Timeout: _validateEndpointTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: i.collectorTLS,
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("jaeger 收集器 %s 连接失败, %s, 错误原因: %w", i.CollectorEndpoint, endpointErrorReason(err), err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("jaeger 收集器 %s 认证失败, 请检查用户名密码或 token, 状态码: %d", i.CollectorEndpoint, resp.StatusCode)
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("jaeger 收集器 %s 路径不存在, 地址一般为 http://{host}:14268/api/traces", i.CollectorEndpoint)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("jaeger 收集器 %s 服务异常, 状态码: %d", i.CollectorEndpoint, resp.StatusCode)
+	}
+	return nil
+}
+
+// 常见的连接错误对应的说明
+func endpointErrorReason(err error) string {
+	var (
+		dnsErr     *net.DNSError
+		unknownCA  x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		certErr    x509.CertificateInvalidError
+		recordErr  tls.RecordHeaderError
+		opErr      *net.OpError
+		timeoutErr net.Error
+	)
+	switch {
+	case errors.As(err, &dnsErr):
+		return "域名解析失败"
+	case errors.As(err, &unknownCA):
+		return "证书不受信任, 请通过 WithCollectorTLS 设置 CA 证书"
+	case errors.As(err, &hostErr), errors.As(err, &certErr):
+		return "证书校验失败"
+	case errors.As(err, &recordErr):
+		return "TLS 握手失败, 收集器可能没有开启 https"
+	case errors.As(err, &timeoutErr) && timeoutErr.Timeout():
+		return "连接超时"
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return "无法建立连接, 请检查地址和端口"
+	}
+	return "请求失败"
+}
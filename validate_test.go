@@ -0,0 +1,58 @@
+package istiogormtracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestWithValidateEndpoint(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/api/traces":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Header.Get("Authorization") != "Bearer secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+
+	for _, c := range []struct {
+		endpoint string
+		token    string
+		want     string
+	}{
+		{server.URL + "/api/traces", "secret", ""},
+		{server.URL + "/api/traces", "wrong", "认证失败"},
+		{server.URL + "/traces", "secret", "路径不存在"},
+		{tlsServer.URL + "/api/traces", "secret", "证书不受信任"},
+		{"http://jaeger-collector.invalid:14268/api/traces", "secret", "域名解析失败"},
+	} {
+		i, err := New(
+			WithServiceName("istio-gorm-tracing-test"),
+			WithCollectorEndpoint(c.endpoint),
+			WithCollectorBearerToken(c.token),
+			WithReporter(jaeger.NewNullReporter()),
+			WithValidateEndpoint(),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = i.Initialize(openDB(t))
+		i.Close()
+		if c.want == "" && err != nil {
+			t.Errorf("%s: %v", c.endpoint, err)
+		}
+		if c.want != "" && (err == nil || !strings.Contains(err.Error(), c.want)) {
+			t.Errorf("%s: err = %v, want %s", c.endpoint, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package istiogormtracing
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+const (
+	_modulePath     = "github.com/liamhao/istio-gorm-tracing"
+	_gormModulePath = "gorm.io/gorm"
+	// 没有编译信息或直接在此仓库中运行时的版本
+	_develVersion = "(devel)"
+
+	// 插件和 gorm 的版本
+	_tagPluginVersion = "plugin.version"
+	_tagGormVersion   = "gorm.version"
+)
+
+var (
+	versionOnce   sync.Once
+	pluginVersion = _develVersion
+	gormVersion   = _develVersion
+)
+
+// 插件的版本，从编译信息中读取 go.mod 中依赖的版本，如 v1.2.0
+func Version() string {
+	loadVersions()
+	return pluginVersion
+}
+
+// 依赖的 gorm 版本
+func gormModuleVersion() string {
+	loadVersions()
+	return gormVersion
+}
+
+func loadVersions() {
+	versionOnce.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		if info.Main.Path == _modulePath && info.Main.Version != "" {
+			pluginVersion = info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			version := dep.Version
+			// 使用 replace 时以替换后的版本为准，替换为本地目录时没有版本
+			if dep.Replace != nil {
+				version = dep.Replace.Version
+			}
+			if version == "" {
+				version = _develVersion
+			}
+			switch dep.Path {
+			case _modulePath:
+				pluginVersion = version
+			case _gormModulePath:
+				gormVersion = version
+			}
+		}
+	})
+}
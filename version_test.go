@@ -0,0 +1,30 @@
+package istiogormtracing
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestVersionTags(t *testing.T) {
+	// 在此仓库中运行测试时插件本身没有版本，gorm 的版本来自 go.mod，go 1.18 之前测试程序中没有编译信息
+	if Version() != _develVersion {
+		t.Errorf("version = %s", Version())
+	}
+	if _, ok := debug.ReadBuildInfo(); ok && gormModuleVersion() == _develVersion {
+		t.Errorf("gorm version = %s", gormModuleVersion())
+	}
+
+	tracer := mocktracer.New()
+	db := openDB(t)
+	if err := db.Use(NewWithTracer(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]interface{}
+	db.Table("users").Find(&list)
+	span := tracer.FinishedSpans()[0]
+	if span.Tag(_tagPluginVersion) != Version() || span.Tag(_tagGormVersion) != gormModuleVersion() {
+		t.Errorf("tags = %v", span.Tags())
+	}
+}
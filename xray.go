@@ -0,0 +1,90 @@
+package istiogormtracing
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+// AWS X-Ray 使用的 header，格式为: X-Amzn-Trace-Id: Root=1-{8 位时间戳}-{24 位随机数};Parent={span id};Sampled=1
+const _headerXRay = "x-amzn-trace-id"
+
+// AWS X-Ray 格式: X-Amzn-Trace-Id，ALB、App Mesh 后面的服务使用
+// 默认不会尝试此格式，需要时通过 WithPropagator 或 NewCompositePropagator(..., FormatXRay) 启用
+func XRayPropagator() Propagator {
+	return xrayPropagator{}
+}
+
+type xrayPropagator struct{}
+
+func (xrayPropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	h, err := carrierToHeader(carrier)
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+	return extractXRay(h)
+}
+
+func (xrayPropagator) Inject(spanCtx jaeger.SpanContext, carrier interface{}) error {
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	// X-Ray 的 trace id 固定为 128 位，前 8 位十六进制是时间戳
+	traceID := fmt.Sprintf("%016x%016x", spanCtx.TraceID().High, spanCtx.TraceID().Low)
+	sampled := "0"
+	if spanCtx.IsSampled() {
+		sampled = "1"
+	}
+	w.Set(_headerXRay, fmt.Sprintf("Root=1-%s-%s;Parent=%s;Sampled=%s", traceID[:8], traceID[8:], spanCtx.SpanID(), sampled))
+	return nil
+}
+
+// 按 X-Ray 格式解析，Sampled=? 或没有 Sampled 时交给本地的采样器决定
+// 只有 Root 没有 Parent 时(如 ALB 生成的 header)没有可用的父 span
+func extractXRay(h http.Header) (jaeger.SpanContext, error) {
+	header := strings.TrimSpace(h.Get(_headerXRay))
+	if header == "" {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	var root, parent, sampled string
+	for _, part := range strings.Split(header, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "Root":
+			root = kv[1]
+		case "Parent":
+			parent = kv[1]
+		case "Sampled":
+			sampled = kv[1]
+		}
+	}
+	if root == "" {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	if parent == "" {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	rootParts := strings.Split(root, "-")
+	if len(rootParts) != 3 || rootParts[0] != "1" || len(rootParts[1]) != 8 || len(rootParts[2]) != 24 || len(parent) != 16 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	traceID, err := jaeger.TraceIDFromString(rootParts[1] + rootParts[2])
+	if err != nil || !traceID.IsValid() {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	spanID, err := jaeger.SpanIDFromString(parent)
+	if err != nil || spanID == 0 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+
+	return jaeger.NewSpanContext(traceID, spanID, 0, sampled == "1", nil), nil
+}
@@ -0,0 +1,122 @@
+package istiogormtracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	// X-Ray daemon 的默认地址，ECS、EKS 中一般通过 AWS_XRAY_DAEMON_ADDRESS 指定
+	_defaultXRayDaemonAddress = "127.0.0.1:2000"
+	// 每个 UDP 包都以此 header 开头，后面是一个 segment 或 subsegment
+	_xrayDaemonHeader = "{\"format\": \"json\", \"version\": 1}\n"
+)
+
+// X-Ray 的 segment 格式，见 https://docs.aws.amazon.com/xray/latest/devguide/xray-api-segmentdocuments.html
+type xraySegment struct {
+	Name      string                 `json:"name"`
+	ID        string                 `json:"id"`
+	TraceID   string                 `json:"trace_id"`
+	ParentID  string                 `json:"parent_id,omitempty"`
+	Type      string                 `json:"type,omitempty"`
+	Namespace string                 `json:"namespace,omitempty"`
+	StartTime float64                `json:"start_time"`
+	EndTime   float64                `json:"end_time"`
+	Fault     bool                   `json:"fault,omitempty"`
+	SQL       *xraySQL               `json:"sql,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type xraySQL struct {
+	SanitizedQuery string `json:"sanitized_query,omitempty"`
+	DatabaseType   string `json:"database_type,omitempty"`
+	URL            string `json:"url,omitempty"`
+}
+
+// 通过 UDP 发送到 X-Ray daemon，daemonAddress 为空时读取 AWS_XRAY_DAEMON_ADDRESS，默认为 127.0.0.1:2000
+// 有父 span 的操作上报为 namespace 为 remote 的 subsegment，sql 中记录使用占位符的 SQL
+// trace id 需要是 X-Ray 格式(前 8 位为时间戳)才能被 X-Ray 接受，一般配合 FormatXRay 使用
+func NewXRayReporter(serviceName, daemonAddress string) (jaeger.Reporter, error) {
+	if daemonAddress == "" {
+		daemonAddress = os.Getenv("AWS_XRAY_DAEMON_ADDRESS")
+	}
+	if daemonAddress == "" {
+		daemonAddress = _defaultXRayDaemonAddress
+	}
+	conn, err := net.Dial("udp", daemonAddress)
+	if err != nil {
+		return nil, fmt.Errorf("X-Ray daemon 连接失败, 错误原因: %w", err)
+	}
+	r := newBatchReporter(func(spans []*spanData) error {
+		for _, segment := range toXRaySegments(serviceName, spans) {
+			b, err := json.Marshal(segment)
+			if err != nil {
+				return err
+			}
+			if _, err := conn.Write(append([]byte(_xrayDaemonHeader), b...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+	return &xrayReporter{batchReporter: r, conn: conn}, nil
+}
+
+// 上报完队列中的 span 后关闭 UDP 连接
+type xrayReporter struct {
+	*batchReporter
+	conn net.Conn
+}
+
+func (r *xrayReporter) Close() {
+	r.batchReporter.Close()
+	r.conn.Close()
+}
+
+func toXRaySegments(serviceName string, spans []*spanData) []xraySegment {
+	out := make([]xraySegment, 0, len(spans))
+	for _, d := range spans {
+		traceID := fmt.Sprintf("%016x%016x", d.TraceID.High, d.TraceID.Low)
+		segment := xraySegment{
+			Name:      serviceName,
+			ID:        d.SpanID.String(),
+			TraceID:   fmt.Sprintf("1-%s-%s", traceID[:8], traceID[8:]),
+			StartTime: xrayTime(d.Start),
+			EndTime:   xrayTime(d.Start.Add(d.Duration)),
+			Fault:     d.isError(),
+			Metadata:  map[string]interface{}{},
+		}
+		if d.ParentID != 0 {
+			segment.ParentID = d.ParentID.String()
+			segment.Type = "subsegment"
+			segment.Namespace = "remote"
+			segment.Name = "gorm." + d.Operation
+			dbType, _ := d.Tags["db.type"].(string)
+			segment.SQL = &xraySQL{SanitizedQuery: normalizeSQL(d.query()), DatabaseType: dbType}
+			if url, ok := d.Tags["db.instance"]; ok {
+				segment.SQL.URL = fmt.Sprint(url)
+			}
+		}
+		for k, v := range d.Tags {
+			segment.Metadata[k] = v
+		}
+		if table := d.table(); table != "" {
+			segment.Metadata["table"] = table
+		}
+		if msg := d.Fields["error.object"]; msg != "" {
+			segment.Metadata["error"] = msg
+		}
+		out = append(out, segment)
+	}
+	return out
+}
+
+// X-Ray 的时间为秒，小数部分精确到微秒
+func xrayTime(t time.Time) float64 {
+	return float64(t.UnixNano()/int64(time.Microsecond)) / 1e6
+}
@@ -0,0 +1,55 @@
+package istiogormtracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestXRayReporter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reporter, err := NewXRayReporter("istio-gorm-tracing-test", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), reporter)
+	traceID, _ := jaeger.TraceIDFromString("5759e988bd862e3fe1be46a994272793")
+	parent := jaeger.NewSpanContext(traceID, 0x53995c3f42cd8ad8, 0, true, nil)
+	span := tracer.StartSpan(_opQuery, opentracing.ChildOf(parent))
+	span.LogFields(opentracinglog.String("query", "SELECT * FROM users  WHERE id = ?"))
+	span.Finish()
+	closer.Close()
+
+	buf := make([]byte, 65535)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read udp: %v", err)
+	}
+	parts := bytes.SplitN(buf[:n], []byte("\n"), 2)
+	if len(parts) != 2 || string(parts[0])+"\n" != _xrayDaemonHeader {
+		t.Fatalf("packet = %s", buf[:n])
+	}
+	var segment xraySegment
+	if err := json.Unmarshal(parts[1], &segment); err != nil {
+		t.Fatal(err)
+	}
+	if segment.Type != "subsegment" || segment.Namespace != "remote" || segment.ParentID != "53995c3f42cd8ad8" ||
+		segment.TraceID != "1-5759e988-bd862e3fe1be46a994272793" {
+		t.Errorf("segment = %+v", segment)
+	}
+	if segment.SQL == nil || segment.SQL.SanitizedQuery != "SELECT * FROM users WHERE id = ?" {
+		t.Errorf("sql = %+v", segment.SQL)
+	}
+}
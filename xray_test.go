@@ -0,0 +1,72 @@
+package istiogormtracing
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestExtractXRay(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		err     error
+		traceID string
+		sampled bool
+	}{
+		{name: "missing", err: opentracing.ErrSpanContextNotFound},
+		{
+			name:    "sampled",
+			header:  "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1",
+			traceID: "5759e988bd862e3fe1be46a994272793", sampled: true,
+		},
+		{
+			name:    "deferred",
+			header:  "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=?",
+			traceID: "5759e988bd862e3fe1be46a994272793",
+		},
+		{name: "root only", header: "Root=1-5759e988-bd862e3fe1be46a994272793", err: opentracing.ErrSpanContextNotFound},
+		{name: "bad version", header: "Root=2-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8", err: opentracing.ErrSpanContextCorrupted},
+		{name: "short root", header: "Root=1-5759e988-bd862e3f;Parent=53995c3f42cd8ad8", err: opentracing.ErrSpanContextCorrupted},
+		{name: "no root", header: "Parent=53995c3f42cd8ad8;Sampled=1", err: opentracing.ErrSpanContextCorrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.header != "" {
+				h.Set("X-Amzn-Trace-Id", tt.header)
+			}
+			spanCtx, err := extractXRay(h)
+			if err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if spanCtx.TraceID().String() != tt.traceID || spanCtx.SpanID().String() != "53995c3f42cd8ad8" || spanCtx.IsSampled() != tt.sampled {
+				t.Errorf("span context = %s", spanCtx)
+			}
+		})
+	}
+}
+
+func TestXRayRoundTrip(t *testing.T) {
+	traceID, _ := jaeger.TraceIDFromString("5759e988bd862e3fe1be46a994272793")
+	spanCtx := jaeger.NewSpanContext(traceID, 0x53995c3f42cd8ad8, 0, true, nil)
+	h := http.Header{}
+	if err := XRayPropagator().Inject(spanCtx, opentracing.HTTPHeadersCarrier(h)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"; h.Get("X-Amzn-Trace-Id") != want {
+		t.Errorf("header = %s, want %s", h.Get("X-Amzn-Trace-Id"), want)
+	}
+	got, err := XRayPropagator().Extract(opentracing.HTTPHeadersCarrier(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TraceID() != traceID || got.SpanID() != spanCtx.SpanID() {
+		t.Errorf("round trip = %s", got)
+	}
+}
@@ -0,0 +1,70 @@
+package istiogormtracing
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+// zipkin v2 的 span 格式，见 https://zipkin.io/zipkin-api/#/default/post_spans
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind,omitempty"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// 直接上报到 zipkin 的 /api/v2/spans 接口，不需要部署 jaeger 收集器，endpoint 如 http://zipkin.istio-system:9411/api/v2/spans
+// 使用方式: istiogormtracing.New(istiogormtracing.WithReporter(istiogormtracing.NewZipkinReporter("svc", endpoint)))
+func NewZipkinReporter(serviceName, endpoint string) jaeger.Reporter {
+	client := newReporterClient()
+	return newBatchReporter(func(spans []*spanData) error {
+		return sendJSON(client, http.MethodPost, endpoint, nil, toZipkinSpans(serviceName, spans))
+	}, nil)
+}
+
+func toZipkinSpans(serviceName string, spans []*spanData) []zipkinSpan {
+	out := make([]zipkinSpan, 0, len(spans))
+	for _, d := range spans {
+		span := zipkinSpan{
+			TraceID:       d.TraceID.String(),
+			ID:            d.SpanID.String(),
+			Name:          d.Operation,
+			Kind:          "CLIENT",
+			Timestamp:     d.Start.UnixNano() / int64(time.Microsecond),
+			Duration:      int64(d.Duration / time.Microsecond),
+			LocalEndpoint: zipkinEndpoint{ServiceName: serviceName},
+			Tags:          map[string]string{},
+		}
+		if d.ParentID != 0 {
+			span.ParentID = d.ParentID.String()
+		}
+		// zipkin 的 tag 只能是字符串，日志中记录的 sql 等字段也作为 tag
+		for k, v := range d.Tags {
+			span.Tags[k] = fmt.Sprint(v)
+		}
+		for k, v := range d.Fields {
+			span.Tags[k] = v
+		}
+		// zipkin 通过 error tag 标记出错的 span，值不能为空
+		if d.isError() {
+			span.Tags["error"] = "true"
+			if msg := d.Fields["error.object"]; msg != "" {
+				span.Tags["error"] = msg
+			}
+		}
+		out = append(out, span)
+	}
+	return out
+}
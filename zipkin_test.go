@@ -0,0 +1,52 @@
+package istiogormtracing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestZipkinReporter(t *testing.T) {
+	var got []zipkinSpan
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/spans" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var spans []zipkinSpan
+		if err := json.NewDecoder(r.Body).Decode(&spans); err != nil {
+			t.Error(err)
+		}
+		got = append(got, spans...)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), NewZipkinReporter("istio-gorm-tracing-test", server.URL+"/api/v2/spans"))
+	parent := tracer.StartSpan("http")
+	span := tracer.StartSpan(_opQuery, opentracing.ChildOf(parent.Context()))
+	span.SetTag("db.table", "users")
+	span.LogFields(opentracinglog.String("sql", "SELECT * FROM users"), opentracinglog.Error(errors.New("boom")))
+	span.Finish()
+	closer.Close()
+
+	if len(got) != 1 {
+		t.Fatalf("spans = %d, want 1", len(got))
+	}
+	z := got[0]
+	spanCtx := span.Context().(jaeger.SpanContext)
+	if z.TraceID != spanCtx.TraceID().String() || z.ID != spanCtx.SpanID().String() || z.ParentID != spanCtx.ParentID().String() {
+		t.Errorf("ids = %s/%s/%s", z.TraceID, z.ID, z.ParentID)
+	}
+	if z.Name != _opQuery || z.LocalEndpoint.ServiceName != "istio-gorm-tracing-test" || z.Kind != "CLIENT" {
+		t.Errorf("span = %+v", z)
+	}
+	if z.Tags["sql"] != "SELECT * FROM users" || z.Tags["db.table"] != "users" || z.Tags["error"] != "boom" {
+		t.Errorf("tags = %v", z.Tags)
+	}
+}